@@ -5,6 +5,8 @@ endif
 /tmp/build-clair/var/lib/clair/GIT_REV:
 	mkdir -p /tmp/build-clair
 	mkdir -p /tmp/build-clair/usr/share/bash-completion/completions
+	mkdir -p /tmp/build-clair/usr/share/fish/vendor_completions.d
+	mkdir -p /tmp/build-clair/usr/share/zsh/vendor-completions
 	mkdir -p /tmp/build-clair/usr/bin
 	mkdir -p /tmp/build-clair/usr/share/doc/clair
 	mkdir -p /tmp/build-clair/usr/share/lintian/overrides
@@ -13,15 +15,16 @@ endif
 
 	cp clair /tmp/build-clair/usr/bin
 	cp LICENSE /tmp/build-clair/usr/share/doc/clair/copyright
-	cp contrib/bash-completion /tmp/build-clair/usr/share/bash-completion/completions/clair
 	find . -name ".DS_Store" -depth -exec rm {} \;
 	$(MAKE) go-build
+	plugins/common/common help-completion bash > /tmp/build-clair/usr/share/bash-completion/completions/clair
+	plugins/common/common help-completion fish > /tmp/build-clair/usr/share/fish/vendor_completions.d/clair.fish
+	plugins/common/common help-completion zsh > /tmp/build-clair/usr/share/zsh/vendor-completions/_clair
 	cp common.mk /tmp/build-clair/var/lib/clair/core-plugins/common.mk
 	cp -r plugins/* /tmp/build-clair/var/lib/clair/core-plugins/available
 	find plugins/ -mindepth 1 -maxdepth 1 -type d -printf '%f\n' | while read plugin; do cd /tmp/build-clair/var/lib/clair/core-plugins/available/$$plugin && if [ -e Makefile ]; then $(MAKE) src-clean; fi; done
 	find plugins/ -mindepth 1 -maxdepth 1 -type d -printf '%f\n' | while read plugin; do touch /tmp/build-clair/var/lib/clair/core-plugins/available/$$plugin/.core; done
 	rm /tmp/build-clair/var/lib/clair/core-plugins/common.mk
-	$(MAKE) help2man
 	$(MAKE) addman
 	cp /usr/local/share/man/man1/clair.1 /tmp/build-clair/usr/share/man/man1/clair.1
 	gzip -9 /tmp/build-clair/usr/share/man/man1/clair.1
@@ -0,0 +1,15 @@
+package events
+
+var (
+	DefaultProperties = map[string]string{
+		"max-age":     "",
+		"max-backups": "",
+		"max-size":    "",
+	}
+
+	GlobalProperties = map[string]bool{
+		"max-age":     true,
+		"max-backups": true,
+		"max-size":    true,
+	}
+)
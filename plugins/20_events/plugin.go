@@ -0,0 +1,47 @@
+package events
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the events commands and triggers
+var Plugin = common.NewPlugin("events", "Query the clair event log")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "query",
+		Description: "Display events from the event log",
+		Flags: []common.Flag{
+			{Name: "app", Description: "--app: only show events for the app", Complete: common.CompleteApp},
+			{Name: "type", Description: "--type: only show events of the type"},
+			{Name: "since", Placeholder: "<duration>", Description: "--since: only show events newer than the duration, such as 1h or 7d"},
+			{Name: "limit", Kind: common.KindInt, Default: "0", Placeholder: "<count>", Description: "--limit: show at most the given number of the most recent events"},
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandQuery(ctx.String("app"), ctx.String("type"), ctx.String("since"), ctx.Int("limit"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "set",
+		Description: "Set or clear an event log rotation property",
+		Args: []common.Arg{
+			{Name: "key", Values: []string{"max-age", "max-backups", "max-size"}},
+			{Name: "value", Optional: true},
+		},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Default: "true", Description: "--global: set a global property"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandSet(ctx.String("key"), ctx.String("value"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+}
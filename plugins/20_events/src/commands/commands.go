@@ -0,0 +1,9 @@
+package main
+
+import (
+	events "github.com/vinybergamo/clair/plugins/20_events"
+)
+
+func main() {
+	events.Plugin.RunCommands()
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandQuery displays the events matching the given filters
+func CommandQuery(appName string, eventType string, since string, limit int, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	// the limit is applied once events for inaccessible apps are dropped
+	filter := common.EventFilter{App: appName, Type: eventType}
+	if since != "" {
+		age, err := common.ParseAge(since)
+		if err != nil {
+			return err
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+
+	events, err := common.QueryEvents(common.EventsLogFile(), filter)
+	if err != nil {
+		return fmt.Errorf("Unable to read event log: %s", err.Error())
+	}
+	events = common.FilterEvents(events)
+	if limit > 0 && len(events) > limit {
+		events = events[len(events)-limit:]
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(events) == 0 {
+		common.LogInfo1Quiet("No events found")
+		return nil
+	}
+
+	rows := [][]string{{"Time", "Type", "App", "User", "Trigger", "Args"}}
+	for _, event := range events {
+		rows = append(rows, []string{
+			event.Timestamp.Local().Format(time.RFC3339),
+			event.Type,
+			event.App,
+			event.User,
+			event.Trigger,
+			strings.Join(event.Args, " "),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandSet sets or clears a global events property
+func CommandSet(property string, value string) error {
+	if value != "" {
+		if err := validateProperty(property, value); err != nil {
+			return err
+		}
+	}
+
+	common.CommandPropertySet("events", "--global", property, value, DefaultProperties, GlobalProperties)
+	return nil
+}
+
+func validateProperty(property string, value string) error {
+	switch property {
+	case "max-age":
+		if _, err := common.ParseAge(value); err != nil {
+			return err
+		}
+	case "max-backups":
+		if i, err := strconv.Atoi(value); err != nil || i < 0 {
+			return errors.New("Invalid max-backups: must be a positive integer")
+		}
+	case "max-size":
+		if _, err := common.ParseBytes(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
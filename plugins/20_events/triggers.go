@@ -0,0 +1,16 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// TriggerInstall runs the install step for the events plugin
+func TriggerInstall() error {
+	if err := common.PropertySetup("events"); err != nil {
+		return fmt.Errorf("Unable to install the events plugin: %s", err.Error())
+	}
+
+	return nil
+}
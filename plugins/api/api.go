@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+var (
+	DefaultProperties = map[string]string{
+		"listen": "127.0.0.1:9103",
+	}
+
+	GlobalProperties = map[string]bool{
+		"listen": true,
+	}
+)
+
+// getListenAddress returns the address the api server listens on
+func getListenAddress() string {
+	return common.PropertyGetDefault("api", "--global", "listen", DefaultProperties["listen"])
+}
+
+// generateToken returns a new random api token
+func generateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken returns the hex encoded sha256 hash under which a token is stored
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate returns the identity for a bearer token. The token generated by
+// api:token:generate grants every scope, other tokens are created by auth:tokens:create.
+func authenticate(token string) (common.APIToken, error) {
+	if verifyToken(token) {
+		return common.APIToken{ID: "api", Name: "api", Scopes: []string{"*"}}, nil
+	}
+
+	return common.AuthenticateAPIToken(token)
+}
+
+// verifyToken returns true if the token matches the stored token hash
+func verifyToken(token string) bool {
+	stored := strings.TrimSpace(common.PropertyGet("api", "--global", "token-hash"))
+	if stored == "" || token == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(hashToken(token)), []byte(stored)) == 1
+}
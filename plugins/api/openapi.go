@@ -0,0 +1,191 @@
+package api
+
+// openAPIDocument describes the app management api
+const openAPIDocument = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "clair api",
+    "description": "Manage clair apps over http",
+    "version": "1"
+  },
+  "components": {
+    "securitySchemes": {
+      "bearer": {"type": "http", "scheme": "bearer"}
+    },
+    "parameters": {
+      "app": {"name": "app", "in": "path", "required": true, "schema": {"type": "string"}}
+    },
+    "schemas": {
+      "App": {
+        "type": "object",
+        "properties": {"app": {"type": "string"}}
+      },
+      "AppList": {
+        "type": "object",
+        "properties": {"apps": {"type": "array", "items": {"type": "string"}}}
+      },
+      "AppLock": {
+        "type": "object",
+        "properties": {"app": {"type": "string"}, "locked": {"type": "boolean"}}
+      },
+      "AppReport": {
+        "type": "object",
+        "properties": {
+          "app": {"type": "string"},
+          "report": {"type": "object", "additionalProperties": {"type": "string"}}
+        }
+      },
+      "CreateRequest": {
+        "type": "object",
+        "required": ["name"],
+        "properties": {"name": {"type": "string"}}
+      },
+      "CloneRequest": {
+        "type": "object",
+        "required": ["new_name"],
+        "properties": {
+          "new_name": {"type": "string"},
+          "skip_deploy": {"type": "boolean"},
+          "ignore_existing": {"type": "boolean"}
+        }
+      },
+      "RenameRequest": {
+        "type": "object",
+        "required": ["new_name"],
+        "properties": {
+          "new_name": {"type": "string"},
+          "skip_deploy": {"type": "boolean"},
+          "keep_alias": {"type": "boolean"}
+        }
+      },
+      "Error": {
+        "type": "object",
+        "properties": {"error": {"type": "string"}}
+      }
+    },
+    "responses": {
+      "Error": {
+        "description": "The request failed",
+        "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Error"}}}
+      }
+    }
+  },
+  "security": [{"bearer": []}],
+  "paths": {
+    "/v1/apps": {
+      "get": {
+        "operationId": "listApps",
+        "summary": "List apps",
+        "responses": {
+          "200": {"description": "The apps", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AppList"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "post": {
+        "operationId": "createApp",
+        "summary": "Create an app",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CreateRequest"}}}},
+        "responses": {
+          "201": {"description": "The created app", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/App"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/apps/{app}": {
+      "parameters": [{"$ref": "#/components/parameters/app"}],
+      "get": {
+        "operationId": "reportApp",
+        "summary": "Display an app report",
+        "responses": {
+          "200": {"description": "The app report", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AppReport"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "operationId": "destroyApp",
+        "summary": "Destroy an app",
+        "parameters": [
+          {"name": "confirm", "in": "query", "required": true, "description": "The app name, confirming the destroy", "schema": {"type": "string"}}
+        ],
+        "responses": {
+          "200": {"description": "The destroyed app", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/App"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/apps/{app}/clone": {
+      "parameters": [{"$ref": "#/components/parameters/app"}],
+      "post": {
+        "operationId": "cloneApp",
+        "summary": "Clone an app",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/CloneRequest"}}}},
+        "responses": {
+          "201": {"description": "The new app", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/App"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/apps/{app}/lock": {
+      "parameters": [{"$ref": "#/components/parameters/app"}],
+      "post": {
+        "operationId": "lockApp",
+        "summary": "Lock an app for deployment",
+        "responses": {
+          "200": {"description": "The app lock state", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AppLock"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      },
+      "delete": {
+        "operationId": "unlockApp",
+        "summary": "Unlock an app for deployment",
+        "responses": {
+          "200": {"description": "The app lock state", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/AppLock"}}}},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/apps/{app}/rename": {
+      "parameters": [{"$ref": "#/components/parameters/app"}],
+      "post": {
+        "operationId": "renameApp",
+        "summary": "Rename an app",
+        "requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/RenameRequest"}}}},
+        "responses": {
+          "200": {"description": "The renamed app", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/App"}}}},
+          "400": {"$ref": "#/components/responses/Error"},
+          "401": {"$ref": "#/components/responses/Error"},
+          "403": {"$ref": "#/components/responses/Error"},
+          "404": {"$ref": "#/components/responses/Error"},
+          "422": {"$ref": "#/components/responses/Error"}
+        }
+      }
+    },
+    "/v1/openapi.json": {
+      "get": {
+        "operationId": "openAPI",
+        "summary": "Display this document",
+        "security": [],
+        "responses": {"200": {"description": "The OpenAPI document"}}
+      }
+    }
+  }
+}
+`
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the api commands and triggers
+var Plugin = common.NewPlugin("api", "Manage apps over an http api")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "openapi",
+		Description: "Display the OpenAPI document for the api",
+		Run: func(ctx *common.Context) error {
+			return CommandOpenAPI()
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "serve",
+		Description: "Serve the app management api",
+		Flags: []common.Flag{
+			{Name: "listen", Placeholder: "<address>", Description: "--listen: address to serve the api on"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandServe(ctx.String("listen"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "set",
+		Description: "Set or clear an api property",
+		Args:        []common.Arg{{Name: "key"}, {Name: "value", Optional: true}},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Default: "true", Description: "--global: set a global property"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandSet(ctx.String("key"), ctx.String("value"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "token:generate",
+		Description: "Generate a new api token, replacing the existing token",
+		Run: func(ctx *common.Context) error {
+			return CommandTokenGenerate()
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+}
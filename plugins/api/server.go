@@ -0,0 +1,391 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// maxRequestBody is the largest request body accepted by the api
+const maxRequestBody = 1024 * 1024
+
+// errorResponse is the json body returned for failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// appRequest is the json body accepted by the rename and clone endpoints
+type appRequest struct {
+	Name           string `json:"name"`
+	NewName        string `json:"new_name"`
+	SkipDeploy     bool   `json:"skip_deploy"`
+	IgnoreExisting bool   `json:"ignore_existing"`
+	KeepAlias      bool   `json:"keep_alias"`
+}
+
+// route is a single api endpoint
+type route struct {
+	command string
+	app     string
+	handler func(r *http.Request, appName string) (invocation, error)
+}
+
+// invocation is the clair command serving an api request
+type invocation struct {
+	args     []string
+	apps     []string
+	env      []string
+	status   int
+	response func(stdout []byte) (interface{}, error)
+}
+
+// identityEnv lists the environment variables describing the caller of the
+// process serving the api, which commands run for a request must not inherit
+var identityEnv = map[string]bool{
+	"CLAIR_API_TOKEN":        true,
+	"CLAIR_APP_NAME":         true,
+	"CLAIR_AUDIT_PID":        true,
+	"CLAIR_AUDIT_SOURCE":     true,
+	"CLAIR_AUDIT_STARTED_AT": true,
+	"CLAIR_LOG_FORMAT":       true,
+	"CLAIR_QUIET_OUTPUT":     true,
+	"CLAIR_TOKEN_ID":         true,
+	"NAME":                   true,
+	"SSH_NAME":               true,
+	"SSH_ORIGINAL_COMMAND":   true,
+	"SSH_USER":               true,
+}
+
+// clairBin is the clair entrypoint api requests are run with
+var clairBin = "clair"
+
+// server serves the app management api. Each request runs its command in a
+// clair subprocess with the environment of the requesting token.
+type server struct{}
+
+func newServer() *server {
+	return &server{}
+}
+
+// ServeHTTP authenticates, routes and audits a single api request
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet && r.URL.Path == "/v1/openapi.json" {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, openAPIDocument)
+		return
+	}
+
+	start := time.Now()
+	entry := common.AuditEntry{
+		User:    "api",
+		Source:  "api",
+		Remote:  r.RemoteAddr,
+		Command: fmt.Sprintf("%s %s", r.Method, r.URL.Path),
+	}
+
+	rt, status := matchRoute(r.Method, r.URL.Path)
+	rt.app = common.ResolveAppName(rt.app)
+	if rt.command != "" {
+		entry.Command = rt.command
+		entry.App = rt.app
+	}
+
+	var body interface{}
+	var inv invocation
+	bearer := bearerToken(r)
+	token, err := authenticate(bearer)
+	if err != nil {
+		status = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Bearer realm="clair"`)
+	} else if rt.handler == nil {
+		err = errors.New(http.StatusText(status))
+	} else {
+		r.Body = http.MaxBytesReader(w, r.Body, maxRequestBody)
+		if inv, err = rt.handler(r, rt.app); err != nil {
+			status = http.StatusBadRequest
+		} else if err = authorizeInvocation(token, rt, inv); err != nil {
+			status = http.StatusForbidden
+		} else {
+			status, body, err = s.run(token, bearer, inv)
+		}
+	}
+
+	if token.Hash != "" {
+		entry.User = "token:" + token.ID
+		entry.KeyName = token.Name
+	}
+	entry.Decision = common.AuditDecisionAllow
+	if status == http.StatusUnauthorized || status == http.StatusForbidden {
+		entry.Decision = common.AuditDecisionDeny
+	}
+	if err != nil {
+		entry.ExitCode = 1
+		body = errorResponse{Error: err.Error()}
+	}
+	entry.Duration = time.Since(start)
+	if auditErr := common.AppendAuditEntry(common.AuditLogFile(), entry); auditErr != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record audit entry: %s", auditErr.Error()))
+	}
+
+	writeJSON(w, status, body)
+}
+
+// authorizeInvocation returns an error unless the token may run the command
+// against every app it names, including the apps named in the request body
+func authorizeInvocation(token common.APIToken, rt route, inv invocation) error {
+	appNames := inv.apps
+	if rt.app != "" {
+		appNames = append([]string{rt.app}, appNames...)
+	}
+	for _, appName := range appNames {
+		if err := token.Authorize(rt.command, appName); err != nil {
+			return err
+		}
+	}
+	return token.AuthorizeInvocation(inv.args)
+}
+
+// run runs the command for a request in a clair subprocess as the token
+// identity. The subprocess authorizes the token again and is not audited a
+// second time, as the server is recorded as the audited ancestor.
+func (s *server) run(token common.APIToken, bearer string, inv invocation) (int, interface{}, error) {
+	env := []string{}
+	for _, pair := range os.Environ() {
+		if !identityEnv[strings.SplitN(pair, "=", 2)[0]] {
+			env = append(env, pair)
+		}
+	}
+	env = append(env,
+		"SSH_USER=api",
+		"NAME="+token.Name,
+		fmt.Sprintf("CLAIR_AUDIT_PID=%d", os.Getpid()),
+		fmt.Sprintf("CLAIR_AUDIT_STARTED_AT=%d", time.Now().UnixNano()),
+	)
+	if token.Hash != "" {
+		env = append(env, "CLAIR_API_TOKEN="+bearer)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(clairBin, inv.args...)
+	cmd.Env = append(env, inv.env...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return commandStatus(err), nil, commandError(stderr.Bytes(), err)
+	}
+
+	body, err := inv.response(stdout.Bytes())
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return inv.status, body, nil
+}
+
+// matchRoute returns the route for a request, or the status to respond with
+// when no route matches
+func matchRoute(method string, path string) (route, int) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" || parts[1] != "apps" {
+		return route{}, http.StatusNotFound
+	}
+
+	routes := map[string]route{}
+	switch len(parts) {
+	case 2:
+		routes[http.MethodGet] = route{command: "apps:list", handler: handleList}
+		routes[http.MethodPost] = route{command: "apps:create", handler: handleCreate}
+	case 3:
+		routes[http.MethodGet] = route{command: "apps:report", app: parts[2], handler: handleReport}
+		routes[http.MethodDelete] = route{command: "apps:destroy", app: parts[2], handler: handleDestroy}
+	case 4:
+		switch parts[3] {
+		case "clone":
+			routes[http.MethodPost] = route{command: "apps:clone", app: parts[2], handler: handleClone}
+		case "lock":
+			routes[http.MethodPost] = route{command: "apps:lock", app: parts[2], handler: handleLock}
+			routes[http.MethodDelete] = route{command: "apps:unlock", app: parts[2], handler: handleUnlock}
+		case "rename":
+			routes[http.MethodPost] = route{command: "apps:rename", app: parts[2], handler: handleRename}
+		}
+	}
+
+	if len(routes) == 0 {
+		return route{}, http.StatusNotFound
+	}
+	rt, ok := routes[method]
+	if !ok {
+		return route{}, http.StatusMethodNotAllowed
+	}
+	return rt, http.StatusOK
+}
+
+func handleList(r *http.Request, appName string) (invocation, error) {
+	return invocation{
+		args:   []string{"apps:list"},
+		env:    []string{"CLAIR_QUIET_OUTPUT=1"},
+		status: http.StatusOK,
+		response: func(stdout []byte) (interface{}, error) {
+			return map[string][]string{"apps": strings.Fields(string(stdout))}, nil
+		},
+	}, nil
+}
+
+func handleCreate(r *http.Request, appName string) (invocation, error) {
+	var req appRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return invocation{}, err
+	}
+	if err := common.IsValidAppName(req.Name); err != nil {
+		return invocation{}, err
+	}
+	inv := appInvocation(http.StatusCreated, req.Name, "apps:create", req.Name)
+	inv.apps = []string{req.Name}
+	return inv, nil
+}
+
+func handleReport(r *http.Request, appName string) (invocation, error) {
+	return invocation{
+		args:   []string{"apps:report", "--format", "json", appName},
+		status: http.StatusOK,
+		response: func(stdout []byte) (interface{}, error) {
+			report := map[string]string{}
+			if err := json.Unmarshal(stdout, &report); err != nil {
+				return nil, fmt.Errorf("Unable to parse the report of %s: %s", appName, err.Error())
+			}
+			return map[string]interface{}{"app": appName, "report": report}, nil
+		},
+	}, nil
+}
+
+func handleDestroy(r *http.Request, appName string) (invocation, error) {
+	if r.URL.Query().Get("confirm") != appName {
+		return invocation{}, fmt.Errorf("Confirm the destroy by passing confirm=%s", appName)
+	}
+	return appInvocation(http.StatusOK, appName, "apps:destroy", "--force", appName), nil
+}
+
+func handleClone(r *http.Request, appName string) (invocation, error) {
+	var req appRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return invocation{}, err
+	}
+	if err := common.IsValidAppName(req.NewName); err != nil {
+		return invocation{}, err
+	}
+
+	args := []string{"apps:clone"}
+	if req.SkipDeploy {
+		args = append(args, "--skip-deploy")
+	}
+	if req.IgnoreExisting {
+		args = append(args, "--ignore-existing")
+	}
+	inv := appInvocation(http.StatusCreated, req.NewName, append(args, appName, req.NewName)...)
+	inv.apps = []string{req.NewName}
+	return inv, nil
+}
+
+func handleLock(r *http.Request, appName string) (invocation, error) {
+	inv := appInvocation(http.StatusOK, appName, "apps:lock", appName)
+	inv.response = func(stdout []byte) (interface{}, error) {
+		return map[string]interface{}{"app": appName, "locked": true}, nil
+	}
+	return inv, nil
+}
+
+func handleUnlock(r *http.Request, appName string) (invocation, error) {
+	inv := appInvocation(http.StatusOK, appName, "apps:unlock", appName)
+	inv.response = func(stdout []byte) (interface{}, error) {
+		return map[string]interface{}{"app": appName, "locked": false}, nil
+	}
+	return inv, nil
+}
+
+func handleRename(r *http.Request, appName string) (invocation, error) {
+	var req appRequest
+	if err := decodeRequest(r, &req); err != nil {
+		return invocation{}, err
+	}
+	if err := common.IsValidAppName(req.NewName); err != nil {
+		return invocation{}, err
+	}
+
+	args := []string{"apps:rename"}
+	if req.SkipDeploy {
+		args = append(args, "--skip-deploy")
+	}
+	if req.KeepAlias {
+		args = append(args, "--keep-alias")
+	}
+	inv := appInvocation(http.StatusOK, req.NewName, append(args, appName, req.NewName)...)
+	inv.apps = []string{req.NewName}
+	return inv, nil
+}
+
+// appInvocation returns an invocation responding with the app it acts on
+func appInvocation(status int, appName string, args ...string) invocation {
+	return invocation{
+		args:   args,
+		status: status,
+		response: func(stdout []byte) (interface{}, error) {
+			return map[string]string{"app": appName}, nil
+		},
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(header[7:])
+}
+
+// commandError returns the error a failed command reported on stderr
+func commandError(stderr []byte, err error) error {
+	lines := strings.Split(strings.TrimSpace(string(stderr)), "\n")
+	message := strings.TrimSpace(strings.TrimPrefix(lines[len(lines)-1], " !"))
+	if message == "" {
+		return fmt.Errorf("Command failed: %s", err.Error())
+	}
+	return errors.New(message)
+}
+
+// commandStatus returns the response status for a failed command, based on
+// the exit code commands use for apps that do not exist
+func commandStatus(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == (&common.AppDoesNotExist{}).ExitCode() {
+		return http.StatusNotFound
+	}
+	return http.StatusUnprocessableEntity
+}
+
+func decodeRequest(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("Invalid request body: %s", err.Error())
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to write api response: %s", err.Error()))
+	}
+}
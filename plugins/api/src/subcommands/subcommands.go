@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/api"
+)
+
+func main() {
+	api.Plugin.RunSubcommand()
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandOpenAPI displays the OpenAPI document for the api
+func CommandOpenAPI() error {
+	fmt.Print(openAPIDocument)
+	return nil
+}
+
+// CommandServe serves the app management api
+func CommandServe(listen string) error {
+	if listen == "" {
+		listen = getListenAddress()
+	}
+	if _, _, err := net.SplitHostPort(listen); err != nil {
+		return fmt.Errorf("Invalid listen address %s: %s", listen, err.Error())
+	}
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           newServer(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	common.LogInfo1(fmt.Sprintf("Serving api on http://%s/v1", listen))
+	return server.ListenAndServe()
+}
+
+// CommandSet sets or clears a global api property
+func CommandSet(property string, value string) error {
+	if property == "listen" && value != "" {
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			return fmt.Errorf("Invalid listen address %s: %s", value, err.Error())
+		}
+	}
+
+	common.CommandPropertySet("api", "--global", property, value, DefaultProperties, GlobalProperties)
+	return nil
+}
+
+// CommandTokenGenerate generates a new api token, replacing any existing token
+func CommandTokenGenerate() error {
+	token, err := generateToken()
+	if err != nil {
+		return fmt.Errorf("Unable to generate api token: %s", err.Error())
+	}
+
+	if err := common.PropertyWrite("api", "--global", "token-hash", hashToken(token)); err != nil {
+		return fmt.Errorf("Unable to store api token: %s", err.Error())
+	}
+
+	common.LogInfo1Quiet("Generated api token, it will not be shown again")
+	common.Log(token)
+	return nil
+}
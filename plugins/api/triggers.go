@@ -0,0 +1,16 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// TriggerInstall runs the install step for the api plugin
+func TriggerInstall() error {
+	if err := common.PropertySetup("api"); err != nil {
+		return fmt.Errorf("Unable to install the api plugin: %s", err.Error())
+	}
+
+	return nil
+}
@@ -2,12 +2,32 @@ package apps
 
 var (
 	DefaultProperties = map[string]string{
-		"deploy-source":          "",
-		"deploy-source-metadata": "",
+		"app-name-policy":         "",
+		"app-name-prefixes":       "",
+		"deploy-source":           "",
+		"deploy-source-metadata":  "",
+		"image-pin-id":            "",
+		"image-retention-count":   "",
+		"image-retention-max-age": "",
+		"image-signature-dir":     "",
+		"image-verify-key":        "",
+		"max-apps-per-team":       "",
+		"max-apps-per-user":       "",
+		"reserved-app-names":      "",
 	}
 
 	GlobalProperties = map[string]bool{
-		"deploy-source":          true,
-		"deploy-source-metadata": true,
+		"app-name-policy":         true,
+		"app-name-prefixes":       true,
+		"deploy-source":           true,
+		"deploy-source-metadata":  true,
+		"image-pin-id":            true,
+		"image-retention-count":   true,
+		"image-retention-max-age": true,
+		"image-signature-dir":     true,
+		"image-verify-key":        true,
+		"max-apps-per-team":       true,
+		"max-apps-per-user":       true,
+		"reserved-app-names":      true,
 	}
 )
@@ -4,13 +4,38 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/vinybergamo/clair/plugins/common"
 )
 
+type diskUsage struct {
+	App             string `json:"app"`
+	Images          int    `json:"images"`
+	Size            int64  `json:"size"`
+	InUseSize       int64  `json:"in_use_size"`
+	ReclaimableSize int64  `json:"reclaimable_size"`
+}
+
+func newDiskUsage(appName string, images []common.ImageInfo) diskUsage {
+	usage := diskUsage{App: appName, Images: len(images)}
+	for _, image := range images {
+		usage.Size += image.Size
+		if image.InUse {
+			usage.InUseSize += image.Size
+		} else {
+			usage.ReclaimableSize += image.Size
+		}
+	}
+	return usage
+}
+
 func appExists(appName string) error {
 	return common.VerifyAppName(appName)
 }
@@ -21,7 +46,13 @@ func appIsLocked(appName string) bool {
 	return !os.IsNotExist(err)
 }
 
-func createApp(appName string) error {
+func createApp(stdout io.Writer, appName string) error {
+	return createAppAs(stdout, appName, appCreator(), true)
+}
+
+// createAppAs creates an app on behalf of the creator, enforcing the app
+// creation policy
+func createAppAs(stdout io.Writer, appName string, creator string, checkQuota bool) error {
 	if err := common.IsValidAppName(appName); err != nil {
 		return err
 	}
@@ -30,28 +61,43 @@ func createApp(appName string) error {
 		return errors.New("Name is already taken")
 	}
 
-	common.LogInfo1Quiet(fmt.Sprintf("Creating %s...", appName))
+	if target := common.ResolveAppName(appName); target != appName {
+		return fmt.Errorf("Name is already taken by an alias of %s", target)
+	}
+
+	if err := checkCreationPolicy(appName, creator, checkQuota); err != nil {
+		return err
+	}
+
+	common.LogInfo1QuietTo(stdout, fmt.Sprintf("Creating %s...", appName))
 	os.MkdirAll(common.AppRoot(appName), 0755)
 
 	if err := common.PropertyWrite("apps", appName, "created-at", fmt.Sprintf("%d", time.Now().Unix())); err != nil {
 		return err
 	}
 
+	if creator != "" {
+		if err := common.PropertyWrite("apps", appName, "created-by", creator); err != nil {
+			return err
+		}
+	}
+
 	if err := common.PluginTrigger("post-create", []string{appName}...); err != nil {
 		return err
 	}
 
+	common.EmitEvent(common.Event{Type: common.EventAppCreated, App: appName, Trigger: "post-create", Args: []string{appName}})
 	return nil
 }
 
-func destroyApp(appName string) error {
+func destroyApp(stdout io.Writer, appName string) error {
 	if os.Getenv("CLAIR_APPS_FORCE_DELETE") != "1" {
 		if err := common.AskForDestructiveConfirmation(appName, "app"); err != nil {
 			return err
 		}
 	}
 
-	common.LogInfo1(fmt.Sprintf("Destroying %s (including all add-ons)", appName))
+	common.LogInfo1To(stdout, fmt.Sprintf("Destroying %s (including all add-ons)", appName))
 
 	imageTag, _ := common.GetRunningImageTag(appName, "")
 	if err := common.PluginTrigger("pre-delete", []string{appName, imageTag}...); err != nil {
@@ -71,9 +117,10 @@ func destroyApp(appName string) error {
 	}
 
 	forceCleanup := true
-	common.DockerCleanup(appName, forceCleanup)
+	dryRun := false
+	common.DockerCleanup(appName, forceCleanup, dryRun)
 
-	common.LogInfo1("Retiring old containers and images")
+	common.LogInfo1To(stdout, "Retiring old containers and images")
 	if err := common.PluginTrigger("scheduler-retire", []string{scheduler, appName}...); err != nil {
 		return err
 	}
@@ -86,57 +133,33 @@ func destroyApp(appName string) error {
 		common.LogWarn(err.Error())
 	}
 
+	common.EmitEvent(common.Event{Type: common.EventAppDestroyed, App: appName, Trigger: "post-delete", Args: []string{appName, imageTag}})
 	return nil
 }
 
-func listImagesByAppLabel(appName string) ([]string, error) {
-	command := []string{
-		common.DockerBin(),
-		"image",
-		"list",
-		"--quiet",
-		"--filter",
-		fmt.Sprintf("label=com.clair.app-name=%v", appName),
-	}
-
-	var stderr bytes.Buffer
-	listCmd := common.NewShellCmd(strings.Join(command, " "))
-	listCmd.ShowOutput = false
-	listCmd.Command.Stderr = &stderr
-	b, err := listCmd.Output()
-
-	if err != nil {
-		return []string{}, errors.New(strings.TrimSpace(stderr.String()))
-	}
-
-	output := strings.Split(strings.TrimSpace(string(b[:])), "\n")
-	return output, nil
-}
-
-func listImagesByImageRepo(imageRepo string) ([]string, error) {
-	command := []string{
-		common.DockerBin(),
-		"image",
-		"list",
-		"--quiet",
-		imageRepo,
+// legacyAppNameMapping pairs each app whose name is not a valid DNS label with
+// a generated name that is, sorted by the current name
+func legacyAppNameMapping(apps []string) [][2]string {
+	sort.Strings(apps)
+	taken := map[string]bool{}
+	for _, appName := range apps {
+		taken[appName] = true
 	}
 
-	var stderr bytes.Buffer
-	listCmd := common.NewShellCmd(strings.Join(command, " "))
-	listCmd.ShowOutput = false
-	listCmd.Command.Stderr = &stderr
-	b, err := listCmd.Output()
+	mapping := [][2]string{}
+	for _, appName := range apps {
+		if common.IsDNSLabel(appName) == nil {
+			continue
+		}
 
-	if err != nil {
-		return []string{}, errors.New(strings.TrimSpace(stderr.String()))
+		newAppName := common.GenerateDNSAppName(appName, taken)
+		taken[newAppName] = true
+		mapping = append(mapping, [2]string{appName, newAppName})
 	}
-
-	output := strings.Split(strings.TrimSpace(string(b[:])), "\n")
-	return output, nil
+	return mapping
 }
 
-func maybeCreateApp(appName string) error {
+func maybeCreateApp(stdout io.Writer, appName string) error {
 	if err := appExists(appName); err == nil {
 		return nil
 	}
@@ -148,7 +171,47 @@ func maybeCreateApp(appName string) error {
 		return fmt.Errorf("Re-enable app auto-creation or create an app with 'clair apps:create %s'", appName)
 	}
 
-	return common.SuppressOutput(func() error {
-		return createApp(appName)
-	})
+	var output bytes.Buffer
+	if err := createApp(&output, appName); err != nil {
+		stdout.Write(output.Bytes())
+		return err
+	}
+	return nil
+}
+
+func validateProperty(property string, value string) error {
+	switch property {
+	case "image-pin-id":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("Invalid %s %s: must be true or false", property, value)
+		}
+	case "image-verify-key":
+		if !common.FileExists(value) {
+			return fmt.Errorf("Invalid %s %s: file does not exist", property, value)
+		}
+	case "image-retention-count":
+		if i, err := strconv.Atoi(value); err != nil || i < 1 {
+			return fmt.Errorf("Invalid %s %s: must be a positive integer", property, value)
+		}
+	case "app-name-policy":
+		if value != common.AppNamePolicyDNS && value != common.AppNamePolicyLegacy {
+			return fmt.Errorf("Invalid %s %s: must be %s or %s", property, value, common.AppNamePolicyDNS, common.AppNamePolicyLegacy)
+		}
+	case "max-apps-per-team", "max-apps-per-user":
+		if i, err := strconv.Atoi(value); err != nil || i < 0 {
+			return fmt.Errorf("Invalid %s %s: must be a non-negative integer, 0 for no limit", property, value)
+		}
+	case "reserved-app-names":
+		for _, pattern := range splitPolicyList(value) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Invalid %s pattern %s", property, pattern)
+			}
+		}
+	case "image-retention-max-age":
+		if _, err := common.ParseRetentionAge(value); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,337 @@
+package apps
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the apps commands and triggers
+var Plugin = common.NewPlugin("apps", "Manage apps")
+
+var formatFlag = common.Flag{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"}
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "alias:add",
+		Description: "Add an alias resolving to an app",
+		Args:        []common.Arg{{Name: "alias"}, {Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandAliasAdd(ctx.String("alias"), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "alias:list",
+		Description: "List app aliases",
+		Args:        []common.Arg{{Name: "app", Optional: true, Complete: common.CompleteApp}},
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandAliasList(ctx.String("app"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "alias:remove",
+		Description: "Remove an app alias",
+		Args:        []common.Arg{{Name: "alias"}},
+		Run: func(ctx *common.Context) error {
+			return CommandAliasRemove(ctx.String("alias"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "cleanup",
+		Description: "Remove unused containers and images not kept by the image retention policy",
+		Global:      true,
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Description: "--global: cleanup all apps"},
+			{Name: "dry-run", Kind: common.KindBool, Description: "--dry-run: list what would be removed without removing anything"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandCleanup(ctx.String("app"), ctx.Bool("dry-run"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "clone",
+		Description: "Clones an app",
+		Args:        []common.Arg{{Name: "old-app", Complete: common.CompleteApp}, {Name: "new-app", App: true}},
+		Flags: []common.Flag{
+			{Name: "skip-deploy", Kind: common.KindBool, Description: "--skip-deploy: skip deploy of the new app"},
+			{Name: "ignore-existing", Kind: common.KindBool, Description: "--ignore-existing: exit 0 if new app already exists"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandClone(ctx.String("old-app"), ctx.String("new-app"), ctx.Bool("skip-deploy"), ctx.Bool("ignore-existing"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "create",
+		Description: "Create a new app",
+		Args:        []common.Arg{{Name: "app", App: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandCreate(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "destroy",
+		Description: "Permanently destroy an app",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "force", Kind: common.KindBool, Description: "--force: force destroy without confirmation"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandDestroy(ctx.String("app"), ctx.Bool("force"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "disk-usage",
+		Description: "Display image disk usage for an app or all apps",
+		Args:        []common.Arg{{Name: "app", Optional: true, Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "all", Kind: common.KindBool, Description: "--all: display disk usage for all apps"},
+			formatFlag,
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandDiskUsage(ctx.String("app"), ctx.Bool("all"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "exists",
+		Description: "Checks if an app exists",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandExists(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "image:export",
+		Description: "Export an app image to a tar archive",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "tag", Optional: true}},
+		Flags: []common.Flag{
+			{Name: "output", Shorthand: "o", Placeholder: "<file>", Required: true, Description: "--output: file to write the image archive to, or - for stdout"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandImageExport(ctx.String("app"), ctx.String("tag"), ctx.String("output"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "image:import",
+		Description: "Import an app image from a tar archive",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "file"}},
+		Flags: []common.Flag{
+			{Name: "tag", Default: "latest", Description: "--tag: tag to give the imported image"},
+			{Name: "deploy", Kind: common.KindBool, Description: "--deploy: release and deploy the imported image"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandImageImport(ctx.String("app"), ctx.String("file"), ctx.String("tag"), ctx.Bool("deploy"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "images",
+		Description: "List the images held by an app",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandImages(ctx.String("app"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "list",
+		Description: "List your apps",
+		Run: func(ctx *common.Context) error {
+			return CommandList()
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "lock",
+		Description: "Locks an app for deployment",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandLock(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "locked",
+		Description: "Checks if an app is locked for deployment",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandLocked(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "migrate-names",
+		Description: "Rename apps whose names are not valid DNS labels",
+		Flags: []common.Flag{
+			{Name: "dry-run", Kind: common.KindBool, Description: "--dry-run: show the generated names without renaming any app"},
+			{Name: "skip-deploy", Kind: common.KindBool, Description: "--skip-deploy: skip deploy of the renamed apps"},
+			{Name: "keep-alias", Kind: common.KindBool, Description: "--keep-alias: keep the old app names as aliases of the renamed apps"},
+			formatFlag,
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandMigrateNames(ctx.Bool("dry-run"), ctx.Bool("skip-deploy"), ctx.Bool("keep-alias"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "releases",
+		Description: "List the releases of an app",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandReleases(ctx.String("app"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "rename",
+		Description: "Rename an app",
+		Args:        []common.Arg{{Name: "old-app", Complete: common.CompleteApp}, {Name: "new-app", App: true}},
+		Flags: []common.Flag{
+			{Name: "skip-deploy", Kind: common.KindBool, Description: "--skip-deploy: skip deploy of the new app"},
+			{Name: "keep-alias", Kind: common.KindBool, Description: "--keep-alias: keep the old app name as an alias of the new app"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandRename(ctx.String("old-app"), ctx.String("new-app"), ctx.Bool("skip-deploy"), ctx.Bool("keep-alias"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "report",
+		Description: "Display report about an app",
+		InfoFlag:    true,
+		Args:        []common.Arg{{Name: "app", Optional: true, Complete: common.CompleteApp}},
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandReport(ctx.String("app"), ctx.String("format"), ctx.InfoFlag())
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "rollback",
+		Description: "Deploy the image of a previous release without rebuilding",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "release", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandRollback(ctx.String("app"), ctx.String("release"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "set",
+		Description: "Set or clear an apps property for an app",
+		Global:      true,
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "key"}, {Name: "value", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandSet(ctx.String("app"), ctx.String("key"), ctx.String("value"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "unlock",
+		Description: "Unlocks an app for deployment",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandUnlock(ctx.String("app"))
+		},
+	})
+
+	appArgs := []common.TriggerArg{{Name: "app"}}
+	renameArgs := []common.TriggerArg{{Name: "old-app"}, {Name: "new-app"}}
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "app-create",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerAppCreate(ctx.Stdout(), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "app-destroy",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerAppDestroy(ctx.Stdout(), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "app-exists",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerAppExists(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "app-maybe-create",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerAppMaybeCreate(ctx.Stdout(), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "core-post-deploy",
+		Args: []common.TriggerArg{{Name: "app"}, {Name: "internal-port", Optional: true}, {Name: "internal-ip", Optional: true}, {Name: "image-tag", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return TriggerCorePostDeploy(ctx.Stdout(), ctx.String("app"), ctx.String("image-tag"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "deploy-source-set",
+		Args: []common.TriggerArg{{Name: "app"}, {Name: "source-type"}, {Name: "source-metadata", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return TriggerDeploySourceSet(ctx.String("app"), ctx.String("source-type"), ctx.String("source-metadata"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-clone-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppCloneSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-rename-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppRenameSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-delete",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostDelete(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "report",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return ReportSingleApp(ctx.Stdout(), ctx.String("app"), "", "")
+		},
+	})
+}
@@ -0,0 +1,152 @@
+package apps
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// policyProperties are the global properties controlling app creation
+var policyProperties = map[string]bool{
+	"app-name-policy":    true,
+	"app-name-prefixes":  true,
+	"max-apps-per-team":  true,
+	"max-apps-per-user":  true,
+	"reserved-app-names": true,
+}
+
+// appCreator returns the name recorded as the creator of new apps: the ssh key
+// name for ssh sessions and the local user or token otherwise
+func appCreator() string {
+	sshUser := os.Getenv("SSH_USER")
+	if sshUser == common.GetenvWithDefault("CLAIR_SYSTEM_USER", "clair") {
+		if sshName := os.Getenv("SSH_NAME"); sshName != "" {
+			return sshName
+		}
+	}
+	if sshUser == "" {
+		sshUser = os.Getenv("USER")
+	}
+	return sshUser
+}
+
+// checkCreationPolicy returns an error if the creator may not create an app
+// with the given name. Reserved names are checked along with the app name
+// itself. Quotas are only enforced when checkQuota is set, as a rename
+// replaces an existing app. Root is exempt from the policy.
+func checkCreationPolicy(appName string, creator string, checkQuota bool) error {
+	if creator == "root" {
+		return nil
+	}
+
+	groups := common.UserGroups(creator)
+	if prefixes := allowedAppNamePrefixes(creator, groups); len(prefixes) > 0 {
+		allowed := false
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(appName, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("App name %s must start with one of: %s", appName, strings.Join(prefixes, ", "))
+		}
+	}
+
+	if !checkQuota {
+		return nil
+	}
+
+	creators := appCreators()
+	if limit := policyLimit("max-apps-per-user"); limit > 0 {
+		count := 0
+		for _, createdBy := range creators {
+			if createdBy == creator {
+				count++
+			}
+		}
+		if count >= limit {
+			return fmt.Errorf("%s has reached the limit of %d apps", creator, limit)
+		}
+	}
+
+	if limit := policyLimit("max-apps-per-team"); limit > 0 && len(groups) > 0 {
+		teams, err := common.GetGroups()
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			count := 0
+			for _, createdBy := range creators {
+				for _, member := range teams[group] {
+					if createdBy == member {
+						count++
+						break
+					}
+				}
+			}
+			if count >= limit {
+				return fmt.Errorf("Team %s has reached the limit of %d apps", group, limit)
+			}
+		}
+	}
+
+	return nil
+}
+
+// allowedAppNamePrefixes returns the prefixes new app names must start with,
+// expanding {user} to the creator and {team} to each of their teams
+func allowedAppNamePrefixes(creator string, groups []string) []string {
+	prefixes := []string{}
+	for _, prefix := range splitPolicyList(common.PropertyGet("apps", "--global", "app-name-prefixes")) {
+		prefix = strings.ReplaceAll(prefix, "{user}", creator)
+		if !strings.Contains(prefix, "{team}") {
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+		for _, group := range groups {
+			prefixes = append(prefixes, strings.ReplaceAll(prefix, "{team}", group))
+		}
+	}
+	return prefixes
+}
+
+// appCreators maps every app to the user that created it
+func appCreators() map[string]string {
+	creators := map[string]string{}
+	apps, err := common.UnfilteredClairApps()
+	if err != nil {
+		return creators
+	}
+
+	for _, appName := range apps {
+		if createdBy := common.PropertyGet("apps", appName, "created-by"); createdBy != "" {
+			creators[appName] = createdBy
+		}
+	}
+	return creators
+}
+
+// policyLimit returns a global app limit. A limit of 0, the default when the
+// property is unset, places no limit on app creation.
+func policyLimit(property string) int {
+	limit, err := strconv.Atoi(common.PropertyGet("apps", "--global", property))
+	if err != nil {
+		return 0
+	}
+	return limit
+}
+
+func splitPolicyList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
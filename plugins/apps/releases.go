@@ -0,0 +1,204 @@
+package apps
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Release is a single successful deploy of an app
+type Release struct {
+	Version              int       `json:"version"`
+	ImageID              string    `json:"image_id"`
+	ImageDigest          string    `json:"image_digest"`
+	ImageTag             string    `json:"image_tag"`
+	DeploySource         string    `json:"deploy_source"`
+	DeploySourceMetadata string    `json:"deploy_source_metadata"`
+	DeployedBy           string    `json:"deployed_by"`
+	CreatedAt            time.Time `json:"created_at"`
+}
+
+// ReleaseTag returns the image tag retaining the release image
+func (r Release) ReleaseTag() string {
+	return fmt.Sprintf("release-%d", r.Version)
+}
+
+type releaseImageInspectResult struct {
+	ID          string   `json:"Id"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// getReleases returns all recorded releases for an app, oldest first
+func getReleases(appName string) ([]Release, error) {
+	releases := []Release{}
+	lines, err := common.PropertyListGet("apps", appName, "releases")
+	if err != nil {
+		return releases, err
+	}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var release Release
+		if err := json.Unmarshal([]byte(line), &release); err != nil {
+			common.LogWarn(fmt.Sprintf("Skipping invalid release entry for %s: %s", appName, err.Error()))
+			continue
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+// getRelease returns a release by version, or the release before the current one when empty
+func getRelease(appName string, version string) (Release, error) {
+	releases, err := getReleases(appName)
+	if err != nil {
+		return Release{}, err
+	}
+
+	if version == "" {
+		if len(releases) < 2 {
+			return Release{}, fmt.Errorf("No previous release found for %s", appName)
+		}
+		return releases[len(releases)-2], nil
+	}
+
+	v, err := strconv.Atoi(strings.TrimPrefix(version, "v"))
+	if err != nil {
+		return Release{}, fmt.Errorf("Invalid release %s: must be a release version", version)
+	}
+
+	for _, release := range releases {
+		if release.Version == v {
+			return release, nil
+		}
+	}
+
+	return Release{}, fmt.Errorf("Release %s not found for %s", version, appName)
+}
+
+// recordRelease stores a release for the image deployed to an app and tags the
+// image so it is retained for rollbacks
+func recordRelease(appName string, imageTag string) (Release, error) {
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+
+	image := fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), imageTag)
+	runtime := common.GetContainerRuntime()
+	b, err := runtime.ImageInspect(image)
+	if err != nil {
+		return Release{}, fmt.Errorf("Unable to inspect released image %s: %s", image, err.Error())
+	}
+
+	var result releaseImageInspectResult
+	if err := json.Unmarshal(b, &result); err != nil {
+		return Release{}, fmt.Errorf("Unable to parse image inspect output: %v", err)
+	}
+
+	releases, err := getReleases(appName)
+	if err != nil {
+		return Release{}, err
+	}
+
+	version := 1
+	if len(releases) > 0 {
+		version = releases[len(releases)-1].Version + 1
+	}
+
+	release := Release{
+		Version:              version,
+		ImageID:              result.ID,
+		ImageTag:             imageTag,
+		DeploySource:         common.PropertyGet("apps", appName, "deploy-source"),
+		DeploySourceMetadata: common.PropertyGet("apps", appName, "deploy-source-metadata"),
+		DeployedBy:           deployedBy(),
+		CreatedAt:            time.Now().UTC(),
+	}
+	if len(result.RepoDigests) > 0 {
+		release.ImageDigest = result.RepoDigests[0]
+	}
+
+	if err := runtime.ImageTag(result.ID, fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), release.ReleaseTag())); err != nil {
+		return release, fmt.Errorf("Unable to tag release image: %s", err.Error())
+	}
+
+	policy, err := common.GetImageRetentionPolicy(appName)
+	if err != nil {
+		return release, err
+	}
+
+	lines := []string{}
+	for _, r := range retainedReleases(append(releases, release), policy, time.Now()) {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return release, err
+		}
+		lines = append(lines, string(line))
+	}
+
+	return release, common.PropertyListWrite("apps", appName, "releases", lines)
+}
+
+// retainedReleases returns the releases whose images the retention policy
+// keeps: the current release and the previous ones retained by count or age
+func retainedReleases(releases []Release, policy common.ImageRetentionPolicy, now time.Time) []Release {
+	if len(releases) == 0 {
+		return releases
+	}
+
+	retained := []Release{releases[len(releases)-1]}
+	position := 0
+	for i := len(releases) - 2; i >= 0; i-- {
+		if policy.Retains(position, common.ImageInfo{Created: releases[i].CreatedAt}, now) {
+			retained = append([]Release{releases[i]}, retained...)
+		}
+		position++
+	}
+	return retained
+}
+
+// retagReleaseImages tags the release images of an app for the releases of
+// another, so that renamed and cloned apps can still be rolled back
+func retagReleaseImages(oldAppName string, newAppName string) error {
+	releases, err := getReleases(newAppName)
+	if err != nil {
+		return err
+	}
+
+	runtime := common.GetContainerRuntime()
+	for _, release := range releases {
+		oldImage := fmt.Sprintf("%s:%s", common.GetAppImageRepo(oldAppName), release.ReleaseTag())
+		if !common.VerifyImage(oldImage) {
+			continue
+		}
+
+		newImage := fmt.Sprintf("%s:%s", common.GetAppImageRepo(newAppName), release.ReleaseTag())
+		if err := runtime.ImageTag(oldImage, newImage); err != nil {
+			return fmt.Errorf("Unable to tag release image %s: %s", newImage, err.Error())
+		}
+	}
+	return nil
+}
+
+func deployedBy() string {
+	sshUser := os.Getenv("SSH_USER")
+	if sshUser == "" {
+		sshUser = os.Getenv("USER")
+	}
+
+	sshName := os.Getenv("SSH_NAME")
+	if sshName == "" || sshName == "default" {
+		return sshUser
+	}
+
+	return fmt.Sprintf("%s (%s)", sshUser, sshName)
+}
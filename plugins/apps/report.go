@@ -2,24 +2,20 @@ package apps
 
 import (
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/vinybergamo/clair/plugins/common"
 )
 
-func ReportSingleApp(appName string, format string, infoFlag string) error {
+func ReportSingleApp(stdout io.Writer, appName string, format string, infoFlag string) error {
 	if err := common.VerifyAppName(appName); err != nil {
 		return err
 	}
 
-	flags := map[string]common.ReportFunc{
-		"--app-created-at":             reportCreatedAt,
-		"--app-deploy-source":          reportDeploySource,
-		"--app-deploy-source-metadata": reportDeploySourceMetadata,
-		"--app-dir":                    reportDir,
-		"--app-locked":                 reportLocked,
-	}
-
+	flags := reportFlags()
 	flagKeys := []string{}
 	for flagKey := range flags {
 		flagKeys = append(flagKeys, flagKey)
@@ -28,7 +24,46 @@ func ReportSingleApp(appName string, format string, infoFlag string) error {
 	trimPrefix := false
 	uppercaseFirstCharacter := true
 	infoFlags := common.CollectReport(appName, infoFlag, flags)
-	return common.ReportSingleApp("app", appName, infoFlag, infoFlags, flagKeys, format, trimPrefix, uppercaseFirstCharacter)
+	return common.ReportSingleApp(stdout, "app", appName, infoFlag, infoFlags, flagKeys, format, trimPrefix, uppercaseFirstCharacter)
+}
+
+// CollectAppReport returns the app report keyed by flag name without the leading dashes
+func CollectAppReport(appName string) (map[string]string, error) {
+	if err := common.VerifyAppName(appName); err != nil {
+		return map[string]string{}, err
+	}
+
+	report := map[string]string{}
+	for key, value := range common.CollectReport(appName, "", reportFlags()) {
+		report[strings.TrimPrefix(key, "--")] = value
+	}
+	return report, nil
+}
+
+func reportFlags() map[string]common.ReportFunc {
+	return map[string]common.ReportFunc{
+		"--app-aliases":                 reportAliases,
+		"--app-created-at":              reportCreatedAt,
+		"--app-created-by":              reportCreatedBy,
+		"--app-deployed":                reportDeployed,
+		"--app-deploy-source":           reportDeploySource,
+		"--app-deploy-source-metadata":  reportDeploySourceMetadata,
+		"--app-dir":                     reportDir,
+		"--app-image-pin-id":            reportImagePinID,
+		"--app-image-pinned-id":         reportImagePinnedID,
+		"--app-image-retention-count":   reportImageRetentionCount,
+		"--app-image-retention-max-age": reportImageRetentionMaxAge,
+		"--app-image-signature-dir":     reportImageSignatureDir,
+		"--app-image-verification":      reportImageVerification,
+		"--app-image-verified-at":       reportImageVerifiedAt,
+		"--app-image-verified-id":       reportImageVerifiedID,
+		"--app-image-verify-key":        reportImageVerifyKey,
+		"--app-locked":                  reportLocked,
+	}
+}
+
+func reportAliases(appName string) string {
+	return strings.Join(common.AppAliasesFor(appName), ",")
 }
 
 func reportCreatedAt(appName string) string {
@@ -39,6 +74,14 @@ func reportCreatedAt(appName string) string {
 	return fmt.Sprint(strings.Join(createdAt, ","))
 }
 
+func reportCreatedBy(appName string) string {
+	return common.PropertyGet("apps", appName, "created-by")
+}
+
+func reportDeployed(appName string) string {
+	return strconv.FormatBool(common.IsDeployed(appName))
+}
+
 func reportDeploySource(appName string) string {
 	return common.PropertyGet("apps", appName, "deploy-source")
 }
@@ -51,6 +94,54 @@ func reportDir(appName string) string {
 	return common.AppRoot(appName)
 }
 
+func reportImagePinID(appName string) string {
+	return common.PropertyGet("apps", appName, "image-pin-id")
+}
+
+func reportImagePinnedID(appName string) string {
+	return common.PropertyGet("apps", appName, "image-pinned-id")
+}
+
+func reportImageRetentionCount(appName string) string {
+	return common.PropertyGet("apps", appName, "image-retention-count")
+}
+
+func reportImageRetentionMaxAge(appName string) string {
+	return common.PropertyGet("apps", appName, "image-retention-max-age")
+}
+
+func reportImageSignatureDir(appName string) string {
+	return common.PropertyGet("apps", appName, "image-signature-dir")
+}
+
+func reportImageVerification(appName string) string {
+	result, ok := common.GetImageVerificationResult(appName)
+	if !ok {
+		return ""
+	}
+	if result.Error != "" {
+		return fmt.Sprintf("%s: %s", result.Status, result.Error)
+	}
+	return result.Status
+}
+
+func reportImageVerifiedAt(appName string) string {
+	result, ok := common.GetImageVerificationResult(appName)
+	if !ok {
+		return ""
+	}
+	return result.VerifiedAt.Format(time.RFC3339)
+}
+
+func reportImageVerifiedID(appName string) string {
+	result, _ := common.GetImageVerificationResult(appName)
+	return result.ImageID
+}
+
+func reportImageVerifyKey(appName string) string {
+	return common.PropertyGet("apps", appName, "image-verify-key")
+}
+
 func reportLocked(appName string) string {
 	locked := "false"
 	if appIsLocked(appName) {
@@ -1,13 +1,118 @@
 package apps
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/vinybergamo/clair/plugins/common"
 )
 
+// CommandAliasAdd adds an alias resolving to an app
+func CommandAliasAdd(alias string, appName string) error {
+	if alias == "" {
+		return errors.New("Please specify an alias")
+	}
+
+	appName = common.ResolveAppName(appName)
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	if err := common.AddAppAlias(alias, appName); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Added alias %s for %s", alias, appName))
+	return nil
+}
+
+// CommandAliasList displays the app aliases, optionally for a single app
+func CommandAliasList(appName string, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	aliases, err := common.GetAppAliases()
+	if err != nil {
+		return err
+	}
+	if appName != "" {
+		appName = common.ResolveAppName(appName)
+		if err := common.VerifyAppName(appName); err != nil {
+			return err
+		}
+
+		for alias, target := range aliases {
+			if target != appName {
+				delete(aliases, alias)
+			}
+		}
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(aliases)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(aliases) == 0 {
+		common.LogInfo1Quiet("No app aliases found")
+		return nil
+	}
+
+	names := []string{}
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	rows := [][]string{{"Alias", "App"}}
+	for _, alias := range names {
+		rows = append(rows, []string{alias, aliases[alias]})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandAliasRemove removes an app alias
+func CommandAliasRemove(alias string) error {
+	if alias == "" {
+		return errors.New("Please specify an alias")
+	}
+
+	if err := common.RemoveAppAlias(alias); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Removed alias %s", alias))
+	return nil
+}
+
+// CommandCleanup removes unused containers and images for an app or globally
+func CommandCleanup(appName string, dryRun bool) error {
+	if appName == "" {
+		return errors.New("Please specify an app to run the command on")
+	}
+
+	if appName != "--global" {
+		if err := common.VerifyAppName(appName); err != nil {
+			return err
+		}
+	}
+
+	forceCleanup := false
+	return common.DockerCleanup(appName, forceCleanup, dryRun)
+}
+
 func CommandClone(oldAppName string, newAppName string, skipDeploy bool, ignoreExisting bool) error {
 	if oldAppName == "" {
 		return errors.New("Please specify an app to run the command on")
@@ -35,7 +140,7 @@ func CommandClone(oldAppName string, newAppName string, skipDeploy bool, ignoreE
 	}
 
 	common.LogInfo1Quiet(fmt.Sprintf("Cloning %s to %s", oldAppName, newAppName))
-	if err := createApp(newAppName); err != nil {
+	if err := createApp(os.Stdout, newAppName); err != nil {
 		return err
 	}
 
@@ -55,6 +160,7 @@ func CommandClone(oldAppName string, newAppName string, skipDeploy bool, ignoreE
 		return err
 	}
 
+	common.EmitEvent(common.Event{Type: common.EventAppCloned, App: newAppName, Trigger: "post-app-clone", Args: []string{oldAppName, newAppName}})
 	return nil
 }
 
@@ -64,7 +170,7 @@ func CommandCreate(appName string) error {
 		return err
 	}
 
-	return createApp(appName)
+	return createApp(os.Stdout, appName)
 }
 
 // CommandDestroy destroys an app
@@ -77,7 +183,56 @@ func CommandDestroy(appName string, force bool) error {
 		os.Setenv("CLAIR_APPS_FORCE_DELETE", "1")
 	}
 
-	return destroyApp(appName)
+	return destroyApp(os.Stdout, appName)
+}
+
+// CommandDiskUsage displays the image disk usage of an app or of all apps
+func CommandDiskUsage(appName string, all bool, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format specified: %s", format)
+	}
+
+	appNames := []string{appName}
+	if all {
+		var err error
+		if appNames, err = common.ClairApps(); err != nil {
+			return err
+		}
+	} else if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	usages := []diskUsage{}
+	for _, appName := range appNames {
+		images, err := common.AppImageInventory(appName)
+		if err != nil {
+			return err
+		}
+		usages = append(usages, newDiskUsage(appName, images))
+	}
+
+	if format == "json" {
+		out, err := json.Marshal(usages)
+		if err != nil {
+			return err
+		}
+		common.Log(string(out))
+		return nil
+	}
+
+	common.LogInfo2Quiet("Image disk usage")
+	rows := [][]string{{"App", "Images", "Size", "In use", "Reclaimable"}}
+	for _, usage := range usages {
+		rows = append(rows, []string{
+			usage.App,
+			fmt.Sprintf("%d", usage.Images),
+			common.FormatBytes(usage.Size),
+			common.FormatBytes(usage.InUseSize),
+			common.FormatBytes(usage.ReclaimableSize),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
 }
 
 // CommandExists checks if an app exists
@@ -85,6 +240,132 @@ func CommandExists(appName string) error {
 	return appExists(appName)
 }
 
+// CommandImageExport writes an app image to a tar archive
+func CommandImageExport(appName string, imageTag string, output string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	if output == "" {
+		return errors.New("Please specify an output file with -o")
+	}
+
+	if imageTag == "" {
+		var err error
+		if imageTag, err = common.GetRunningImageTag(appName, ""); err != nil {
+			return err
+		}
+	}
+
+	image := fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), imageTag)
+	if !common.VerifyImage(image) {
+		return fmt.Errorf("App image (%s) not found", image)
+	}
+
+	if output == "-" {
+		return common.ExportImage(image, os.Stdout)
+	}
+
+	common.LogInfo1(fmt.Sprintf("Exporting %s to %s", image, output))
+	f, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("Unable to create %s: %s", output, err.Error())
+	}
+
+	if err := common.ExportImage(image, f); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+
+	return f.Close()
+}
+
+// CommandImageImport loads an app image from a tar archive and optionally deploys it
+func CommandImageImport(appName string, input string, imageTag string, deploy bool) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	if input == "" {
+		return errors.New("Please specify an image archive to import")
+	}
+
+	archive := os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("Unable to open %s: %s", input, err.Error())
+		}
+		defer f.Close()
+		archive = f
+	}
+
+	common.LogInfo1(fmt.Sprintf("Importing image into %s", appName))
+	image, err := common.ImportAppImage(appName, archive, imageTag)
+	if err != nil {
+		return err
+	}
+	common.LogVerbose(fmt.Sprintf("Imported %s", image))
+
+	if !deploy {
+		return nil
+	}
+
+	if err := common.PluginTrigger("deploy-source-set", []string{appName, "image-import", filepath.Base(input)}...); err != nil {
+		return err
+	}
+
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+	return common.PluginTrigger("release-and-deploy", []string{appName, imageTag}...)
+}
+
+// CommandImages lists the images held by an app
+func CommandImages(appName string, format string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format specified: %s", format)
+	}
+
+	images, err := common.AppImageInventory(appName)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		out, err := json.Marshal(images)
+		if err != nil {
+			return err
+		}
+		common.Log(string(out))
+		return nil
+	}
+
+	common.LogInfo2Quiet(fmt.Sprintf("%s images", appName))
+	rows := [][]string{{"Image id", "Tags", "Stage", "Size", "Created at", "In use"}}
+	for _, image := range images {
+		imageID := strings.TrimPrefix(image.ID, "sha256:")
+		if len(imageID) > 12 {
+			imageID = imageID[:12]
+		}
+		rows = append(rows, []string{
+			imageID,
+			strings.Join(image.Tags, ", "),
+			image.Stage,
+			common.FormatBytes(image.Size),
+			image.Created.Format(time.RFC3339),
+			fmt.Sprintf("%t", image.InUse),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
 // CommandList lists all apps
 func CommandList() error {
 	common.LogInfo2Quiet("My Apps")
@@ -98,6 +379,32 @@ func CommandList() error {
 		common.Log(appName)
 	}
 
+	aliases, err := common.GetAppAliases()
+	if err != nil {
+		common.LogWarn(err.Error())
+		return nil
+	}
+
+	listed := map[string]bool{}
+	for _, appName := range apps {
+		listed[appName] = true
+	}
+
+	names := []string{}
+	for alias, appName := range aliases {
+		if listed[appName] {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) > 0 {
+		common.LogInfo2Quiet("My Aliases")
+		for _, alias := range names {
+			common.LogVerboseQuiet(fmt.Sprintf("%s -> %s", alias, aliases[alias]))
+		}
+	}
+
 	return nil
 }
 
@@ -113,6 +420,7 @@ func CommandLock(appName string) error {
 	}
 
 	common.LogInfo1("Deploy lock created")
+	common.EmitEvent(common.Event{Type: common.EventAppLocked, App: appName})
 	return nil
 }
 
@@ -130,8 +438,53 @@ func CommandLocked(appName string) error {
 	return errors.New("Deploy lock does not exist")
 }
 
-// CommandRename renames an app
-func CommandRename(oldAppName string, newAppName string, skipDeploy bool) error {
+// CommandMigrateNames renames apps whose names are not valid DNS labels
+func CommandMigrateNames(dryRun bool, skipDeploy bool, keepAlias bool, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	apps, err := common.UnfilteredClairApps()
+	if err != nil {
+		apps = []string{}
+	}
+
+	mapping := legacyAppNameMapping(apps)
+	if format == "json" {
+		renames := []map[string]string{}
+		for _, rename := range mapping {
+			renames = append(renames, map[string]string{"old": rename[0], "new": rename[1]})
+		}
+		b, err := json.Marshal(renames)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+	} else if len(mapping) == 0 {
+		common.LogInfo1Quiet("No legacy app names found")
+		return nil
+	} else {
+		rows := [][]string{{"App", "New name"}}
+		for _, rename := range mapping {
+			rows = append(rows, []string{rename[0], rename[1]})
+		}
+		common.Log(common.FormatTable(rows))
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	for _, rename := range mapping {
+		if err := CommandRename(rename[0], rename[1], skipDeploy, keepAlias); err != nil {
+			return fmt.Errorf("Unable to rename %s to %s: %s", rename[0], rename[1], err.Error())
+		}
+	}
+	return nil
+}
+
+// CommandRename renames an app, optionally keeping the old name as an alias
+func CommandRename(oldAppName string, newAppName string, skipDeploy bool, keepAlias bool) error {
 	if oldAppName == "" {
 		return errors.New("Please specify an app to run the command on")
 	}
@@ -140,6 +493,7 @@ func CommandRename(oldAppName string, newAppName string, skipDeploy bool) error
 		return errors.New("Please specify an new app name")
 	}
 
+	oldAppName = common.ResolveAppName(oldAppName)
 	if err := common.VerifyAppName(oldAppName); err != nil {
 		return err
 	}
@@ -152,8 +506,14 @@ func CommandRename(oldAppName string, newAppName string, skipDeploy bool) error
 		return errors.New("Name is already taken")
 	}
 
+	if common.ResolveAppName(newAppName) == oldAppName {
+		if err := common.RemoveAppAlias(newAppName); err != nil {
+			return err
+		}
+	}
+
 	common.LogInfo1Quiet(fmt.Sprintf("Renaming %s to %s", oldAppName, newAppName))
-	if err := createApp(newAppName); err != nil {
+	if err := createAppAs(os.Stdout, newAppName, appCreator(), false); err != nil {
 		return err
 	}
 
@@ -162,7 +522,7 @@ func CommandRename(oldAppName string, newAppName string, skipDeploy bool) error
 	}
 
 	os.Setenv("CLAIR_APPS_FORCE_DELETE", "1")
-	if err := destroyApp(oldAppName); err != nil {
+	if err := destroyApp(os.Stdout, oldAppName); err != nil {
 		return err
 	}
 
@@ -178,6 +538,14 @@ func CommandRename(oldAppName string, newAppName string, skipDeploy bool) error
 		return err
 	}
 
+	if keepAlias {
+		if err := common.AddAppAlias(oldAppName, newAppName); err != nil {
+			return err
+		}
+		common.LogInfo1Quiet(fmt.Sprintf("Kept %s as an alias of %s", oldAppName, newAppName))
+	}
+
+	common.EmitEvent(common.Event{Type: common.EventAppRenamed, App: newAppName, Trigger: "post-app-rename", Args: []string{oldAppName, newAppName}})
 	return nil
 }
 
@@ -189,14 +557,117 @@ func CommandReport(appName string, format string, infoFlag string) error {
 			return err
 		}
 		for _, appName := range apps {
-			if err := ReportSingleApp(appName, format, infoFlag); err != nil {
+			if err := ReportSingleApp(os.Stdout, appName, format, infoFlag); err != nil {
 				return err
 			}
 		}
 		return nil
 	}
 
-	return ReportSingleApp(appName, format, infoFlag)
+	return ReportSingleApp(os.Stdout, appName, format, infoFlag)
+}
+
+// CommandReleases lists the recorded releases for an app
+func CommandReleases(appName string, format string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	releases, err := getReleases(appName)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		out, err := json.Marshal(releases)
+		if err != nil {
+			return err
+		}
+		common.Log(string(out))
+		return nil
+	}
+
+	if format != "stdout" {
+		return fmt.Errorf("Invalid format specified: %s", format)
+	}
+
+	common.LogInfo2Quiet(fmt.Sprintf("%s releases", appName))
+	rows := [][]string{{"Version", "Image tag", "Image id", "Deploy source", "Deployed by", "Created at"}}
+	for i := len(releases) - 1; i >= 0; i-- {
+		release := releases[i]
+		imageID := strings.TrimPrefix(release.ImageID, "sha256:")
+		if len(imageID) > 12 {
+			imageID = imageID[:12]
+		}
+		rows = append(rows, []string{
+			fmt.Sprintf("v%d", release.Version),
+			release.ImageTag,
+			imageID,
+			release.DeploySource,
+			release.DeployedBy,
+			release.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandRollback re-deploys the image of a previous release without rebuilding
+func CommandRollback(appName string, version string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	release, err := getRelease(appName, version)
+	if err != nil {
+		return err
+	}
+
+	image := fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), release.ReleaseTag())
+	if !common.VerifyImage(image) {
+		return fmt.Errorf("Image for release v%d is no longer available", release.Version)
+	}
+
+	images, err := common.InspectImages([]string{image})
+	if err != nil {
+		return err
+	}
+	if len(images) == 0 || (release.ImageID != "" && images[0].ID != release.ImageID) {
+		return fmt.Errorf("Image for release v%d has changed since it was deployed", release.Version)
+	}
+	if _, err := common.PinAppImageID(appName, image); err != nil {
+		return fmt.Errorf("Unable to pin image for release v%d: %s", release.Version, err.Error())
+	}
+
+	common.LogInfo1(fmt.Sprintf("Rolling back %s to release v%d (%s)", appName, release.Version, release.ImageTag))
+	if err := common.PluginTrigger("deploy", []string{appName, release.ReleaseTag()}...); err != nil {
+		return err
+	}
+
+	common.EmitEvent(common.Event{
+		Type:    common.EventAppRolledBack,
+		App:     appName,
+		Trigger: "deploy",
+		Args:    []string{appName, release.ReleaseTag()},
+		Data:    map[string]string{"release": fmt.Sprintf("v%d", release.Version)},
+	})
+	return nil
+}
+
+// CommandSet sets or clears an apps property for an app or globally
+func CommandSet(appName string, property string, value string) error {
+	if appName != "--global" && policyProperties[property] {
+		return fmt.Errorf("Property %s can only be specified globally", property)
+	}
+
+	if value != "" {
+		if err := validateProperty(property, value); err != nil {
+			return err
+		}
+	}
+
+	common.CommandPropertySet("apps", appName, property, value, DefaultProperties, GlobalProperties)
+	return nil
 }
 
 // CommandUnlock unlocks an app for deployment
@@ -216,5 +687,6 @@ func CommandUnlock(appName string) error {
 	}
 
 	common.LogInfo1("Deploy lock removed")
+	common.EmitEvent(common.Event{Type: common.EventAppUnlocked, App: appName})
 	return nil
 }
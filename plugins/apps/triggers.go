@@ -2,26 +2,52 @@ package apps
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/vinybergamo/clair/plugins/common"
 )
 
-func TriggerAppCreate(appName string) error {
-	return createApp(appName)
+func TriggerAppCreate(stdout io.Writer, appName string) error {
+	return createApp(stdout, appName)
 }
 
-func TriggerAppDestroy(appName string) error {
-	return destroyApp(appName)
+func TriggerAppDestroy(stdout io.Writer, appName string) error {
+	return destroyApp(stdout, appName)
 }
 
 func TriggerAppExists(appName string) error {
 	return appExists(appName)
 }
 
-func TriggerAppMaybeCreate(appName string) error {
-	return maybeCreateApp(appName)
+func TriggerAppMaybeCreate(stdout io.Writer, appName string) error {
+	return maybeCreateApp(stdout, appName)
+}
+
+func TriggerCorePostDeploy(stdout io.Writer, appName string, imageTag string) error {
+	event := common.Event{
+		Type:    common.EventAppDeployed,
+		App:     appName,
+		Trigger: "core-post-deploy",
+		Args:    []string{appName, imageTag},
+	}
+	event.Data = map[string]string{}
+	if duration, ok := common.DeployDuration(time.Now()); ok {
+		event.Data["duration"] = strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+	}
+	defer func() { common.EmitEvent(event) }()
+
+	release, err := recordRelease(appName, imageTag)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record release: %s", err.Error()))
+		return nil
+	}
+	event.Data["release"] = fmt.Sprintf("v%d", release.Version)
+
+	common.LogVerboseQuietTo(stdout, fmt.Sprintf("Recorded release v%d", release.Version))
+	return nil
 }
 
 func TriggerDeploySourceSet(appName string, sourceType string, sourceMetadata string) error {
@@ -65,12 +91,26 @@ func TriggerInstall() error {
 }
 
 func TriggerPostAppCloneSetup(oldAppName string, newAppName string) error {
+	createdBy := common.PropertyGet("apps", newAppName, "created-by")
 	err := common.PropertyClone("apps", oldAppName, newAppName)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	for _, property := range []string{"image-pinned-id", "image-verification"} {
+		if err := common.PropertyDelete("apps", newAppName, property); err != nil {
+			return err
+		}
+	}
+
+	if err := retagReleaseImages(oldAppName, newAppName); err != nil {
+		return err
+	}
+
+	if createdBy != "" {
+		return common.PropertyWrite("apps", newAppName, "created-by", createdBy)
+	}
+	return common.PropertyDelete("apps", newAppName, "created-by")
 }
 
 func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
@@ -78,6 +118,14 @@ func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
 		return err
 	}
 
+	if err := retagReleaseImages(oldAppName, newAppName); err != nil {
+		return err
+	}
+
+	if err := common.RetargetAppAliases(oldAppName, newAppName); err != nil {
+		return err
+	}
+
 	if err := common.PropertyDestroy("apps", oldAppName); err != nil {
 		return err
 	}
@@ -90,19 +138,16 @@ func TriggerPostDelete(appName string) error {
 		common.LogWarn(err.Error())
 	}
 
-	imagesByAppLabel, err := listImagesByAppLabel(appName)
-	if err != nil {
+	if err := common.RetargetAppAliases(appName, ""); err != nil {
 		common.LogWarn(err.Error())
 	}
 
-	imageRepo := common.GetAppImageRepo(appName)
-	imagesByRepo, err := listImagesByImageRepo(imageRepo)
+	images, err := common.AppImageInventory(appName)
 	if err != nil {
 		common.LogWarn(err.Error())
 	}
 
-	images := append(imagesByAppLabel, imagesByRepo...)
-	common.RemoveImages(images)
+	common.RemoveImageInfos(appName, images)
 
 	return nil
 }
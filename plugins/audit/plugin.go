@@ -0,0 +1,36 @@
+package audit
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the audit commands
+var Plugin = common.NewPlugin("audit", "Query the clair command audit log")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "query",
+		Description: "Display entries from the command audit log",
+		Flags: []common.Flag{
+			{Name: "user", Description: "--user: only show entries for the user"},
+			{Name: "key-name", Placeholder: "<name>", Description: "--key-name: only show entries for the ssh key name"},
+			{Name: "command", Description: "--command: only show entries for the command, or every command of a plugin with <plugin>:*"},
+			{Name: "app", Description: "--app: only show entries for the app", Complete: common.CompleteApp},
+			{Name: "decision", Values: []string{common.AuditDecisionAllow, common.AuditDecisionDeny}, Description: "--decision: only show allowed or denied commands"},
+			{Name: "since", Placeholder: "<duration>", Description: "--since: only show entries newer than the duration, such as 1h or 7d"},
+			{Name: "limit", Kind: common.KindInt, Default: "0", Placeholder: "<count>", Description: "--limit: show at most the given number of the most recent entries"},
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"},
+		},
+		Run: func(ctx *common.Context) error {
+			filter := common.AuditFilter{
+				User:     ctx.String("user"),
+				KeyName:  ctx.String("key-name"),
+				Command:  ctx.String("command"),
+				App:      ctx.String("app"),
+				Decision: ctx.String("decision"),
+				Limit:    ctx.Int("limit"),
+			}
+			return CommandQuery(filter, ctx.String("since"), ctx.String("format"))
+		},
+	})
+}
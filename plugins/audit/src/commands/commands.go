@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/audit"
+)
+
+func main() {
+	audit.Plugin.RunCommands()
+}
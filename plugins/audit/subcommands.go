@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandQuery displays the audit log entries matching the given filters
+func CommandQuery(filter common.AuditFilter, since string, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+	if filter.Decision != "" && filter.Decision != common.AuditDecisionAllow && filter.Decision != common.AuditDecisionDeny {
+		return fmt.Errorf("Invalid decision %s: must be %s or %s", filter.Decision, common.AuditDecisionAllow, common.AuditDecisionDeny)
+	}
+	if since != "" {
+		age, err := common.ParseAge(since)
+		if err != nil {
+			return err
+		}
+		filter.Since = time.Now().Add(-age)
+	}
+
+	entries, err := common.QueryAuditLog(common.AuditLogFile(), filter)
+	if err != nil {
+		return fmt.Errorf("Unable to read audit log: %s", err.Error())
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(entries)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(entries) == 0 {
+		common.LogInfo1Quiet("No audit entries found")
+		return nil
+	}
+
+	rows := [][]string{{"Time", "User", "Key", "Source", "Command", "App", "Decision", "Exit", "Duration", "Args"}}
+	for _, entry := range entries {
+		rows = append(rows, []string{
+			entry.Timestamp.Local().Format(time.RFC3339),
+			entry.User,
+			entry.KeyName,
+			entry.Source,
+			entry.Command,
+			entry.App,
+			entry.Decision,
+			strconv.Itoa(entry.ExitCode),
+			entry.Duration.Round(time.Millisecond).String(),
+			strings.Join(entry.Args, " "),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
@@ -0,0 +1,11 @@
+package auth
+
+var (
+	DefaultProperties = map[string]string{
+		"enabled": "",
+	}
+
+	GlobalProperties = map[string]bool{
+		"enabled": true,
+	}
+)
@@ -0,0 +1,16 @@
+package auth
+
+import (
+	"strings"
+)
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	values := []string{}
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,17 @@
+module github.com/vinybergamo/clair/plugins/auth
+
+go 1.20
+
+require (
+	github.com/spf13/pflag v1.0.5
+	github.com/vinybergamo/clair/plugins/common v0.0.0-20230730144325-538df9424f94
+)
+
+require (
+	github.com/codegangsta/inject v0.0.0-20150114235600-33e0aa1cb7c0 // indirect
+	github.com/codeskyblue/go-sh v0.0.0-20200712050446-30169cf553fe // indirect
+	github.com/otiai10/copy v1.12.0 // indirect
+	github.com/ryanuber/columnize v2.1.2+incompatible // indirect
+	golang.org/x/sync v0.3.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+)
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the auth commands and triggers
+var Plugin = common.NewPlugin("auth", "Manage api tokens and access to apps")
+
+func init() {
+	formatFlag := common.Flag{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"}
+
+	Plugin.AddCommand(common.Command{
+		Name:        "grants:add",
+		Description: "Grant a role to a user:<key-name> or group:<group>",
+		Args:        []common.Arg{{Name: "subject"}, {Name: "role", Values: common.RoleNames()}},
+		Flags: []common.Flag{
+			{Name: "app", Placeholder: "<pattern>", Description: "--app: app name pattern the grant is limited to", Complete: common.CompleteApp},
+			{Name: "label", Placeholder: "<key=value>", Description: "--label: app label of the form key=value the grant is limited to"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandGrantsAdd(ctx.String("subject"), ctx.String("role"), ctx.String("app"), ctx.String("label"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "grants:list",
+		Description: "List grants",
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandGrantsList(ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "grants:remove",
+		Description: "Remove a grant",
+		Args:        []common.Arg{{Name: "id"}},
+		Run: func(ctx *common.Context) error {
+			return CommandGrantsRemove(ctx.String("id"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "groups:add",
+		Description: "Add a user to a group",
+		Args:        []common.Arg{{Name: "group"}, {Name: "key-name"}},
+		Run: func(ctx *common.Context) error {
+			return CommandGroupsAdd(ctx.String("group"), ctx.String("key-name"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "groups:list",
+		Description: "List groups and their members",
+		Run: func(ctx *common.Context) error {
+			return CommandGroupsList()
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "groups:remove",
+		Description: "Remove a user from a group",
+		Args:        []common.Arg{{Name: "group"}, {Name: "key-name"}},
+		Run: func(ctx *common.Context) error {
+			return CommandGroupsRemove(ctx.String("group"), ctx.String("key-name"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "labels:add",
+		Description: "Set an app label used by grants",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "label", Description: "a label of the form key=value"}},
+		Run: func(ctx *common.Context) error {
+			return CommandLabelsAdd(ctx.String("app"), ctx.String("label"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "labels:list",
+		Description: "List app labels",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Run: func(ctx *common.Context) error {
+			return CommandLabelsList(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "labels:remove",
+		Description: "Remove an app label",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "key"}},
+		Run: func(ctx *common.Context) error {
+			return CommandLabelsRemove(ctx.String("app"), ctx.String("key"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "roles",
+		Description: "List roles and the scopes they grant",
+		Run: func(ctx *common.Context) error {
+			return CommandRoles()
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "set",
+		Description: "Enable or disable role-based access control",
+		Args:        []common.Arg{{Name: "key", Values: []string{"enabled"}}, {Name: "value", Optional: true, Values: []string{"true", "false"}}},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Default: "true", Description: "--global: set a global property"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandSet(ctx.String("key"), ctx.String("value"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "tokens:create",
+		Description: "Create a scoped api token",
+		Flags: []common.Flag{
+			{Name: "name", Required: true, Description: "--name: a name describing the token"},
+			{Name: "scope", Placeholder: "<scope,...>", Required: true, Description: "--scope: comma separated scopes granted to the token, such as apps:read,apps:lock"},
+			{Name: "apps", Placeholder: "<pattern,...>", Description: "--apps: comma separated app name patterns the token may act on, defaults to all apps"},
+			{Name: "expires", Placeholder: "<duration>", Description: "--expires: duration after which the token expires, such as 12h or 30d"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandTokensCreate(ctx.String("name"), ctx.String("scope"), ctx.String("apps"), ctx.String("expires"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "tokens:list",
+		Description: "List api tokens",
+		Flags:       []common.Flag{formatFlag},
+		Run: func(ctx *common.Context) error {
+			return CommandTokensList(ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "tokens:revoke",
+		Description: "Revoke an api token",
+		Args:        []common.Arg{{Name: "id"}},
+		Run: func(ctx *common.Context) error {
+			return CommandTokensRevoke(ctx.String("id"))
+		},
+	})
+
+	renameArgs := []common.TriggerArg{{Name: "old-app"}, {Name: "new-app"}}
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-clone-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppCloneSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-rename-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppRenameSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-delete",
+		Args: []common.TriggerArg{{Name: "app"}},
+		Run: func(ctx *common.Context) error {
+			return TriggerPostDelete(ctx.String("app"))
+		},
+	})
+}
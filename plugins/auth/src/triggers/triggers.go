@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/auth"
+)
+
+func main() {
+	auth.Plugin.RunTrigger()
+}
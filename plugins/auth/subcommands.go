@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandTokensCreate creates a scoped api token
+func CommandTokensCreate(name string, scope string, apps string, expires string) error {
+	if name == "" {
+		return errors.New("Please specify a token name")
+	}
+
+	var ttl time.Duration
+	if expires != "" {
+		var err error
+		if ttl, err = common.ParseAge(expires); err != nil {
+			return err
+		}
+	}
+
+	tokenString, token, err := common.CreateAPIToken(name, splitList(scope), splitList(apps), ttl, os.Getenv("SSH_USER"))
+	if err != nil {
+		return err
+	}
+
+	common.LogInfo1Quiet(fmt.Sprintf("Created api token %s, it will not be shown again", token.ID))
+	common.Log(tokenString)
+	return nil
+}
+
+// CommandTokensList displays the api tokens
+func CommandTokensList(format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	tokens, err := common.GetAPITokens()
+	if err != nil {
+		return err
+	}
+	for i := range tokens {
+		tokens[i].Hash = ""
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(tokens)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(tokens) == 0 {
+		common.LogInfo1Quiet("No api tokens found")
+		return nil
+	}
+
+	now := time.Now()
+	rows := [][]string{{"Id", "Name", "Scopes", "Apps", "Status", "Expires", "Last used", "Created by"}}
+	for _, token := range tokens {
+		apps := "all"
+		if len(token.Apps) > 0 {
+			apps = strings.Join(token.Apps, ",")
+		}
+
+		rows = append(rows, []string{
+			token.ID,
+			token.Name,
+			strings.Join(token.Scopes, ","),
+			apps,
+			token.Status(now),
+			formatTime(token.ExpiresAt, "never"),
+			formatTime(token.LastUsedAt, "never"),
+			token.CreatedBy,
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandTokensRevoke revokes an api token
+func CommandTokensRevoke(id string) error {
+	if id == "" {
+		return errors.New("Please specify a token id")
+	}
+
+	if err := common.RevokeAPIToken(id); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Revoked api token %s", id))
+	return nil
+}
+
+// CommandGrantsAdd grants a role to a user or group
+func CommandGrantsAdd(subject string, role string, app string, label string) error {
+	if subject == "" {
+		return errors.New("Please specify a subject of the form user:<key-name> or group:<group>")
+	}
+	if role == "" {
+		return errors.New("Please specify a role")
+	}
+
+	grant, err := common.AddGrant(subject, role, app, label)
+	if err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Granted %s to %s as %s", describeGrantApps(grant), subject, role))
+	return nil
+}
+
+// CommandGrantsList displays the configured grants
+func CommandGrantsList(format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	grants, err := common.GetGrants()
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(grants)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(grants) == 0 {
+		common.LogInfo1Quiet("No grants found")
+		return nil
+	}
+
+	rows := [][]string{{"Id", "Subject", "Role", "Apps"}}
+	for _, grant := range grants {
+		rows = append(rows, []string{grant.ID, grant.Subject, grant.Role, describeGrantApps(grant)})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandGrantsRemove removes a grant
+func CommandGrantsRemove(id string) error {
+	if id == "" {
+		return errors.New("Please specify a grant id")
+	}
+
+	if err := common.RemoveGrant(id); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Removed grant %s", id))
+	return nil
+}
+
+// CommandGroupsAdd adds a user to a group
+func CommandGroupsAdd(group string, keyName string) error {
+	if err := common.AddGroupMember(group, keyName); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Added %s to group %s", keyName, group))
+	return nil
+}
+
+// CommandGroupsList displays the groups and their members
+func CommandGroupsList() error {
+	groups, err := common.GetGroups()
+	if err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		common.LogInfo1Quiet("No groups found")
+		return nil
+	}
+
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rows := [][]string{{"Group", "Members"}}
+	for _, name := range names {
+		rows = append(rows, []string{name, strings.Join(groups[name], ",")})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandGroupsRemove removes a user from a group
+func CommandGroupsRemove(group string, keyName string) error {
+	if err := common.RemoveGroupMember(group, keyName); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Removed %s from group %s", keyName, group))
+	return nil
+}
+
+// CommandLabelsAdd sets a label on an app, used to grant access to groups of apps
+func CommandLabelsAdd(appName string, label string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	parts := strings.SplitN(label, "=", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return fmt.Errorf("Invalid label %s: must be of the form key=value", label)
+	}
+
+	if err := common.SetAppLabel(appName, parts[0], parts[1]); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Set label %s on %s", label, appName))
+	return nil
+}
+
+// CommandLabelsList displays the labels set on an app
+func CommandLabelsList(appName string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	labels := common.GetAppLabels(appName)
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	common.LogInfo2Quiet(fmt.Sprintf("%s labels", appName))
+	for _, key := range keys {
+		common.Log(fmt.Sprintf("%s=%s", key, labels[key]))
+	}
+	return nil
+}
+
+// CommandLabelsRemove removes a label from an app
+func CommandLabelsRemove(appName string, key string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	if _, ok := common.GetAppLabels(appName)[key]; !ok {
+		return fmt.Errorf("Label %s is not set on %s", key, appName)
+	}
+
+	if err := common.SetAppLabel(appName, key, ""); err != nil {
+		return err
+	}
+
+	common.LogInfo1(fmt.Sprintf("Removed label %s from %s", key, appName))
+	return nil
+}
+
+// CommandRoles displays the built-in roles and the scopes they grant
+func CommandRoles() error {
+	rows := [][]string{{"Role", "Scopes"}}
+	for _, role := range common.RoleNames() {
+		rows = append(rows, []string{role, strings.Join(common.Roles[role], ",")})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandSet sets or clears an auth property
+func CommandSet(property string, value string) error {
+	if value != "" {
+		if err := validateProperty(property, value); err != nil {
+			return err
+		}
+	}
+
+	common.CommandPropertySet("auth", "--global", property, value, DefaultProperties, GlobalProperties)
+	return nil
+}
+
+func describeGrantApps(grant common.Grant) string {
+	apps := []string{}
+	if grant.App != "" {
+		apps = append(apps, grant.App)
+	}
+	if grant.Label != "" {
+		apps = append(apps, "label "+grant.Label)
+	}
+	if len(apps) == 0 {
+		return "all apps"
+	}
+	return strings.Join(apps, " with ")
+}
+
+func validateProperty(property string, value string) error {
+	switch property {
+	case "enabled":
+		if value != "true" && value != "false" {
+			return errors.New("Invalid enabled: must be true or false")
+		}
+		if value == "true" {
+			grants, err := common.GetGrants()
+			if err != nil {
+				return err
+			}
+			for _, grant := range grants {
+				if grant.Role == common.RoleAdmin && !grant.IsScoped() {
+					return nil
+				}
+			}
+			common.LogWarn("No admin grant exists, only root and local users will be able to manage access")
+		}
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time, zero string) string {
+	if t.IsZero() {
+		return zero
+	}
+	return t.Local().Format(time.RFC3339)
+}
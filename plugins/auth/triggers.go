@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"fmt"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// TriggerInstall runs the install step for the auth plugin
+func TriggerInstall() error {
+	if err := common.PropertySetup("auth"); err != nil {
+		return fmt.Errorf("Unable to install the auth plugin: %s", err.Error())
+	}
+
+	return nil
+}
+
+// TriggerPostAppCloneSetup copies app labels to the new app
+func TriggerPostAppCloneSetup(oldAppName string, newAppName string) error {
+	return common.PropertyClone("auth", oldAppName, newAppName)
+}
+
+// TriggerPostAppRenameSetup moves app labels and grants for the app to the new name
+func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
+	if err := common.PropertyClone("auth", oldAppName, newAppName); err != nil {
+		return err
+	}
+	if err := common.PropertyDestroy("auth", oldAppName); err != nil {
+		return err
+	}
+
+	grants, err := common.GetGrants()
+	if err != nil {
+		return err
+	}
+	for _, grant := range grants {
+		if grant.App != oldAppName {
+			continue
+		}
+		if _, err := common.AddGrant(grant.Subject, grant.Role, newAppName, grant.Label); err != nil {
+			return err
+		}
+		if err := common.RemoveGrant(grant.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TriggerPostDelete destroys the auth data for a given app
+func TriggerPostDelete(appName string) error {
+	return common.PropertyDestroy("auth", appName)
+}
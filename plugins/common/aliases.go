@@ -0,0 +1,157 @@
+package common
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GetAppAliases returns every app alias mapped to the app it resolves to
+func GetAppAliases() (map[string]string, error) {
+	aliases := map[string]string{}
+	lines, err := PropertyListGet("apps", "--global", "aliases")
+	if err != nil {
+		return aliases, err
+	}
+
+	for _, line := range lines {
+		parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+		if len(parts) == 2 && parts[0] != "" && parts[1] != "" {
+			aliases[parts[0]] = parts[1]
+		}
+	}
+	return aliases, nil
+}
+
+// AppAliasesFor returns the aliases resolving to an app, sorted by name
+func AppAliasesFor(appName string) []string {
+	aliases, err := GetAppAliases()
+	if err != nil {
+		return []string{}
+	}
+
+	names := []string{}
+	for alias, target := range aliases {
+		if target == appName {
+			names = append(names, alias)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ResolveAppName returns the app an alias resolves to, or the name itself when
+// it is not an alias
+func ResolveAppName(appName string) string {
+	if appName == "" || DirectoryExists(AppRoot(appName)) {
+		return appName
+	}
+
+	aliases, err := GetAppAliases()
+	if err != nil {
+		return appName
+	}
+	if target, ok := aliases[appName]; ok {
+		return target
+	}
+	return appName
+}
+
+// ResolveCommandAppArgs returns the arguments of a command invocation with
+// aliases resolved in the arguments naming an existing app, as described by
+// the command help metadata. Other arguments are returned unchanged.
+func ResolveCommandAppArgs(args []string) []string {
+	resolved := append([]string{}, args...)
+	if len(args) < 2 {
+		return resolved
+	}
+
+	help, ok := CommandHelpFor(args[0])
+	if !ok {
+		return resolved
+	}
+	for _, index := range help.AppArgIndexes(args[1:], true) {
+		resolved[index+1] = ResolveAppName(args[index+1])
+	}
+	return resolved
+}
+
+// AddAppAlias adds an alias resolving to an existing app. Aliases follow the
+// naming restrictions of existing apps so that renamed legacy apps may keep
+// their old name as an alias.
+func AddAppAlias(alias string, appName string) error {
+	if newErr, oldErr := isValidAppNameFormat(alias), isValidAppNameOld(alias); newErr != nil && oldErr != nil {
+		return newErr
+	}
+	if err := isReservedAppName(alias); err != nil {
+		return err
+	}
+
+	appName = ResolveAppName(appName)
+	if appName == "" || !DirectoryExists(AppRoot(appName)) {
+		return &AppDoesNotExist{appName}
+	}
+	if DirectoryExists(AppRoot(alias)) {
+		return fmt.Errorf("Name %s is already taken by an app", alias)
+	}
+
+	aliases, err := GetAppAliases()
+	if err != nil {
+		return err
+	}
+	if target, ok := aliases[alias]; ok {
+		return fmt.Errorf("Alias %s already resolves to %s", alias, target)
+	}
+
+	return PropertyListAdd("apps", "--global", "aliases", alias+"="+appName, 0)
+}
+
+// RemoveAppAlias removes an alias
+func RemoveAppAlias(alias string) error {
+	aliases, err := GetAppAliases()
+	if err != nil {
+		return err
+	}
+	if _, ok := aliases[alias]; !ok {
+		return fmt.Errorf("Alias %s does not exist", alias)
+	}
+
+	return PropertyListRemoveByPrefix("apps", "--global", "aliases", alias+"=")
+}
+
+// RetargetAppAliases points the aliases of an app at a new app name, or removes
+// them when the new name is empty
+func RetargetAppAliases(oldAppName string, newAppName string) error {
+	aliases, err := GetAppAliases()
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	lines := []string{}
+	for _, alias := range sortedKeys(aliases) {
+		target := aliases[alias]
+		if target == oldAppName {
+			changed = true
+			if newAppName == "" || alias == newAppName {
+				continue
+			}
+			target = newAppName
+		}
+		lines = append(lines, alias+"="+target)
+	}
+	if !changed {
+		return nil
+	}
+
+	return PropertyListWrite("apps", "--global", "aliases", lines)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,56 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonAppAliases(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	clairRoot := filepath.Join(os.Getenv("CLAIR_LIB_ROOT"), "home")
+	os.Setenv("CLAIR_ROOT", clairRoot)
+	defer os.Setenv("CLAIR_ROOT", "/home/clair")
+	Expect(os.MkdirAll(filepath.Join(clairRoot, testAppName), 0755)).To(Succeed())
+	Expect(os.MkdirAll(filepath.Join(clairRoot, "test-app-2"), 0755)).To(Succeed())
+
+	Expect(AddAppAlias("legacy_app", testAppName)).To(Succeed())
+	Expect(AddAppAlias("old-app", "legacy_app")).To(Succeed())
+	Expect(AddAppAlias("old-app", "test-app-2")).To(MatchError("Alias old-app already resolves to " + testAppName))
+	Expect(AddAppAlias("test-app-2", testAppName)).To(MatchError("Name test-app-2 is already taken by an app"))
+	Expect(AddAppAlias("www", testAppName)).To(MatchError("App name www is reserved"))
+	Expect(AddAppAlias("other", "missing-app")).To(HaveOccurred())
+
+	Expect(ResolveAppName("old-app")).To(Equal(testAppName))
+	Expect(ResolveAppName("test-app-2")).To(Equal("test-app-2"))
+	Expect(ResolveAppName("unknown")).To(Equal("unknown"))
+	Expect(AppAliasesFor(testAppName)).To(Equal([]string{"legacy_app", "old-app"}))
+	Expect(VerifyAppName("old-app")).To(MatchError("App old-app does not exist"))
+
+	pluginPath := filepath.Join(os.Getenv("CLAIR_LIB_ROOT"), "plugins")
+	Expect(os.MkdirAll(filepath.Join(pluginPath, "enabled", "apps"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(pluginPath, "enabled", "apps", "commands"), []byte("#!/bin/sh\n"+
+		`echo '{"name":"apps","commands":[{"name":"apps:alias:add","args":[{"name":"alias"},{"name":"app","complete":"app"}]}]}'`+"\n"), 0755)).To(Succeed())
+	os.Setenv("PLUGIN_PATH", pluginPath)
+	defer os.Unsetenv("PLUGIN_PATH")
+	Expect(ResolveCommandAppArgs([]string{"apps:alias:add", "old-app", "old-app"})).To(Equal([]string{"apps:alias:add", "old-app", testAppName}))
+	Expect(ResolveCommandAppArgs([]string{"registry:login", "old-app"})).To(Equal([]string{"registry:login", "old-app"}))
+
+	Expect(RetargetAppAliases(testAppName, "test-app-2")).To(Succeed())
+	Expect(ResolveAppName("legacy_app")).To(Equal("test-app-2"))
+
+	Expect(RemoveAppAlias("legacy_app")).To(Succeed())
+	Expect(RemoveAppAlias("legacy_app")).To(MatchError("Alias legacy_app does not exist"))
+
+	Expect(RetargetAppAliases("test-app-2", "")).To(Succeed())
+	aliases, err := GetAppAliases()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(aliases).To(BeEmpty())
+}
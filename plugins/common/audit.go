@@ -0,0 +1,252 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// AuditDecisionAllow records a command that was allowed to run
+	AuditDecisionAllow = "allow"
+
+	// AuditDecisionDeny records a command that was refused
+	AuditDecisionDeny = "deny"
+)
+
+// AuditEntry is a single entry in the audit log
+type AuditEntry struct {
+	User      string        `json:"user"`
+	KeyName   string        `json:"key_name,omitempty"`
+	Source    string        `json:"source"`
+	Remote    string        `json:"remote,omitempty"`
+	Command   string        `json:"command"`
+	Args      []string      `json:"args,omitempty"`
+	App       string        `json:"app,omitempty"`
+	Decision  string        `json:"decision"`
+	ExitCode  int           `json:"exit_code"`
+	Duration  time.Duration `json:"duration"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// AuditRedacted replaces secret values in audited command arguments
+const AuditRedacted = "[REDACTED]"
+
+// auditSecretFlag matches flags whose values are secrets
+var auditSecretFlag = regexp.MustCompile(`(?i)^--?[a-z0-9-]*(password|passwd|secret|token|key)$`)
+
+// auditPasswordArgCommands are the commands taking a password as their last
+// positional argument unless --password-stdin is used
+var auditPasswordArgCommands = map[string]bool{
+	"registry:login": true,
+}
+
+// auditURLArgCommands are the commands taking a url that may embed credentials
+// in its path or query, such as a webhook token
+var auditURLArgCommands = map[string]bool{
+	"webhooks:add": true,
+}
+
+// AuditFilter selects entries from the audit log
+type AuditFilter struct {
+	// User only matches entries for the given user
+	User string
+
+	// KeyName only matches entries for the given ssh key name
+	KeyName string
+
+	// Command only matches entries for the given command, or every command of
+	// a plugin when of the form <plugin>:*
+	Command string
+
+	// App only matches entries for the given app
+	App string
+
+	// Decision only matches entries with the given decision
+	Decision string
+
+	// Since only matches entries at or after the given time
+	Since time.Time
+
+	// Limit returns at most the given number of the most recent entries
+	Limit int
+}
+
+// Matches returns true if the entry is selected by the filter
+func (f AuditFilter) Matches(entry AuditEntry) bool {
+	if f.User != "" && entry.User != f.User {
+		return false
+	}
+	if f.KeyName != "" && entry.KeyName != f.KeyName {
+		return false
+	}
+	if f.Command != "" && entry.Command != f.Command && !scopeAllows([]string{f.Command}, entry.Command) {
+		return false
+	}
+	if f.App != "" && entry.App != f.App {
+		return false
+	}
+	if f.Decision != "" && entry.Decision != f.Decision {
+		return false
+	}
+	return f.Since.IsZero() || !entry.Timestamp.Before(f.Since)
+}
+
+// AuditLogFile returns the path to the audit log
+func AuditLogFile() string {
+	if path := os.Getenv("CLAIR_AUDIT_LOGFILE"); path != "" {
+		return path
+	}
+
+	logsDir := os.Getenv("CLAIR_LOGS_DIR")
+	if logsDir == "" {
+		logsDir = "/var/log/clair"
+	}
+	return filepath.Join(logsDir, "audit.json")
+}
+
+// AppendAuditEntry appends an entry to the audit log at the given path, rotating
+// it with the same settings as the event log
+func AppendAuditEntry(path string, entry AuditEntry) error {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	return appendJSONLine(path, entry, entry.Timestamp, GetEventLogRotation())
+}
+
+// RecordCommandAudit records a command invocation in the audit log, using the
+// ssh user, key name and source exported by the clair entrypoint
+func RecordCommandAudit(decision string, exitCode int, startedAt time.Time, args []string) error {
+	if len(args) == 0 {
+		args = []string{"help"}
+	}
+
+	source := os.Getenv("CLAIR_AUDIT_SOURCE")
+	if source == "" {
+		source = "local"
+	}
+
+	now := time.Now()
+	entry := AuditEntry{
+		User:      os.Getenv("SSH_USER"),
+		KeyName:   os.Getenv("SSH_NAME"),
+		Source:    source,
+		Command:   args[0],
+		Args:      RedactCommandArgs(args[0], args[1:]),
+		App:       CommandAppName(args),
+		Decision:  decision,
+		ExitCode:  exitCode,
+		Timestamp: now.UTC(),
+	}
+	if source == "ssh" {
+		entry.Remote = strings.SplitN(os.Getenv("SSH_CLIENT"), " ", 2)[0]
+	}
+	if !startedAt.IsZero() {
+		entry.Duration = now.Sub(startedAt)
+	}
+
+	return AppendAuditEntry(AuditLogFile(), entry)
+}
+
+// QueryAuditLog returns the entries in the audit log at the given path, and its
+// rotated backups, that match the filter, oldest first
+func QueryAuditLog(path string, filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	for _, file := range logFiles(path) {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return entries, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			if filter.Matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return entries, err
+		}
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// RedactCommandArgs returns a copy of the arguments following a command with
+// secrets replaced: config values, the values of secret flags, api tokens,
+// positional passwords and everything but the scheme and host of urls
+func RedactCommandArgs(command string, args []string) []string {
+	redacted := make([]string, len(args))
+	lastPositional := -1
+	positionals := 0
+	passwordStdin := false
+	redactNext := false
+	for i, arg := range args {
+		redacted[i] = arg
+		if redactNext {
+			redacted[i] = AuditRedacted
+			redactNext = false
+			continue
+		}
+
+		if strings.HasPrefix(arg, "-") {
+			name := strings.SplitN(arg, "=", 2)[0]
+			if name == "--password-stdin" {
+				passwordStdin = true
+			}
+			if auditSecretFlag.MatchString(name) {
+				if strings.Contains(arg, "=") {
+					redacted[i] = name + "=" + AuditRedacted
+				} else {
+					redactNext = true
+				}
+			}
+			continue
+		}
+
+		positionals++
+		lastPositional = i
+		if strings.HasPrefix(arg, apiTokenPrefix) {
+			redacted[i] = AuditRedacted
+		} else if strings.HasPrefix(command, "config:") && strings.Contains(arg, "=") {
+			redacted[i] = strings.SplitN(arg, "=", 2)[0] + "=" + AuditRedacted
+		} else if auditURLArgCommands[command] && strings.Contains(arg, "://") {
+			redacted[i] = redactURL(arg)
+		}
+	}
+
+	if auditPasswordArgCommands[command] && !passwordStdin && positionals >= 3 {
+		redacted[lastPositional] = AuditRedacted
+	}
+	return redacted
+}
+
+// redactURL keeps the scheme and host of a url, replacing its credentials,
+// path and query
+func redactURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return AuditRedacted
+	}
+	return fmt.Sprintf("%s://%s/%s", u.Scheme, u.Host, AuditRedacted)
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonRedactCommandArgs(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(RedactCommandArgs("config:set", []string{"--no-restart", testAppName, "DATABASE_URL=postgres://user:pass@db", "DEBUG=1"})).To(Equal(
+		[]string{"--no-restart", testAppName, "DATABASE_URL=[REDACTED]", "DEBUG=[REDACTED]"},
+	))
+	Expect(RedactCommandArgs("registry:login", []string{testAppName, "ghcr.io", "bot", "hunter2"})).To(Equal(
+		[]string{testAppName, "ghcr.io", "bot", "[REDACTED]"},
+	))
+	Expect(RedactCommandArgs("registry:login", []string{"--password-stdin", testAppName, "ghcr.io", "bot"})).To(Equal(
+		[]string{"--password-stdin", testAppName, "ghcr.io", "bot"},
+	))
+	Expect(RedactCommandArgs("api:set", []string{"--token", "abc", "--api-key=def", "--key-name", "alice", "clair_0123_4567"})).To(Equal(
+		[]string{"--token", "[REDACTED]", "--api-key=[REDACTED]", "--key-name", "alice", "[REDACTED]"},
+	))
+	Expect(RedactCommandArgs("apps:rename", []string{testAppName, "test-app-2"})).To(Equal([]string{testAppName, "test-app-2"}))
+	Expect(RedactCommandArgs("webhooks:add", []string{"--events", "app.deployed", "--app", testAppName, "https://bot:pw@hooks.example.com/services/T0/B0/abc?token=def"})).To(Equal(
+		[]string{"--events", "app.deployed", "--app", testAppName, "https://hooks.example.com/[REDACTED]"},
+	))
+	Expect(RedactCommandArgs("webhooks:add", []string{"http://%zz/hook", "--secret", "s3cret"})).To(Equal([]string{"[REDACTED]", "--secret", "[REDACTED]"}))
+}
+
+func TestCommonRecordAndQueryAuditLog(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	path := filepath.Join(os.Getenv("CLAIR_LIB_ROOT"), "audit.json")
+	os.Setenv("CLAIR_AUDIT_LOGFILE", path)
+	os.Setenv("CLAIR_AUDIT_SOURCE", "ssh")
+	os.Setenv("SSH_CLIENT", "192.0.2.10 50122 22")
+	os.Setenv("SSH_USER", "clair")
+	os.Setenv("SSH_NAME", "alice")
+	defer func() {
+		for _, key := range []string{"CLAIR_AUDIT_LOGFILE", "CLAIR_AUDIT_SOURCE", "SSH_CLIENT", "SSH_USER", "SSH_NAME"} {
+			os.Unsetenv(key)
+		}
+	}()
+
+	startedAt := time.Now().Add(-2 * time.Second)
+	Expect(RecordCommandAudit(AuditDecisionAllow, 0, startedAt, []string{"config:set", testAppName, "SECRET=value"})).To(Succeed())
+	Expect(RecordCommandAudit(AuditDecisionDeny, 1, startedAt, []string{"apps:destroy", testAppName})).To(Succeed())
+	os.Setenv("SSH_NAME", "bob")
+	Expect(RecordCommandAudit(AuditDecisionAllow, 0, time.Time{}, []string{"apps:list"})).To(Succeed())
+
+	entries, err := QueryAuditLog(path, AuditFilter{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(entries).To(HaveLen(3))
+	Expect(entries[0].Args).To(Equal([]string{testAppName, "SECRET=[REDACTED]"}))
+	Expect(entries[0].App).To(Equal(testAppName))
+	Expect(entries[0].Remote).To(Equal("192.0.2.10"))
+	Expect(entries[0].Duration).To(BeNumerically(">=", 2*time.Second))
+	Expect(entries[2].App).To(BeEmpty())
+
+	entries, err = QueryAuditLog(path, AuditFilter{KeyName: "alice", Decision: AuditDecisionDeny})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(entries).To(HaveLen(1))
+	Expect(entries[0].Command).To(Equal("apps:destroy"))
+	Expect(entries[0].ExitCode).To(Equal(1))
+
+	entries, err = QueryAuditLog(path, AuditFilter{Command: "apps:*", Limit: 1})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(entries).To(HaveLen(1))
+	Expect(entries[0].KeyName).To(Equal("bob"))
+}
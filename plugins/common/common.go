@@ -5,9 +5,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -63,15 +64,16 @@ func AskForDestructiveConfirmation(name string, objectType string) error {
 	return nil
 }
 
-// CommandUsage outputs help for a command
-func CommandUsage(helpHeader string, helpContent string) {
+// FormatTable formats rows of values into aligned columns
+func FormatTable(rows [][]string) string {
 	config := columnize.DefaultConfig()
-	config.Delim = ","
-	config.Prefix = "    "
+	config.Delim = "\x1f"
 	config.Empty = ""
-	content := strings.Split(helpContent, "\n")[1:]
-	fmt.Println(helpHeader)
-	fmt.Println(columnize.Format(content, config))
+	lines := make([]string, len(rows))
+	for i, row := range rows {
+		lines[i] = strings.Join(row, config.Delim)
+	}
+	return columnize.Format(lines, config)
 }
 
 // EnvWrap wraps a func with a setenv call and resets the value at the end
@@ -203,52 +205,6 @@ func GetAppImageRepo(appName string) string {
 	return strings.Join([]string{"clair", appName}, "/")
 }
 
-// GetAppContainerIDs returns a list of docker container ids for given app and optional container_type
-func GetAppContainerIDs(appName string, containerType string) ([]string, error) {
-	var containerIDs []string
-	appRoot := AppRoot(appName)
-	containerFilePath := fmt.Sprintf("%v/CONTAINER", appRoot)
-	_, err := os.Stat(containerFilePath)
-	if !os.IsNotExist(err) {
-		containerIDs = append(containerIDs, ReadFirstLine(containerFilePath))
-	}
-
-	containerPattern := fmt.Sprintf("%v/CONTAINER.*", appRoot)
-	if containerType != "" {
-		containerPattern = fmt.Sprintf("%v/CONTAINER.%v.*", appRoot, containerType)
-		if strings.Contains(".", containerType) {
-			containerPattern = fmt.Sprintf("%v/CONTAINER.%v", appRoot, containerType)
-		}
-	}
-
-	files, _ := filepath.Glob(containerPattern)
-	for _, containerFile := range files {
-		containerIDs = append(containerIDs, ReadFirstLine(containerFile))
-	}
-
-	return containerIDs, nil
-}
-
-// GetAppRunningContainerIDs return a list of running docker container ids for given app and optional container_type
-func GetAppRunningContainerIDs(appName string, containerType string) ([]string, error) {
-	var runningContainerIDs []string
-	if !IsDeployed(appName) {
-		LogFail(fmt.Sprintf("App %v has not been deployed", appName))
-	}
-
-	containerIDs, err := GetAppContainerIDs(appName, containerType)
-	if err != nil {
-		return runningContainerIDs, nil
-	}
-	for _, containerID := range containerIDs {
-		if ContainerIsRunning(containerID) {
-			runningContainerIDs = append(runningContainerIDs, containerID)
-		}
-	}
-
-	return runningContainerIDs, nil
-}
-
 // GetRunningImageTag retrieves current deployed image tag for a given app
 func GetRunningImageTag(appName string, imageTag string) (string, error) {
 	b, err := PluginTriggerOutput("deployed-app-image-tag", []string{appName}...)
@@ -409,8 +365,8 @@ func ParseScaleOutput(b []byte) (map[string]int, error) {
 	return scale, nil
 }
 
-// ReportSingleApp is an internal function that displays a report for an app
-func ReportSingleApp(reportType string, appName string, infoFlag string, infoFlags map[string]string, infoFlagKeys []string, format string, trimPrefix bool, uppercaseFirstCharacter bool) error {
+// ReportSingleApp is an internal function that writes a report for an app to stdout
+func ReportSingleApp(stdout io.Writer, reportType string, appName string, infoFlag string, infoFlags map[string]string, infoFlagKeys []string, format string, trimPrefix bool, uppercaseFirstCharacter bool) error {
 	if format != "stdout" && infoFlag != "" {
 		return errors.New("--format flag cannot be specified when specifying an info flag")
 	}
@@ -430,7 +386,7 @@ func ReportSingleApp(reportType string, appName string, infoFlag string, infoFla
 		if err != nil {
 			return err
 		}
-		Log(string(out))
+		LogTo(stdout, string(out))
 		return nil
 	}
 
@@ -448,7 +404,7 @@ func ReportSingleApp(reportType string, appName string, infoFlag string, infoFla
 	}
 
 	if len(infoFlag) == 0 {
-		LogInfo2Quiet(fmt.Sprintf("%s %v information", appName, reportType))
+		LogInfo2QuietTo(stdout, fmt.Sprintf("%s %v information", appName, reportType))
 		for _, k := range flags {
 			v, ok := infoFlags[k]
 			if !ok {
@@ -466,7 +422,7 @@ func ReportSingleApp(reportType string, appName string, infoFlag string, infoFla
 				key = UcFirst(key)
 			}
 
-			LogVerbose(fmt.Sprintf("%s%s", RightPad(fmt.Sprintf("%s:", key), length, " "), v))
+			LogVerboseTo(stdout, fmt.Sprintf("%s%s", RightPad(fmt.Sprintf("%s:", key), length, " "), v))
 		}
 		return nil
 	}
@@ -477,7 +433,7 @@ func ReportSingleApp(reportType string, appName string, infoFlag string, infoFla
 			if !ok {
 				continue
 			}
-			fmt.Println(v)
+			fmt.Fprintln(stdout, v)
 			return nil
 		}
 	}
@@ -550,8 +506,100 @@ func UcFirst(str string) string {
 	return ""
 }
 
-// IsValidAppName verifies that the app name matches naming restrictions
+const (
+	// AppNamePolicyDNS requires new app names to be valid DNS labels
+	AppNamePolicyDNS = "dns"
+
+	// AppNamePolicyLegacy allows new app names of any length containing dots
+	AppNamePolicyLegacy = "legacy"
+
+	// MaxAppNameLength is the maximum length of a DNS label
+	MaxAppNameLength = 63
+)
+
+// ReservedAppNames cannot be used as app names regardless of the configured reserved names
+var ReservedAppNames = []string{"clair", "default", "localhost", "www"}
+
+// IsValidAppName verifies that the app name matches naming restrictions, the
+// app name policy and is not reserved
 func IsValidAppName(appName string) error {
+	if err := isValidAppNameFormat(appName); err != nil {
+		return err
+	}
+
+	if GetAppNamePolicy() == AppNamePolicyDNS {
+		if err := IsDNSLabel(appName); err != nil {
+			return err
+		}
+	}
+
+	return isReservedAppName(appName)
+}
+
+// GetAppNamePolicy returns the policy new app names are validated against
+func GetAppNamePolicy() string {
+	if PropertyGet("apps", "--global", "app-name-policy") == AppNamePolicyLegacy {
+		return AppNamePolicyLegacy
+	}
+	return AppNamePolicyDNS
+}
+
+// IsDNSLabel verifies that the app name can be used as a DNS label
+func IsDNSLabel(appName string) error {
+	if len(appName) > MaxAppNameLength {
+		return fmt.Errorf("App name must be at most %d characters long", MaxAppNameLength)
+	}
+
+	r, _ := regexp.Compile("^[a-z0-9]([a-z0-9-]*[a-z0-9])?$")
+	if !r.MatchString(appName) {
+		return errors.New("App name may only contain lowercase alphanumeric characters and hyphens, and cannot end with a hyphen")
+	}
+	return nil
+}
+
+// GenerateDNSAppName converts an app name into a DNS label, appending a numeric
+// suffix until the name is not taken
+func GenerateDNSAppName(appName string, taken map[string]bool) string {
+	name := strings.ToLower(appName)
+	r, _ := regexp.Compile("[^a-z0-9]+")
+	name = strings.Trim(r.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		name = "app"
+	}
+
+	candidate := truncateAppName(name, MaxAppNameLength)
+	for i := 2; taken[candidate] || isReservedAppName(candidate) != nil; i++ {
+		suffix := fmt.Sprintf("-%d", i)
+		candidate = truncateAppName(name, MaxAppNameLength-len(suffix)) + suffix
+	}
+	return candidate
+}
+
+func truncateAppName(appName string, length int) string {
+	if len(appName) > length {
+		appName = appName[:length]
+	}
+	return strings.TrimRight(appName, "-")
+}
+
+func isReservedAppName(appName string) error {
+	reserved := append([]string{}, ReservedAppNames...)
+	for _, pattern := range strings.Split(PropertyGet("apps", "--global", "reserved-app-names"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			reserved = append(reserved, pattern)
+		}
+	}
+
+	for _, pattern := range reserved {
+		if matched, _ := path.Match(pattern, appName); matched {
+			return fmt.Errorf("App name %s is reserved", appName)
+		}
+	}
+	return nil
+}
+
+// isValidAppNameFormat verifies that the app name matches the naming restrictions
+func isValidAppNameFormat(appName string) error {
 	if appName == "" {
 		return errors.New("Please specify an app to run the command on")
 	}
@@ -597,9 +645,10 @@ func (err *AppDoesNotExist) Error() string {
 }
 
 // VerifyAppName checks if an app conforming to either the old or new
-// naming conventions exists
+// naming conventions exists. Aliases are not apps, callers accepting them
+// resolve them with ResolveAppName first.
 func VerifyAppName(appName string) error {
-	newErr := IsValidAppName(appName)
+	newErr := isValidAppNameFormat(appName)
 	oldErr := isValidAppNameOld(appName)
 	if newErr != nil && oldErr != nil {
 		return newErr
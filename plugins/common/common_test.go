@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -116,3 +117,52 @@ func TestCommonStripInlineComments(t *testing.T) {
 	text := StripInlineComments(strings.Join([]string{testEnvLine, "# testing comment"}, " "))
 	Expect(text).To(Equal(testEnvLine))
 }
+
+func TestCommonIsValidAppNamePolicy(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	Expect(IsValidAppName(testAppName)).To(Succeed())
+	Expect(IsValidAppName("app.example.com")).To(HaveOccurred())
+	Expect(IsValidAppName("app-")).To(HaveOccurred())
+	Expect(IsValidAppName(strings.Repeat("a", 64))).To(MatchError("App name must be at most 63 characters long"))
+	Expect(IsValidAppName("localhost")).To(MatchError("App name localhost is reserved"))
+
+	Expect(PropertyWrite("apps", "--global", "app-name-policy", AppNamePolicyLegacy)).To(Succeed())
+	Expect(PropertyWrite("apps", "--global", "reserved-app-names", "internal-*")).To(Succeed())
+	Expect(IsValidAppName("app.example.com")).To(Succeed())
+	Expect(IsValidAppName("internal-api")).To(MatchError("App name internal-api is reserved"))
+}
+
+func TestCommonGenerateDNSAppName(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	Expect(GenerateDNSAppName("app.example.com", map[string]bool{})).To(Equal("app-example-com"))
+	Expect(GenerateDNSAppName("legacy__app-", map[string]bool{})).To(Equal("legacy-app"))
+	Expect(GenerateDNSAppName("legacy_app", map[string]bool{"legacy-app": true, "legacy-app-2": true})).To(Equal("legacy-app-3"))
+	Expect(GenerateDNSAppName("www.", map[string]bool{})).To(Equal("www-2"))
+
+	name := GenerateDNSAppName(strings.Repeat("a", 70), map[string]bool{strings.Repeat("a", 63): true})
+	Expect(name).To(HaveLen(63))
+	Expect(name).To(HaveSuffix("-2"))
+	Expect(IsDNSLabel(name)).To(Succeed())
+}
+
+func TestCommonReportSingleApp(t *testing.T) {
+	RegisterTestingT(t)
+	infoFlags := map[string]string{"--app-locked": "false", "--app-deploy-source": "git"}
+	infoFlagKeys := []string{"--app-locked", "--app-deploy-source"}
+
+	var stdout bytes.Buffer
+	Expect(ReportSingleApp(&stdout, "app", testAppName, "", infoFlags, infoFlagKeys, "json", false, true)).To(Succeed())
+	Expect(stdout.String()).To(Equal(`{"app-deploy-source":"git","app-locked":"false"}` + "\n"))
+
+	stdout.Reset()
+	Expect(ReportSingleApp(&stdout, "app", testAppName, "--app-deploy-source", infoFlags, infoFlagKeys, "stdout", false, true)).To(Succeed())
+	Expect(stdout.String()).To(Equal("git\n"))
+}
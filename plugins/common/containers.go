@@ -0,0 +1,241 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AppNameLabel is the container and image label holding the app name
+	AppNameLabel = "com.clair.app-name"
+
+	// ProcessTypeLabel is the container label holding the process type
+	ProcessTypeLabel = "com.clair.process-type"
+
+	// ContainerIndexLabel is the container label holding the process index
+	ContainerIndexLabel = "com.clair.container-index"
+
+	// ImageStageLabel is the image label holding the build stage of an image
+	ImageStageLabel = "com.clair.image-stage"
+
+	// ImageStageRelease is the build stage of images that have been released
+	ImageStageRelease = "release"
+)
+
+// ContainerInfo contains the indexed information for a single app container
+type ContainerInfo struct {
+	ID          string    `json:"id"`
+	ProcessType string    `json:"process_type"`
+	Index       int       `json:"index"`
+	State       string    `json:"state"`
+	Image       string    `json:"image"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
+// IsRunning returns true if the container is in the running state
+func (c ContainerInfo) IsRunning() bool {
+	return c.State == "running"
+}
+
+type containerInspectResult struct {
+	ID     string `json:"Id"`
+	Name   string `json:"Name"`
+	Image  string `json:"Image"`
+	Config struct {
+		Image  string            `json:"Image"`
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status    string `json:"Status"`
+		StartedAt string `json:"StartedAt"`
+	} `json:"State"`
+}
+
+// ContainerIndex returns all containers for an app as labeled by the scheduler,
+// optionally filtered by a container type of the form `web` or `web.1`
+func ContainerIndex(appName string, containerType string) ([]ContainerInfo, error) {
+	containers := []ContainerInfo{}
+	filters := []string{fmt.Sprintf("label=%s=%s", AppNameLabel, appName)}
+	processType, index := splitContainerType(containerType)
+	if processType != "" {
+		filters = append(filters, fmt.Sprintf("label=%s=%s", ProcessTypeLabel, processType))
+	}
+
+	containerIDs, err := GetContainerRuntime().ContainerList(NewListOptions(true, filters...))
+	if err != nil {
+		return containers, err
+	}
+	if len(containerIDs) == 0 {
+		return containers, nil
+	}
+
+	results, err := inspectContainers(containerIDs)
+	if err != nil {
+		return containers, err
+	}
+
+	for _, result := range results {
+		container := newContainerInfo(result)
+		if index > 0 && container.Index != index {
+			continue
+		}
+		containers = append(containers, container)
+	}
+
+	sort.SliceStable(containers, func(i, j int) bool {
+		if containers[i].ProcessType == containers[j].ProcessType {
+			return containers[i].Index < containers[j].Index
+		}
+		return containers[i].ProcessType < containers[j].ProcessType
+	})
+
+	return containers, nil
+}
+
+// GetAppContainerIDs returns a list of docker container ids for given app and optional container_type
+func GetAppContainerIDs(appName string, containerType string) ([]string, error) {
+	var containerIDs []string
+	containers, err := ContainerIndex(appName, containerType)
+	if err == nil && len(containers) > 0 {
+		for _, container := range containers {
+			containerIDs = append(containerIDs, container.ID)
+		}
+		return containerIDs, nil
+	}
+
+	return getAppContainerIDsFromFiles(appName, containerType), nil
+}
+
+// GetAppRunningContainerIDs return a list of running docker container ids for given app and optional container_type
+func GetAppRunningContainerIDs(appName string, containerType string) ([]string, error) {
+	var runningContainerIDs []string
+	if !IsDeployed(appName) {
+		LogFail(fmt.Sprintf("App %v has not been deployed", appName))
+	}
+
+	containers, err := ContainerIndex(appName, containerType)
+	if err == nil && len(containers) > 0 {
+		for _, container := range containers {
+			if container.IsRunning() {
+				runningContainerIDs = append(runningContainerIDs, container.ID)
+			}
+		}
+		return runningContainerIDs, nil
+	}
+
+	for _, containerID := range getAppContainerIDsFromFiles(appName, containerType) {
+		if ContainerIsRunning(containerID) {
+			runningContainerIDs = append(runningContainerIDs, containerID)
+		}
+	}
+
+	return runningContainerIDs, nil
+}
+
+// getAppContainerIDsFromFiles reads container ids from the legacy CONTAINER files
+func getAppContainerIDsFromFiles(appName string, containerType string) []string {
+	var containerIDs []string
+	appRoot := AppRoot(appName)
+	containerFilePath := fmt.Sprintf("%v/CONTAINER", appRoot)
+	_, err := os.Stat(containerFilePath)
+	if !os.IsNotExist(err) {
+		containerIDs = append(containerIDs, ReadFirstLine(containerFilePath))
+	}
+
+	containerPattern := fmt.Sprintf("%v/CONTAINER.*", appRoot)
+	if containerType != "" {
+		containerPattern = fmt.Sprintf("%v/CONTAINER.%v.*", appRoot, containerType)
+		if strings.Contains(containerType, ".") {
+			containerPattern = fmt.Sprintf("%v/CONTAINER.%v", appRoot, containerType)
+		}
+	}
+
+	files, _ := filepath.Glob(containerPattern)
+	for _, containerFile := range files {
+		containerIDs = append(containerIDs, ReadFirstLine(containerFile))
+	}
+
+	return containerIDs
+}
+
+func inspectContainers(containerIDs []string) ([]containerInspectResult, error) {
+	results := []containerInspectResult{}
+	runtime := GetContainerRuntime()
+	for _, containerID := range containerIDs {
+		b, err := runtime.ContainerInspect(containerID)
+		if err != nil {
+			return results, err
+		}
+
+		var result containerInspectResult
+		if err := json.Unmarshal(b, &result); err != nil {
+			return results, fmt.Errorf("Unable to parse container inspect output: %v", err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func newContainerInfo(result containerInspectResult) ContainerInfo {
+	labels := result.Config.Labels
+	name := strings.TrimPrefix(result.Name, "/")
+	nameProcessType, nameIndex := splitContainerName(name)
+
+	processType := labels[ProcessTypeLabel]
+	if processType == "" {
+		processType = nameProcessType
+	}
+
+	index := ToInt(labels[ContainerIndexLabel], 0)
+	if index == 0 {
+		index = nameIndex
+	}
+
+	image := result.Config.Image
+	if image == "" {
+		image = result.Image
+	}
+
+	startedAt, _ := time.Parse(time.RFC3339Nano, result.State.StartedAt)
+	return ContainerInfo{
+		ID:          result.ID,
+		ProcessType: processType,
+		Index:       index,
+		State:       result.State.Status,
+		Image:       image,
+		StartedAt:   startedAt,
+	}
+}
+
+// splitContainerName extracts the process type and index from a
+// scheduler container name of the form `app.web.1`
+func splitContainerName(name string) (string, int) {
+	parts := strings.Split(name, ".")
+	if len(parts) < 3 {
+		return "", 0
+	}
+
+	index, err := strconv.Atoi(parts[len(parts)-1])
+	if err != nil {
+		return "", 0
+	}
+
+	return parts[len(parts)-2], index
+}
+
+// splitContainerType splits a container type of the form `web` or `web.1`
+func splitContainerType(containerType string) (string, int) {
+	if !strings.Contains(containerType, ".") {
+		return containerType, 0
+	}
+
+	parts := strings.SplitN(containerType, ".", 2)
+	return parts[0], ToInt(parts[1], 0)
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonSplitContainerName(t *testing.T) {
+	RegisterTestingT(t)
+	processType, index := splitContainerName("test-app-1.web.2")
+	Expect(processType).To(Equal("web"))
+	Expect(index).To(Equal(2))
+
+	processType, index = splitContainerName("test-app-1")
+	Expect(processType).To(Equal(""))
+	Expect(index).To(Equal(0))
+}
+
+func TestCommonSplitContainerType(t *testing.T) {
+	RegisterTestingT(t)
+	processType, index := splitContainerType("web")
+	Expect(processType).To(Equal("web"))
+	Expect(index).To(Equal(0))
+
+	processType, index = splitContainerType("worker.3")
+	Expect(processType).To(Equal("worker"))
+	Expect(index).To(Equal(3))
+}
+
+func TestCommonNewContainerInfo(t *testing.T) {
+	RegisterTestingT(t)
+	result := containerInspectResult{ID: "abc123", Name: "/test-app-1.web.1", Image: "sha256:123"}
+	result.Config.Image = "clair/test-app-1:latest"
+	result.Config.Labels = map[string]string{AppNameLabel: testAppName}
+	result.State.Status = "running"
+	result.State.StartedAt = "2023-07-30T14:43:25.123456789Z"
+
+	container := newContainerInfo(result)
+	Expect(container.ID).To(Equal("abc123"))
+	Expect(container.ProcessType).To(Equal("web"))
+	Expect(container.Index).To(Equal(1))
+	Expect(container.Image).To(Equal("clair/test-app-1:latest"))
+	Expect(container.IsRunning()).To(BeTrue())
+	Expect(container.StartedAt.Year()).To(Equal(2023))
+
+	result.Config.Labels[ProcessTypeLabel] = "worker"
+	result.Config.Labels[ContainerIndexLabel] = "4"
+	container = newContainerInfo(result)
+	Expect(container.ProcessType).To(Equal("worker"))
+	Expect(container.Index).To(Equal(4))
+}
@@ -0,0 +1,211 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// CopyFromImageOptions contains the settings used when copying content out of an image
+type CopyFromImageOptions struct {
+	// NormalizeNewlines converts CRLF line endings to LF and ensures text files end with a newline
+	NormalizeNewlines bool
+
+	// AllowEmpty permits copying empty files
+	AllowEmpty bool
+}
+
+// CopyFromImage copies a single file from an image to the destination path,
+// normalizing newlines along the way
+func CopyFromImage(appName string, image string, source string, destination string) error {
+	tmpDir, err := ioutil.TempDir(os.TempDir(), fmt.Sprintf("clair-%s-%s", MustGetEnv("CLAIR_PID"), "CopyFromImage"))
+	if err != nil {
+		return fmt.Errorf("Cannot create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	options := CopyFromImageOptions{NormalizeNewlines: true}
+	if err := CopyFromImageBatch(appName, image, []string{source}, tmpDir, options); err != nil {
+		return err
+	}
+
+	copied := filepath.Join(tmpDir, path.Base(source))
+	fi, err := os.Stat(copied)
+	if err != nil {
+		return fmt.Errorf("Unable to copy file %s from image", source)
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("Unable to copy file %s from image: source is a directory", source)
+	}
+
+	b, err := ioutil.ReadFile(copied)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(destination, b, 0644)
+}
+
+// CopyFromImageBatch copies a list of files or directories from an image into the
+// destination directory using a single temporary container. Each source is written
+// to the destination under its base name, with directories copied recursively.
+func CopyFromImageBatch(appName string, image string, sources []string, destination string, options CopyFromImageOptions) error {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	if !VerifyImage(image) {
+		return fmt.Errorf("Invalid docker image for copying content")
+	}
+
+	if err := os.MkdirAll(destination, 0755); err != nil {
+		return fmt.Errorf("Unable to create destination directory: %v", err)
+	}
+
+	workDir := ""
+	for _, source := range sources {
+		if !IsAbsPath(source) {
+			workDir = imageWorkDir(appName, image)
+			break
+		}
+	}
+
+	globalRunArgs := ShellSplit(os.Getenv("CLAIR_GLOBAL_RUN_ARGS"))
+	createLabelArgs := append([]string{"--label", fmt.Sprintf("%s=%s", AppNameLabel, appName)}, globalRunArgs...)
+	containerID, err := DockerContainerCreate(image, createLabelArgs)
+	if err != nil {
+		return fmt.Errorf("Unable to create temporary container: %v", err)
+	}
+	defer GetContainerRuntime().ContainerRemove(containerID, true)
+
+	for _, source := range sources {
+		if !IsAbsPath(source) && workDir != "" {
+			source = fmt.Sprintf("%s/%s", workDir, source)
+		}
+
+		if err := copyFromContainer(containerID, source, destination, options); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NormalizeNewlines converts CRLF line endings to LF and appends a trailing
+// newline to non-empty content. Binary content is returned unchanged.
+func NormalizeNewlines(b []byte) []byte {
+	if len(b) == 0 || bytes.IndexByte(b, 0) != -1 {
+		return b
+	}
+
+	b = bytes.ReplaceAll(b, []byte("\r\n"), []byte("\n"))
+	if b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	return b
+}
+
+func copyFromContainer(containerID string, source string, destination string, options CopyFromImageOptions) error {
+	archive, err := GetContainerRuntime().ContainerCopyFrom(containerID, source)
+	if err != nil {
+		return fmt.Errorf("Unable to copy %s from image: %v", source, err)
+	}
+	defer archive.Close()
+
+	copied, err := extractTar(archive, destination, options)
+	if err != nil {
+		return fmt.Errorf("Unable to copy %s from image: %v", source, err)
+	}
+	if copied == 0 {
+		return fmt.Errorf("Unable to copy %s from image", source)
+	}
+
+	return nil
+}
+
+// extractTar writes the regular files and directories of a tar stream into the
+// destination, rejecting entries that would escape it and skipping links
+func extractTar(r io.Reader, destination string, options CopyFromImageOptions) (int, error) {
+	copied := 0
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return copied, err
+		}
+
+		target, err := tarEntryPath(destination, header.Name)
+		if err != nil {
+			return copied, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return copied, err
+			}
+			copied++
+		case tar.TypeReg:
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return copied, err
+			}
+			if len(b) == 0 && !options.AllowEmpty {
+				return copied, fmt.Errorf("file %s is empty", header.Name)
+			}
+			if options.NormalizeNewlines {
+				b = NormalizeNewlines(b)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return copied, err
+			}
+			mode := os.FileMode(header.Mode).Perm()
+			if mode == 0 {
+				mode = 0644
+			}
+			if err := ioutil.WriteFile(target, b, mode); err != nil {
+				return copied, err
+			}
+			copied++
+		default:
+			LogDebug(fmt.Sprintf("Skipping unsupported tar entry %s", header.Name))
+		}
+	}
+
+	return copied, nil
+}
+
+func tarEntryPath(destination string, name string) (string, error) {
+	if strings.Contains(name, "\x00") {
+		return "", fmt.Errorf("invalid tar entry %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("tar entry %q escapes the destination", name)
+		}
+	}
+
+	return filepath.Join(destination, filepath.FromSlash(path.Clean("/"+name))), nil
+}
+
+func imageWorkDir(appName string, image string) string {
+	if IsImageCnbBased(image) {
+		return "/workspace"
+	}
+	if IsImageHerokuishBased(image, appName) {
+		return "/app"
+	}
+
+	workDir, _ := DockerInspect(image, "{{.Config.WorkingDir}}")
+	return workDir
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonCopyFromImageBatch(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.Images["sha256:1111"].Files = map[string]string{
+		"/workspace/Procfile":         "web: ./server\r\n",
+		"/workspace/.clair/app.json":  "{}",
+		"/workspace/.clair/empty.txt": "",
+		"/etc/hostname":               "test\n",
+	}
+
+	destination, err := ioutil.TempDir("", "copy-from-image")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(destination)
+
+	options := CopyFromImageOptions{NormalizeNewlines: true, AllowEmpty: true}
+	Expect(CopyFromImageBatch(testAppName, "clair/test-app-1", []string{"Procfile", ".clair", "/etc/hostname"}, destination, options)).To(Succeed())
+
+	b, err := ioutil.ReadFile(filepath.Join(destination, "Procfile"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(Equal("web: ./server\n"))
+	b, err = ioutil.ReadFile(filepath.Join(destination, ".clair", "app.json"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(Equal("{}\n"))
+	Expect(filepath.Join(destination, ".clair", "empty.txt")).To(BeAnExistingFile())
+	Expect(filepath.Join(destination, "hostname")).To(BeAnExistingFile())
+
+	Expect(CopyFromImageBatch(testAppName, "clair/test-app-1", []string{".clair"}, destination, CopyFromImageOptions{})).NotTo(Succeed())
+	Expect(CopyFromImageBatch(testAppName, "clair/test-app-1", []string{"missing"}, destination, options)).NotTo(Succeed())
+
+	containers, err := runtime.ContainerList(ListOptions{All: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(containers).To(HaveLen(2))
+}
+
+func TestCommonNormalizeNewlines(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(string(NormalizeNewlines([]byte("a\r\nb")))).To(Equal("a\nb\n"))
+	Expect(string(NormalizeNewlines([]byte("a\n")))).To(Equal("a\n"))
+	Expect(NormalizeNewlines([]byte{})).To(BeEmpty())
+	Expect(NormalizeNewlines([]byte("a\x00\r\n"))).To(Equal([]byte("a\x00\r\n")))
+}
+
+func TestCommonExtractTarRejectsTraversal(t *testing.T) {
+	RegisterTestingT(t)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	Expect(tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})).To(Succeed())
+	_, err := tw.Write([]byte("x"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tw.Close()).To(Succeed())
+
+	destination, err := ioutil.TempDir("", "extract-tar")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(destination)
+
+	_, err = extractTar(&buf, destination, CopyFromImageOptions{})
+	Expect(err).To(HaveOccurred())
+	Expect(filepath.Join(filepath.Dir(destination), "evil")).NotTo(BeAnExistingFile())
+}
@@ -2,29 +2,32 @@ package common
 
 import (
 	"bytes"
-	"errors"
+	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"strings"
-	"time"
-
-	"github.com/codeskyblue/go-sh"
+	"text/template"
 )
 
 func ContainerIsRunning(containerID string) bool {
-	b, err := DockerInspect(containerID, "'{{.State.Running}}'")
+	b, err := GetContainerRuntime().ContainerInspect(containerID)
 	if err != nil {
 		return false
 	}
-	return strings.TrimSpace(string(b[:])) == "true"
+
+	var result struct {
+		State struct {
+			Running bool `json:"Running"`
+		} `json:"State"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return false
+	}
+	return result.State.Running
 }
 
 func ContainerStart(containerID string) bool {
-	cmd := sh.Command(DockerBin(), "container", "start", containerID)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	if err := cmd.Run(); err != nil {
+	if err := GetContainerRuntime().ContainerStart(containerID); err != nil {
 		return false
 	}
 
@@ -32,129 +35,29 @@ func ContainerStart(containerID string) bool {
 }
 
 func ContainerExists(containerID string) bool {
-	cmd := sh.Command(DockerBin(), "container", "inspect", containerID)
-	cmd.Stdout = nil
-	cmd.Stderr = nil
-	if err := cmd.Run(); err != nil {
+	if _, err := GetContainerRuntime().ContainerInspect(containerID); err != nil {
 		return false
 	}
 
 	return true
 }
 
-func ContainerWaitTilReady(containerID string, timeout time.Duration) error {
-	time.Sleep(timeout)
-
-	if !ContainerIsRunning(containerID) {
-		return fmt.Errorf("Container %s is not running", containerID)
-	}
-
-	return nil
-}
-
-func CopyFromImage(appName string, image string, source string, destination string) error {
-	if !VerifyImage(image) {
-		return fmt.Errorf("Invalid docker image for copying content")
-	}
-
-	workDir := ""
-	if !IsAbsPath(source) {
-		if IsImageCnbBased(image) {
-			workDir = "/workspace"
-		} else if IsImageHerokuishBased(image, appName) {
-			workDir = "/app"
-		} else {
-			workDir, _ = DockerInspect(image, "{{.Config.WorkingDir}}")
-		}
-
-		if workDir != "" {
-			source = fmt.Sprintf("%s/%s", workDir, source)
-		}
-	}
-
-	tmpFile, err := ioutil.TempFile(os.TempDir(), fmt.Sprintf("clair-%s-%s", MustGetEnv("CLAIR_PID"), "CopyFromImage"))
-	if err != nil {
-		return fmt.Errorf("Cannot create temporary file: %v", err)
-	}
-
-	defer tmpFile.Close()
-	defer os.Remove(tmpFile.Name())
-
-	globalRunArgs := MustGetEnv("CLAIR_GLOBAL_RUN_ARGS")
-	createLabelArgs := []string{"--label", fmt.Sprintf("com.clair.app-name=%s", appName), globalRunArgs}
-	containerID, err := DockerContainerCreate(image, createLabelArgs)
-	if err != nil {
-		return fmt.Errorf("Unable to create temporary container: %v", err)
-	}
-
-	containerCopyCmd := NewShellCmd(strings.Join([]string{
-		DockerBin(),
-		"container",
-		"cp",
-		fmt.Sprintf("%s:%s", containerID, source),
-		tmpFile.Name(),
-	}, " "))
-	containerCopyCmd.ShowOutput = false
-	fileCopied := containerCopyCmd.Execute()
-
-	containerRemoveCmd := NewShellCmd(strings.Join([]string{
-		DockerBin(),
-		"container",
-		"rm",
-		"--force",
-		containerID,
-	}, " "))
-	containerRemoveCmd.ShowOutput = false
-	containerRemoveCmd.Execute()
-
-	if !fileCopied {
-		return fmt.Errorf("Unable to copy file %s from image", source)
-	}
-
-	fi, err := os.Stat(tmpFile.Name())
-	if err != nil {
-		return err
-	}
-
-	if fi.Size() == 0 {
-		return fmt.Errorf("Unable to copy file %s from image", source)
-	}
-
-	dos2unixCmd := NewShellCmd(strings.Join([]string{
-		"dos2unix",
-		"-l",
-		"-n",
-		tmpFile.Name(),
-		destination,
-	}, " "))
-	dos2unixCmd.ShowOutput = false
-	dos2unixCmd.Execute()
-
-	b, err := sh.Command("tail", "-c1", destination).Output()
-	if string(b) != "" {
-		f, err := os.OpenFile(destination, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		if _, err := f.WriteString("\n"); err != nil {
-			return fmt.Errorf("Unable to append trailing newline to copied file: %v", err)
-		}
-	}
-
-	return nil
-}
-
 func DockerBin() string {
 	dockerBin := os.Getenv("DOCKER_BIN")
 	if dockerBin == "" {
 		dockerBin = "docker"
+		if profile, err := GetRuntimeProfile(); err == nil {
+			dockerBin = profile.Command
+		}
 	}
 
 	return dockerBin
 }
 
-func DockerCleanup(appName string, forceCleanup bool) error {
+// DockerCleanup removes exited containers, dangling images and any unused app images
+// not kept by the image retention policy. Forced cleanups ignore CLAIR_SKIP_CLEANUP
+// and the retention policy, and dry runs only report what would be removed.
+func DockerCleanup(appName string, forceCleanup bool, dryRun bool) error {
 	if !forceCleanup {
 		skipCleanup := false
 		if appName != "" {
@@ -178,60 +81,93 @@ func DockerCleanup(appName string, forceCleanup bool) error {
 		}
 	}
 
-	LogInfo1("Cleaning up...")
+	if dryRun {
+		LogInfo1("Cleaning up (dry run)...")
+	} else {
+		LogInfo1("Cleaning up...")
+	}
 	if appName == "--global" {
 		appName = ""
 	}
 
+	policy := ImageRetentionPolicy{}
+	if !forceCleanup {
+		var err error
+		if policy, err = GetImageRetentionPolicy(appName); err != nil {
+			return err
+		}
+	}
+
 	exitedContainerIDs, _ := listContainers("exited", appName)
 	deadContainerIDs, _ := listContainers("dead", appName)
 	containerIDs := append(exitedContainerIDs, deadContainerIDs...)
 
+	imageIDs, _ := ListDanglingImages(appName)
+	if dryRun {
+		return dockerCleanupDryRun(appName, containerIDs, imageIDs, policy)
+	}
+
 	if len(containerIDs) > 0 {
 		removeContainers(containerIDs)
 	}
 
-	imageIDs, _ := ListDanglingImages(appName)
 	if len(imageIDs) > 0 {
 		RemoveImages(imageIDs)
 	}
 
-	if appName != "" {
-		// delete unused images
+	if appName == "" {
+		return nil
+	}
+
+	if forceCleanup {
+		// delete unused images, including those kept for rollbacks
 		pruneUnusedImages(appName)
+		return nil
+	}
+
+	images, err := ImageRetentionCandidates(appName, policy)
+	if err != nil {
+		return err
 	}
+	RemoveImageInfos(appName, images)
 
 	return nil
 }
 
 func DockerContainerCreate(image string, containerCreateArgs []string) (string, error) {
-	cmd := []string{
-		DockerBin(),
-		"container",
-		"create",
+	options, err := ParseContainerCreateArgs(containerCreateArgs)
+	if err != nil {
+		return "", err
 	}
 
-	cmd = append(cmd, containerCreateArgs...)
-	cmd = append(cmd, image)
+	return GetContainerRuntime().ContainerCreate(image, options)
+}
 
-	var stderr bytes.Buffer
-	containerCreateCmd := NewShellCmd(strings.Join(cmd, " "))
-	containerCreateCmd.ShowOutput = false
-	containerCreateCmd.Command.Stderr = &stderr
-	b, err := containerCreateCmd.Output()
+func DockerInspect(containerOrImageID, format string) (output string, err error) {
+	runtime := GetContainerRuntime()
+	b, err := runtime.ContainerInspect(containerOrImageID)
 	if err != nil {
-		return "", errors.New(strings.TrimSpace(stderr.String()))
+		if b, err = runtime.ImageInspect(containerOrImageID); err != nil {
+			return "", err
+		}
 	}
 
-	return strings.TrimSpace(string(b[:])), nil
-}
+	data, err := decodeInspect(b)
+	if err != nil {
+		return "", err
+	}
 
-func DockerInspect(containerOrImageID, format string) (output string, err error) {
-	b, err := sh.Command(DockerBin(), "inspect", "--format", format, containerOrImageID).Output()
+	tmpl, err := template.New("inspect").Option("missingkey=zero").Funcs(inspectTemplateFuncs).Parse(format)
 	if err != nil {
+		return "", fmt.Errorf("Invalid inspect format: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		return "", err
 	}
-	output = strings.TrimSpace(string(b[:]))
+
+	output = strings.TrimSpace(buf.String())
 	if strings.HasPrefix(output, "'") && strings.HasSuffix(output, "'") {
 		output = strings.TrimSuffix(strings.TrimPrefix(output, "'"), "'")
 	}
@@ -279,116 +215,100 @@ func IsImageHerokuishBased(image string, appName string) bool {
 }
 
 func ListDanglingImages(appName string) ([]string, error) {
-	command := []string{
-		DockerBin(),
-		"image",
-		"list",
-		"--quiet",
-		"--filter",
-		"dangling=true",
-	}
-
+	filters := []string{"dangling=true"}
 	if appName != "" {
-		command = append(command, []string{"--filter", fmt.Sprintf("label=com.clair.app-name=%v", appName)}...)
+		filters = append(filters, fmt.Sprintf("label=%s=%v", AppNameLabel, appName))
 	}
 
-	var stderr bytes.Buffer
-	listCmd := NewShellCmd(strings.Join(command, " "))
-	listCmd.ShowOutput = false
-	listCmd.Command.Stderr = &stderr
-	b, err := listCmd.Output()
+	return GetContainerRuntime().ImageList(NewListOptions(false, filters...))
+}
 
-	if err != nil {
-		return []string{}, errors.New(strings.TrimSpace(stderr.String()))
+func RemoveImages(imageIDs []string) {
+	runtime := GetContainerRuntime()
+	for _, imageID := range imageIDs {
+		if imageID == "" {
+			continue
+		}
+		if err := runtime.ImageRemove(imageID); err != nil {
+			LogDebug(fmt.Sprintf("Unable to remove image %s: %s", imageID, err.Error()))
+		}
 	}
+}
 
-	output := strings.Split(strings.TrimSpace(string(b[:])), "\n")
-	return output, nil
+func VerifyImage(image string) bool {
+	if _, err := GetContainerRuntime().ImageInspect(image); err != nil {
+		return false
+	}
+
+	return true
 }
 
-func RemoveImages(imageIDs []string) {
-	command := []string{
-		DockerBin(),
-		"image",
-		"rm",
+func dockerCleanupDryRun(appName string, containerIDs []string, danglingImageIDs []string, policy ImageRetentionPolicy) error {
+	for _, containerID := range containerIDs {
+		if containerID != "" {
+			LogVerbose(fmt.Sprintf("Would remove container %s", containerID))
+		}
 	}
 
-	command = append(command, imageIDs...)
+	images, err := InspectImages(danglingImageIDs)
+	if err != nil {
+		return err
+	}
 
-	var stderr bytes.Buffer
-	rmCmd := NewShellCmd(strings.Join(command, " "))
-	rmCmd.ShowOutput = false
-	rmCmd.Command.Stderr = &stderr
-	rmCmd.Execute()
-}
+	if appName != "" {
+		candidates, err := ImageRetentionCandidates(appName, policy)
+		if err != nil {
+			return err
+		}
+		images = append(images, candidates...)
+	}
 
-func VerifyImage(image string) bool {
-	imageCmd := NewShellCmd(strings.Join([]string{DockerBin(), "image", "inspect", image}, " "))
-	imageCmd.ShowOutput = false
-	return imageCmd.Execute()
+	var reclaimed int64
+	for _, image := range images {
+		reference := image.ID
+		if len(image.Tags) > 0 {
+			reference = strings.Join(image.Tags, ", ")
+		}
+		LogVerbose(fmt.Sprintf("Would remove image %s (%s)", reference, FormatBytes(image.Size)))
+		reclaimed += image.Size
+	}
+
+	LogInfo2(fmt.Sprintf("Would remove %d containers and %d images, reclaiming %s", len(containerIDs), len(images), FormatBytes(reclaimed)))
+	return nil
 }
 
 func listContainers(status string, appName string) ([]string, error) {
-	command := []string{
-		DockerBin(),
-		"container",
-		"list",
-		"--quiet",
-		"--all",
-		"--filter",
+	filters := []string{
 		fmt.Sprintf("status=%v", status),
-		"--filter",
 		fmt.Sprintf("label=%v", os.Getenv("CLAIR_CONTAINER_LABEL")),
 	}
 
 	if appName != "" {
-		command = append(command, []string{"--filter", fmt.Sprintf("label=com.clair.app-name=%v", appName)}...)
+		filters = append(filters, fmt.Sprintf("label=%s=%v", AppNameLabel, appName))
 	}
 
-	var stderr bytes.Buffer
-	listCmd := NewShellCmd(strings.Join(command, " "))
-	listCmd.ShowOutput = false
-	listCmd.Command.Stderr = &stderr
-	b, err := listCmd.Output()
-
-	if err != nil {
-		return []string{}, errors.New(strings.TrimSpace(stderr.String()))
-	}
-
-	output := strings.Split(strings.TrimSpace(string(b[:])), "\n")
-	return output, nil
+	return GetContainerRuntime().ContainerList(NewListOptions(true, filters...))
 }
 
 func pruneUnusedImages(appName string) {
-	command := []string{
-		DockerBin(),
-		"image",
-		"prune",
-		"--all",
-		"--force",
-		"--filter",
-		fmt.Sprintf("label=com.clair.app-name=%v", appName),
-	}
-
-	var stderr bytes.Buffer
-	pruneCmd := NewShellCmd(strings.Join(command, " "))
-	pruneCmd.ShowOutput = false
-	pruneCmd.Command.Stderr = &stderr
-	pruneCmd.Execute()
+	filters := map[string][]string{
+		"dangling": {"false"},
+		"label":    {fmt.Sprintf("%s=%v", AppNameLabel, appName)},
+	}
+
+	if err := GetContainerRuntime().ImagePrune(filters); err != nil {
+		LogDebug(fmt.Sprintf("Unable to prune images for %s: %s", appName, err.Error()))
+	}
 }
 
 func removeContainers(containerIDs []string) {
-	command := []string{
-		DockerBin(),
-		"container",
-		"rm",
+	runtime := GetContainerRuntime()
+	for _, containerID := range containerIDs {
+		if containerID == "" {
+			continue
+		}
+		if err := runtime.ContainerRemove(containerID, false); err != nil {
+			LogDebug(fmt.Sprintf("Unable to remove container %s: %s", containerID, err.Error()))
+		}
 	}
-
-	command = append(command, containerIDs...)
-
-	var stderr bytes.Buffer
-	rmCmd := NewShellCmd(strings.Join(command, " "))
-	rmCmd.ShowOutput = false
-	rmCmd.Command.Stderr = &stderr
-	rmCmd.Execute()
 }
@@ -0,0 +1,487 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	dockerAPIVersion  = "v1.41"
+	dockerDefaultHost = "unix:///var/run/docker.sock"
+
+	// dockerAPITimeout bounds requests whose response is read at once. Requests
+	// streaming images or archives run for as long as the transfer takes.
+	dockerAPITimeout = time.Minute
+)
+
+// DockerAPIRuntime implements ContainerRuntime using the Docker Engine HTTP API
+type DockerAPIRuntime struct {
+	client  *http.Client
+	baseURL string
+}
+
+type dockerAPIError struct {
+	Message string `json:"message"`
+}
+
+// DockerHost returns the docker engine endpoint
+func DockerHost() string {
+	return GetenvWithDefault("DOCKER_HOST", dockerDefaultHost)
+}
+
+// NewDockerAPIRuntime returns a runtime talking to the docker engine at the given host
+func NewDockerAPIRuntime(host string) *DockerAPIRuntime {
+	baseURL := strings.TrimSuffix(host, "/")
+	transport := &http.Transport{}
+	if strings.HasPrefix(host, "unix://") {
+		socketPath := strings.TrimPrefix(host, "unix://")
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", socketPath)
+		}
+		baseURL = "http://docker"
+	} else if strings.HasPrefix(host, "tcp://") {
+		baseURL = "http://" + strings.TrimPrefix(baseURL, "tcp://")
+	}
+
+	return &DockerAPIRuntime{
+		client:  &http.Client{Transport: transport},
+		baseURL: fmt.Sprintf("%s/%s", baseURL, dockerAPIVersion),
+	}
+}
+
+// ContainerCopyFrom streams a tar archive of a path within a container
+func (r *DockerAPIRuntime) ContainerCopyFrom(containerID string, path string) (io.ReadCloser, error) {
+	query := url.Values{}
+	query.Set("path", path)
+	response, err := r.request(context.Background(), "GET", fmt.Sprintf("/containers/%s/archive", url.PathEscape(containerID)), query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+// ContainerCreate creates a container from an image and returns its id
+func (r *DockerAPIRuntime) ContainerCreate(image string, options ContainerCreateOptions) (string, error) {
+	if len(options.ExtraArgs) > 0 {
+		LogDebug(fmt.Sprintf("docker api cannot express %v, creating the container with the docker cli", options.ExtraArgs))
+		return NewCLIRuntime(RuntimeProfiles["docker"]).ContainerCreate(image, options)
+	}
+
+	body := map[string]interface{}{
+		"Image":  image,
+		"Labels": options.Labels,
+	}
+	if len(options.Cmd) > 0 {
+		body["Cmd"] = options.Cmd
+	}
+	if len(options.Entrypoint) > 0 {
+		body["Entrypoint"] = options.Entrypoint
+	}
+	if len(options.Env) > 0 {
+		body["Env"] = options.Env
+	}
+	if options.User != "" {
+		body["User"] = options.User
+	}
+	if options.WorkingDir != "" {
+		body["WorkingDir"] = options.WorkingDir
+	}
+
+	hostConfig := map[string]interface{}{}
+	if len(options.Binds) > 0 {
+		hostConfig["Binds"] = options.Binds
+	}
+	if len(options.DNS) > 0 {
+		hostConfig["Dns"] = options.DNS
+	}
+	if len(options.ExtraHosts) > 0 {
+		hostConfig["ExtraHosts"] = options.ExtraHosts
+	}
+	if options.NetworkMode != "" {
+		hostConfig["NetworkMode"] = options.NetworkMode
+	}
+	if len(hostConfig) > 0 {
+		body["HostConfig"] = hostConfig
+	}
+
+	query := url.Values{}
+	if options.Name != "" {
+		query.Set("name", options.Name)
+	}
+
+	var response struct {
+		ID string `json:"Id"`
+	}
+	if err := r.doJSON("POST", "/containers/create", query, body, &response); err != nil {
+		return "", err
+	}
+
+	return response.ID, nil
+}
+
+// ContainerExec runs a command in a running container and returns its
+// combined output, failing when the command exits non-zero
+func (r *DockerAPIRuntime) ContainerExec(containerID string, cmd []string) ([]byte, error) {
+	body := map[string]interface{}{
+		"AttachStdout": true,
+		"AttachStderr": true,
+		"Cmd":          cmd,
+	}
+
+	var exec struct {
+		ID string `json:"Id"`
+	}
+	if err := r.doJSON("POST", fmt.Sprintf("/containers/%s/exec", url.PathEscape(containerID)), nil, body, &exec); err != nil {
+		return []byte{}, err
+	}
+
+	b, err := r.do("POST", fmt.Sprintf("/exec/%s/start", url.PathEscape(exec.ID)), nil, map[string]interface{}{"Detach": false})
+	if err != nil {
+		return []byte{}, err
+	}
+	output := demuxStream(b)
+
+	var result struct {
+		ExitCode int `json:"ExitCode"`
+	}
+	if err := r.doJSON("GET", fmt.Sprintf("/exec/%s/json", url.PathEscape(exec.ID)), nil, nil, &result); err != nil {
+		return output, err
+	}
+	if result.ExitCode != 0 {
+		return output, fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	return output, nil
+}
+
+// ContainerInspect returns the raw inspect json for a container
+func (r *DockerAPIRuntime) ContainerInspect(containerID string) ([]byte, error) {
+	return r.do("GET", fmt.Sprintf("/containers/%s/json", url.PathEscape(containerID)), nil, nil)
+}
+
+// ContainerList returns the ids of all containers matching the options
+func (r *DockerAPIRuntime) ContainerList(options ListOptions) ([]string, error) {
+	query, err := listQuery(options)
+	if err != nil {
+		return []string{}, err
+	}
+
+	var containers []struct {
+		ID string `json:"Id"`
+	}
+	if err := r.doJSON("GET", "/containers/json", query, nil, &containers); err != nil {
+		return []string{}, err
+	}
+
+	containerIDs := []string{}
+	for _, container := range containers {
+		containerIDs = append(containerIDs, container.ID)
+	}
+	return containerIDs, nil
+}
+
+// ContainerLogs returns the last lines of a container's combined output
+func (r *DockerAPIRuntime) ContainerLogs(containerID string, tail int) ([]byte, error) {
+	query := url.Values{}
+	query.Set("stdout", "1")
+	query.Set("stderr", "1")
+	query.Set("tail", fmt.Sprintf("%d", tail))
+	b, err := r.do("GET", fmt.Sprintf("/containers/%s/logs", url.PathEscape(containerID)), query, nil)
+	if err != nil {
+		return []byte{}, err
+	}
+	return demuxStream(b), nil
+}
+
+// ContainerRemove removes a container
+func (r *DockerAPIRuntime) ContainerRemove(containerID string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+
+	_, err := r.do("DELETE", fmt.Sprintf("/containers/%s", url.PathEscape(containerID)), query, nil)
+	return err
+}
+
+// ContainerStart starts a created or stopped container
+func (r *DockerAPIRuntime) ContainerStart(containerID string) error {
+	_, err := r.do("POST", fmt.Sprintf("/containers/%s/start", url.PathEscape(containerID)), nil, nil)
+	return err
+}
+
+// ImageInspect returns the raw inspect json for an image
+func (r *DockerAPIRuntime) ImageInspect(image string) ([]byte, error) {
+	return r.do("GET", fmt.Sprintf("/images/%s/json", url.PathEscape(image)), nil, nil)
+}
+
+// ImageLoad loads images from a tar archive and returns the loaded references
+func (r *DockerAPIRuntime) ImageLoad(archive io.Reader) ([]string, error) {
+	query := url.Values{}
+	query.Set("quiet", "1")
+	b, err := r.doContext(context.Background(), "POST", "/images/load", query, archive)
+	if err != nil {
+		return []string{}, err
+	}
+
+	output, err := decodeStream(b)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return parseLoadedImages(output), nil
+}
+
+// ImageList returns the ids of all images matching the options
+func (r *DockerAPIRuntime) ImageList(options ListOptions) ([]string, error) {
+	query, err := listQuery(options)
+	if err != nil {
+		return []string{}, err
+	}
+
+	var images []struct {
+		ID string `json:"Id"`
+	}
+	if err := r.doJSON("GET", "/images/json", query, nil, &images); err != nil {
+		return []string{}, err
+	}
+
+	imageIDs := []string{}
+	for _, image := range images {
+		imageIDs = append(imageIDs, image.ID)
+	}
+	return imageIDs, nil
+}
+
+// ImagePrune removes all unused images matching the filters
+func (r *DockerAPIRuntime) ImagePrune(filters map[string][]string) error {
+	query, err := listQuery(ListOptions{Filters: filters})
+	if err != nil {
+		return err
+	}
+
+	// pruning many images can take longer than a unary request deadline
+	_, err = r.doContext(context.Background(), "POST", "/images/prune", query, nil)
+	return err
+}
+
+// ImagePull pulls an image from a registry
+func (r *DockerAPIRuntime) ImagePull(image string, auth RegistryAuth) error {
+	repository, tag := splitImageReference(image)
+	query := url.Values{}
+	query.Set("fromImage", repository)
+	query.Set("tag", tag)
+	return r.registryRequest("POST", "/images/create", query, auth)
+}
+
+// ImagePush pushes an image to a registry
+func (r *DockerAPIRuntime) ImagePush(image string, auth RegistryAuth) error {
+	repository, tag := splitImageReference(image)
+	query := url.Values{}
+	query.Set("tag", tag)
+	return r.registryRequest("POST", fmt.Sprintf("/images/%s/push", url.PathEscape(repository)), query, auth)
+}
+
+// ImageRemove removes an image
+func (r *DockerAPIRuntime) ImageRemove(image string) error {
+	_, err := r.do("DELETE", fmt.Sprintf("/images/%s", url.PathEscape(image)), nil, nil)
+	return err
+}
+
+// ImageTag adds a repository:tag reference to an existing image
+func (r *DockerAPIRuntime) ImageTag(image string, reference string) error {
+	repository, tag := splitImageReference(reference)
+	query := url.Values{}
+	query.Set("repo", repository)
+	query.Set("tag", tag)
+	_, err := r.do("POST", fmt.Sprintf("/images/%s/tag", url.PathEscape(image)), query, nil)
+	return err
+}
+
+// ImageSave streams a tar archive containing the images
+func (r *DockerAPIRuntime) ImageSave(images []string) (io.ReadCloser, error) {
+	query := url.Values{}
+	for _, image := range images {
+		query.Add("names", image)
+	}
+
+	response, err := r.request(context.Background(), "GET", "/images/get", query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Body, nil
+}
+
+func (r *DockerAPIRuntime) registryRequest(method string, path string, query url.Values, auth RegistryAuth) error {
+	b, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+
+	headers := map[string]string{"X-Registry-Auth": base64.URLEncoding.EncodeToString(b)}
+	response, err := r.requestWithHeaders(context.Background(), method, path, query, nil, headers)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	_, err = decodeStream(body)
+	return err
+}
+
+// do sends a request bounded by the unary request deadline and returns the response body
+func (r *DockerAPIRuntime) do(method string, path string, query url.Values, body interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerAPITimeout)
+	defer cancel()
+	return r.doContext(ctx, method, path, query, body)
+}
+
+func (r *DockerAPIRuntime) doContext(ctx context.Context, method string, path string, query url.Values, body interface{}) ([]byte, error) {
+	response, err := r.request(ctx, method, path, query, body)
+	if err != nil {
+		return []byte{}, err
+	}
+	defer response.Body.Close()
+
+	return ioutil.ReadAll(response.Body)
+}
+
+func (r *DockerAPIRuntime) doJSON(method string, path string, query url.Values, body interface{}, out interface{}) error {
+	b, err := r.do(method, path, query, body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("Unable to parse docker response for %s: %v", path, err)
+	}
+	return nil
+}
+
+func (r *DockerAPIRuntime) request(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Response, error) {
+	return r.requestWithHeaders(ctx, method, path, query, body, nil)
+}
+
+func (r *DockerAPIRuntime) requestWithHeaders(ctx context.Context, method string, path string, query url.Values, body interface{}, headers map[string]string) (*http.Response, error) {
+	var reader io.Reader
+	contentType := "application/json"
+	if archive, ok := body.(io.Reader); ok {
+		reader = archive
+		contentType = "application/x-tar"
+	} else if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(b)
+	}
+
+	endpoint := r.baseURL + path
+	if len(query) > 0 {
+		endpoint = fmt.Sprintf("%s?%s", endpoint, query.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	LogDebug(fmt.Sprintf("docker api %s %s", method, endpoint))
+	response, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reach docker engine at %s: %v", DockerHost(), err)
+	}
+
+	if response.StatusCode >= 400 {
+		defer response.Body.Close()
+		b, _ := ioutil.ReadAll(response.Body)
+		var apiErr dockerAPIError
+		if err := json.Unmarshal(b, &apiErr); err == nil && apiErr.Message != "" {
+			return nil, fmt.Errorf("%s", apiErr.Message)
+		}
+		return nil, fmt.Errorf("Docker engine returned %s for %s %s", response.Status, method, path)
+	}
+
+	return response, nil
+}
+
+// decodeStream reads a docker engine json message stream, returning the
+// combined stream output or the first error reported
+func decodeStream(b []byte) (string, error) {
+	output := []string{}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	for decoder.More() {
+		var message struct {
+			Stream string `json:"stream"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			return "", fmt.Errorf("Unable to parse docker response stream: %v", err)
+		}
+		if message.Error != "" {
+			return "", fmt.Errorf("%s", message.Error)
+		}
+		output = append(output, message.Stream)
+	}
+
+	return strings.Join(output, "\n"), nil
+}
+
+// demuxStream combines the stdout and stderr frames of a docker engine
+// multiplexed stream, returning the output of tty containers unchanged
+func demuxStream(b []byte) []byte {
+	output := []byte{}
+	for rest := b; len(rest) > 0; {
+		if len(rest) < 8 || rest[0] > 2 || rest[1] != 0 || rest[2] != 0 || rest[3] != 0 {
+			return b
+		}
+		size := int(binary.BigEndian.Uint32(rest[4:8]))
+		if len(rest) < 8+size {
+			return b
+		}
+		output = append(output, rest[8:8+size]...)
+		rest = rest[8+size:]
+	}
+	return output
+}
+
+func listQuery(options ListOptions) (url.Values, error) {
+	query := url.Values{}
+	if options.All {
+		query.Set("all", "true")
+	}
+
+	if len(options.Filters) > 0 {
+		b, err := json.Marshal(options.Filters)
+		if err != nil {
+			return query, err
+		}
+		query.Set("filters", string(b))
+	}
+
+	return query, nil
+}
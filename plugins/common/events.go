@@ -0,0 +1,375 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// EventAppCloned is emitted when an app is cloned
+	EventAppCloned = "clone"
+
+	// EventAppCreated is emitted when an app is created
+	EventAppCreated = "create"
+
+	// EventAppDeployed is emitted when an app is deployed
+	EventAppDeployed = "deploy"
+
+	// EventAppDeployFailed is emitted when the scheduler fails to deploy an app
+	EventAppDeployFailed = "deploy-failed"
+
+	// EventAppDestroyed is emitted when an app is destroyed
+	EventAppDestroyed = "destroy"
+
+	// EventAppLocked is emitted when an app is locked for deployment
+	EventAppLocked = "lock"
+
+	// EventAppRenamed is emitted when an app is renamed
+	EventAppRenamed = "rename"
+
+	// EventAppRolledBack is emitted when an app is rolled back to a previous release
+	EventAppRolledBack = "rollback"
+
+	// EventAppUnlocked is emitted when an app deploy lock is removed
+	EventAppUnlocked = "unlock"
+)
+
+var (
+	// DefaultEventsMaxSize is the size at which the event log is rotated
+	DefaultEventsMaxSize = int64(10 * 1000 * 1000)
+
+	// DefaultEventsMaxAge is the age of the oldest event at which the event log is rotated
+	DefaultEventsMaxAge = 7 * 24 * time.Hour
+
+	// DefaultEventsMaxBackups is the number of rotated event logs that are kept
+	DefaultEventsMaxBackups = 5
+)
+
+// Event is a single entry in the event log
+type Event struct {
+	Type      string            `json:"type"`
+	App       string            `json:"app"`
+	Trigger   string            `json:"trigger,omitempty"`
+	Args      []string          `json:"args,omitempty"`
+	Data      map[string]string `json:"data,omitempty"`
+	User      string            `json:"user,omitempty"`
+	Timestamp time.Time         `json:"timestamp"`
+}
+
+// EventFilter selects events from the event log
+type EventFilter struct {
+	// App only matches events for the given app
+	App string
+
+	// Type only matches events of the given type
+	Type string
+
+	// Since only matches events at or after the given time
+	Since time.Time
+
+	// Limit returns at most the given number of the most recent events
+	Limit int
+}
+
+// EventLogRotation controls when the event log is rotated
+type EventLogRotation struct {
+	MaxSize    int64
+	MaxAge     time.Duration
+	MaxBackups int
+}
+
+// Matches returns true if the event is selected by the filter
+func (f EventFilter) Matches(event Event) bool {
+	if f.App != "" && event.App != f.App {
+		return false
+	}
+	if f.Type != "" && event.Type != f.Type {
+		return false
+	}
+	return f.Since.IsZero() || !event.Timestamp.Before(f.Since)
+}
+
+// EmitEvent records an event in the event log and delivers it to any subscribed
+// webhooks. Failures never interrupt the command emitting the event.
+func EmitEvent(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+	if event.User == "" {
+		event.User = os.Getenv("SSH_USER")
+	}
+
+	if err := AppendEvent(EventsLogFile(), event, GetEventLogRotation()); err != nil {
+		LogDebug(fmt.Sprintf("Unable to record %s event: %s", event.Type, err.Error()))
+	}
+
+	DispatchWebhooks(event)
+}
+
+// DeployDuration returns the time since the running deploy started, as recorded
+// by the deploy phase in CLAIR_DEPLOY_STARTED_AT
+func DeployDuration(now time.Time) (time.Duration, bool) {
+	startedAt, err := strconv.ParseInt(os.Getenv("CLAIR_DEPLOY_STARTED_AT"), 10, 64)
+	if err != nil || startedAt <= 0 {
+		return 0, false
+	}
+
+	return now.Sub(time.Unix(startedAt, 0)), true
+}
+
+// EmitDeployFailedEvent records a failed deploy of an app
+func EmitDeployFailedEvent(appName string, imageTag string) {
+	event := Event{
+		Type:    EventAppDeployFailed,
+		App:     appName,
+		Trigger: "scheduler-deploy",
+		Args:    []string{appName, imageTag},
+	}
+	if duration, ok := DeployDuration(time.Now()); ok {
+		event.Data = map[string]string{"duration": formatSeconds(duration)}
+	}
+
+	EmitEvent(event)
+}
+
+// EventsLogFile returns the path to the structured event log
+func EventsLogFile() string {
+	if path := os.Getenv("CLAIR_EVENTS_JSON_LOGFILE"); path != "" {
+		return path
+	}
+
+	logsDir := os.Getenv("CLAIR_LOGS_DIR")
+	if logsDir == "" {
+		logsDir = "/var/log/clair"
+	}
+	return filepath.Join(logsDir, "events.json")
+}
+
+// GetEventLogRotation returns the configured event log rotation settings
+func GetEventLogRotation() EventLogRotation {
+	rotation := EventLogRotation{
+		MaxSize:    DefaultEventsMaxSize,
+		MaxAge:     DefaultEventsMaxAge,
+		MaxBackups: DefaultEventsMaxBackups,
+	}
+
+	if value := PropertyGet("events", "--global", "max-size"); value != "" {
+		if size, err := ParseBytes(value); err == nil {
+			rotation.MaxSize = size
+		}
+	}
+	if value := PropertyGet("events", "--global", "max-age"); value != "" {
+		if age, err := ParseAge(value); err == nil {
+			rotation.MaxAge = age
+		}
+	}
+	if value := PropertyGet("events", "--global", "max-backups"); value != "" {
+		if i, err := strconv.Atoi(value); err == nil && i >= 0 {
+			rotation.MaxBackups = i
+		}
+	}
+
+	return rotation
+}
+
+// AppendEvent appends an event to the event log at the given path, rotating the
+// log first if it has grown too large or old
+func AppendEvent(path string, event Event, rotation EventLogRotation) error {
+	return appendJSONLine(path, event, event.Timestamp, rotation)
+}
+
+// RotateEventLog moves the event log to path.1, shifting older logs along and
+// removing any beyond the number of backups to keep
+func RotateEventLog(path string, maxBackups int) error {
+	if maxBackups < 1 {
+		return os.Remove(path)
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, maxBackups))
+	for i := maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(from); err == nil {
+			if err := os.Rename(from, fmt.Sprintf("%s.%d", path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return os.Rename(path, path+".1")
+}
+
+// QueryEvents returns the events matching the filter from the event log at the
+// given path and its rotated backups, oldest first
+func QueryEvents(path string, filter EventFilter) ([]Event, error) {
+	events := []Event{}
+	for _, file := range logFiles(path) {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return events, err
+		}
+
+		fileEvents, err := readEvents(f, filter)
+		f.Close()
+		if err != nil {
+			return events, err
+		}
+		events = append(events, fileEvents...)
+	}
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+	return events, nil
+}
+
+// FilterEvents returns the events the current user or api token may view.
+// Events for other apps are dropped, as are events not tied to an app when
+// the caller may only access some apps.
+func FilterEvents(events []Event) []Event {
+	apps := []string{}
+	seen := map[string]bool{}
+	for _, event := range events {
+		if event.App != "" && !seen[event.App] {
+			seen[event.App] = true
+			apps = append(apps, event.App)
+		}
+	}
+
+	allowed := map[string]bool{}
+	filteredApps, _ := filterApps(apps)
+	for _, appName := range filteredApps {
+		allowed[appName] = true
+	}
+	restricted := appAccessRestricted()
+
+	filtered := []Event{}
+	for _, event := range events {
+		if event.App == "" && restricted {
+			continue
+		}
+		if event.App != "" && !allowed[event.App] {
+			continue
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered
+}
+
+// logFiles returns a log file and its rotated backups, oldest first
+func logFiles(path string) []string {
+	matches, _ := filepath.Glob(path + ".*")
+	backups := map[string]int{}
+	files := []string{}
+	for _, match := range matches {
+		if i, err := strconv.Atoi(strings.TrimPrefix(match, path+".")); err == nil {
+			backups[match] = i
+			files = append(files, match)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return backups[files[i]] > backups[files[j]]
+	})
+
+	return append(files, path)
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+func readEvents(r io.Reader, filter EventFilter) ([]Event, error) {
+	events := []Event{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	return events, scanner.Err()
+}
+
+// appendJSONLine appends a value as a single json line to a log file, rotating
+// the log first if it has grown too large or its first entry is too old
+func appendJSONLine(path string, value interface{}, now time.Time, rotation EventLogRotation) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	if rotate, err := logNeedsRotation(path, int64(len(b)+1), rotation, now); err != nil {
+		return err
+	} else if rotate {
+		if err := RotateEventLog(path, rotation.MaxBackups); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func logNeedsRotation(path string, size int64, rotation EventLogRotation, now time.Time) (bool, error) {
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() == 0 {
+		return false, nil
+	}
+
+	if rotation.MaxSize > 0 && fi.Size()+size > rotation.MaxSize {
+		return true, nil
+	}
+	if rotation.MaxAge <= 0 {
+		return false, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var first struct {
+		Timestamp time.Time `json:"timestamp"`
+	}
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	if err := json.Unmarshal(line, &first); err != nil || first.Timestamp.IsZero() {
+		return false, nil
+	}
+	return now.Sub(first.Timestamp) > rotation.MaxAge, nil
+}
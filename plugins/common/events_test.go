@@ -0,0 +1,92 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonAppendAndQueryEvents(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "clair-events")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+	now := time.Now().UTC()
+	rotation := EventLogRotation{MaxBackups: 2}
+	events := []Event{
+		{Type: EventAppCreated, App: testAppName, Trigger: "post-create", Args: []string{testAppName}, Timestamp: now.Add(-3 * time.Hour)},
+		{Type: EventAppDeployed, App: testAppName, Trigger: "core-post-deploy", Timestamp: now.Add(-2 * time.Hour)},
+		{Type: EventAppDeployed, App: "test-app-2", Timestamp: now.Add(-30 * time.Minute)},
+		{Type: EventAppDeployed, App: testAppName, Timestamp: now.Add(-10 * time.Minute)},
+	}
+	for _, event := range events {
+		Expect(AppendEvent(path, event, rotation)).To(Succeed())
+	}
+	Expect(ioutil.WriteFile(path+".tmp", []byte("not an event\n"), 0644)).To(Succeed())
+
+	result, err := QueryEvents(path, EventFilter{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(HaveLen(4))
+	Expect(result[0].Args).To(Equal([]string{testAppName}))
+
+	result, err = QueryEvents(path, EventFilter{App: testAppName, Type: EventAppDeployed, Since: now.Add(-time.Hour)})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(HaveLen(1))
+	Expect(result[0].Timestamp.Equal(now.Add(-10 * time.Minute))).To(BeTrue())
+
+	result, err = QueryEvents(path, EventFilter{Type: EventAppDeployed, Limit: 2})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(HaveLen(2))
+	Expect(result[0].App).To(Equal("test-app-2"))
+}
+
+func TestCommonRotateEventLog(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "clair-events")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+	now := time.Now().UTC()
+	bySize := EventLogRotation{MaxSize: 200, MaxBackups: 2}
+	for i := 0; i < 8; i++ {
+		Expect(AppendEvent(path, Event{Type: EventAppLocked, App: testAppName, Timestamp: now}, bySize)).To(Succeed())
+	}
+	Expect(path + ".1").To(BeAnExistingFile())
+	Expect(path + ".2").To(BeAnExistingFile())
+	Expect(path + ".3").NotTo(BeAnExistingFile())
+
+	result, err := QueryEvents(path, EventFilter{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(len(result)).To(BeNumerically("<", 8))
+
+	byAge := EventLogRotation{MaxAge: time.Hour, MaxBackups: 1}
+	Expect(os.RemoveAll(dir)).To(Succeed())
+	Expect(AppendEvent(path, Event{Type: EventAppLocked, App: testAppName, Timestamp: now.Add(-2 * time.Hour)}, byAge)).To(Succeed())
+	Expect(AppendEvent(path, Event{Type: EventAppUnlocked, App: testAppName, Timestamp: now}, byAge)).To(Succeed())
+	Expect(path + ".1").To(BeAnExistingFile())
+
+	result, err = QueryEvents(path, EventFilter{Since: now.Add(-time.Minute)})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(HaveLen(1))
+	Expect(result[0].Type).To(Equal(EventAppUnlocked))
+}
+
+func TestCommonParseBytes(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(ParseBytes("500")).To(Equal(int64(500)))
+	Expect(ParseBytes("500kB")).To(Equal(int64(500000)))
+	Expect(ParseBytes("10MB")).To(Equal(int64(10000000)))
+	Expect(ParseBytes("1.5G")).To(Equal(int64(1500000000)))
+
+	_, err := ParseBytes("lots")
+	Expect(err).To(HaveOccurred())
+	_, err = ParseBytes("10XB")
+	Expect(err).To(HaveOccurred())
+}
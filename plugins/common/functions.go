@@ -7,21 +7,30 @@ import (
 )
 
 func filterApps(apps []string) ([]string, error) {
-	if !PluginTriggerExists("user-auth-app") {
-		return apps, nil
+	if token, ok := CurrentAPIToken(); ok {
+		filteredApps := []string{}
+		for _, appName := range apps {
+			if token.AllowsApp(appName) {
+				filteredApps = append(filteredApps, appName)
+			}
+		}
+		if len(filteredApps) == 0 {
+			return filteredApps, fmt.Errorf("You haven't deployed any applications yet")
+		}
+		return filteredApps, nil
 	}
 
-	sshUser := os.Getenv("SSH_USER")
-	if sshUser == "" {
-		sshUser = os.Getenv("USER")
-	}
+	sshUser, sshName := callerIdentity()
+	if !PluginTriggerExists("user-auth-app") {
+		if !RBACApplies(sshUser) {
+			return apps, nil
+		}
 
-	sshName := os.Getenv("SSH_NAME")
-	if sshName == "" {
-		sshName = os.Getenv("NAME")
-	}
-	if sshName == "" {
-		sshName = "default"
+		filteredApps, err := FilterAppsForUser(sshName, apps)
+		if err == nil && len(filteredApps) == 0 {
+			return filteredApps, fmt.Errorf("You haven't deployed any applications yet")
+		}
+		return filteredApps, err
 	}
 
 	args := append([]string{sshUser, sshName}, apps...)
@@ -36,6 +45,50 @@ func filterApps(apps []string) ([]string, error) {
 	return filteredApps, nil
 }
 
+// appAccessRestricted returns true if the current user or api token may only
+// access some apps
+func appAccessRestricted() bool {
+	if token, ok := CurrentAPIToken(); ok {
+		return len(token.Apps) > 0
+	}
+
+	sshUser, sshName := callerIdentity()
+	if PluginTriggerExists("user-auth-app") {
+		return sshUser == GetenvWithDefault("CLAIR_SYSTEM_USER", "clair")
+	}
+	if !RBACApplies(sshUser) {
+		return false
+	}
+
+	grants, err := UserGrants(sshName)
+	if err != nil {
+		return true
+	}
+	for _, grant := range grants {
+		if !grant.IsScoped() {
+			return false
+		}
+	}
+	return true
+}
+
+// callerIdentity returns the system user and key name of the current caller
+func callerIdentity() (string, string) {
+	sshUser := os.Getenv("SSH_USER")
+	if sshUser == "" {
+		sshUser = os.Getenv("USER")
+	}
+
+	sshName := os.Getenv("SSH_NAME")
+	if sshName == "" {
+		sshName = os.Getenv("NAME")
+	}
+	if sshName == "" {
+		sshName = "default"
+	}
+	return sshUser, sshName
+}
+
 func removeEmptyEntries(s []string) []string {
 	var r []string
 	for _, str := range s {
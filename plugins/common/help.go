@@ -0,0 +1,622 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// PluginHelp is the help metadata emitted by a plugin with `commands help --format json`
+type PluginHelp struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Commands    []CommandHelp `json:"commands"`
+}
+
+// CommandHelp is the help metadata for a single plugin command
+type CommandHelp struct {
+	Name        string `json:"name"`
+	Usage       string `json:"usage"`
+	Description string `json:"description"`
+	Args        []Arg  `json:"args,omitempty"`
+	Flags       []Flag `json:"flags,omitempty"`
+	Global      bool   `json:"global,omitempty"`
+	InfoFlag    bool   `json:"info_flag,omitempty"`
+}
+
+// globalFlag is accepted by Global commands in place of their app argument
+var globalFlag = Flag{Name: "global", Kind: KindBool, Description: "--global: act on the global settings instead of an app"}
+
+// completionShells are the shells a completion script can be generated for
+var completionShells = []string{"bash", "fish", "zsh"}
+
+// AllFlags returns the command flags, including --global for Global commands
+func (c CommandHelp) AllFlags() []Flag {
+	if !c.Global {
+		return c.Flags
+	}
+	for _, f := range c.Flags {
+		if f.Name == globalFlag.Name {
+			return c.Flags
+		}
+	}
+	return append([]Flag{globalFlag}, c.Flags...)
+}
+
+// AppArgIndexes returns the indexes of the arguments naming an app, where args
+// are the arguments following the command name. Only arguments naming an
+// existing app are returned when existing is set.
+func (c CommandHelp) AppArgIndexes(args []string, existing bool) []int {
+	flags := map[string]Flag{}
+	for _, f := range c.AllFlags() {
+		flags["--"+f.Name] = f
+		if f.Shorthand != "" {
+			flags["-"+f.Shorthand] = f
+		}
+	}
+
+	indexes := []int{}
+	position := 0
+	positionalOnly := false
+	for i := 0; i < len(args); i++ {
+		if !positionalOnly && strings.HasPrefix(args[i], "-") && args[i] != "-" {
+			if args[i] == "--" {
+				positionalOnly = true
+				continue
+			}
+			if args[i] == "--global" && c.Global && position == 0 {
+				position++
+			}
+			if f, ok := flags[args[i]]; ok && f.Kind != KindBool {
+				i++
+			}
+			continue
+		}
+
+		var arg Arg
+		if position < len(c.Args) {
+			arg = c.Args[position]
+		} else if len(c.Args) > 0 && c.Args[len(c.Args)-1].Variadic {
+			arg = c.Args[len(c.Args)-1]
+		}
+		position++
+
+		if arg.Complete == CompleteApp || (arg.App && !existing) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// Synopsis returns the command name followed by its arguments and flags
+func (c CommandHelp) Synopsis() string {
+	parts := []string{c.Name}
+	for i, arg := range c.Args {
+		usage := "<" + arg.Name + ">"
+		if arg.Variadic {
+			usage += "..."
+		}
+		if i == 0 && c.Global {
+			usage = "[--global|" + usage + "]"
+		} else if arg.Optional {
+			usage = "[" + usage + "]"
+		}
+		parts = append(parts, usage)
+	}
+	for _, f := range c.Flags {
+		if c.Global && f.Name == globalFlag.Name {
+			continue
+		}
+		usage := "--" + f.Name
+		if f.Kind != KindBool {
+			usage += " " + f.placeholder()
+		}
+		if !f.Required {
+			usage = "[" + usage + "]"
+		}
+		parts = append(parts, usage)
+	}
+	if c.InfoFlag {
+		parts = append(parts, "[<flag>]")
+	}
+	return strings.Join(parts, " ")
+}
+
+func (f Flag) placeholder() string {
+	if f.Placeholder != "" {
+		return f.Placeholder
+	}
+	if len(f.Values) > 0 {
+		return strings.Join(f.Values, "|")
+	}
+	return "<" + f.Name + ">"
+}
+
+// summary returns the flag description without the conventional "--flag: " prefix
+func (f Flag) summary() string {
+	for _, prefix := range []string{"--" + f.Name + ": ", f.Name + ": "} {
+		if strings.HasPrefix(f.Description, prefix) {
+			return strings.TrimPrefix(f.Description, prefix)
+		}
+	}
+	return f.Description
+}
+
+// HelpHeader returns the header printed above the command list
+func (h PluginHelp) HelpHeader() string {
+	return fmt.Sprintf("Usage: clair %s[:COMMAND]\n\n%s\n\nAdditional commands:", h.Name, h.Description)
+}
+
+// Usage returns the plugin help as printed by `clair <plugin>:help`
+func (h PluginHelp) Usage() string {
+	rows := [][]string{}
+	for _, command := range h.Commands {
+		rows = append(rows, []string{command.Usage, command.Description})
+	}
+
+	lines := []string{h.HelpHeader()}
+	if len(rows) > 0 {
+		for _, line := range strings.Split(FormatTable(rows), "\n") {
+			lines = append(lines, "    "+line)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// HelpLines returns a comma-delimited line per command as printed by `clair help --all`
+func (h PluginHelp) HelpLines() string {
+	var b strings.Builder
+	b.WriteString("\n")
+	for _, command := range h.Commands {
+		fmt.Fprintf(&b, "    %s, %s\n", command.Usage, command.Description)
+	}
+	return b.String()
+}
+
+// ParseHelpLines converts the comma-delimited `help --all` output of plugins
+// that do not emit help metadata, grouping commands by their namespace
+func ParseHelpLines(output string) []PluginHelp {
+	byName := map[string]*PluginHelp{}
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "    ") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSpace(line), ", ", 2)
+		usage := strings.TrimSpace(parts[0])
+		if usage == "" {
+			continue
+		}
+
+		command := CommandHelp{
+			Name:   strings.Fields(usage)[0],
+			Usage:  usage,
+			Args:   argsFromUsage(usage),
+			Global: strings.Contains(usage, "[--global|"),
+		}
+		if len(parts) == 2 {
+			command.Description = strings.TrimSpace(parts[1])
+		}
+
+		name := strings.SplitN(command.Name, ":", 2)[0]
+		if _, ok := byName[name]; !ok {
+			byName[name] = &PluginHelp{Name: name, Commands: []CommandHelp{}}
+		}
+		if command.Name == name {
+			byName[name].Description = command.Description
+			continue
+		}
+		byName[name].Commands = append(byName[name].Commands, command)
+	}
+
+	names := []string{}
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plugins := []PluginHelp{}
+	for _, name := range names {
+		plugins = append(plugins, *byName[name])
+	}
+	return plugins
+}
+
+// CollectPluginHelp returns the help metadata of every enabled plugin,
+// falling back to parsing the help output of plugins that do not emit json
+func CollectPluginHelp() ([]PluginHelp, error) {
+	enabledPath := GetenvWithDefault("PLUGIN_ENABLED_PATH", filepath.Join(MustGetEnv("PLUGIN_PATH"), "enabled"))
+	scripts, err := filepath.Glob(filepath.Join(enabledPath, "*", "commands"))
+	if err != nil {
+		return []PluginHelp{}, err
+	}
+
+	byName := map[string]PluginHelp{}
+	for _, script := range scripts {
+		command := NewShellCmdWithArgs(script, "help", "--all", "--format", "json")
+		command.ShowOutput = false
+		output, err := command.Output()
+		if err != nil {
+			LogDebug(fmt.Sprintf("Unable to read help for %s: %s", script, err.Error()))
+			continue
+		}
+
+		output = []byte(strings.TrimSpace(string(output)))
+		var plugin PluginHelp
+		if json.Unmarshal(output, &plugin) == nil && plugin.Name != "" {
+			byName[plugin.Name] = plugin
+			continue
+		}
+		for _, plugin := range ParseHelpLines(string(output)) {
+			if _, ok := byName[plugin.Name]; !ok {
+				byName[plugin.Name] = plugin
+			}
+		}
+	}
+
+	names := []string{}
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plugins := []PluginHelp{}
+	for _, name := range names {
+		plugins = append(plugins, byName[name])
+	}
+	return plugins, nil
+}
+
+// CommandHelpFor returns the help metadata of a command, read from the enabled
+// plugin named after the command namespace. It returns false when PLUGIN_PATH
+// is unset or no such plugin describes the command.
+func CommandHelpFor(command string) (CommandHelp, bool) {
+	pluginPath := os.Getenv("PLUGIN_PATH")
+	if pluginPath == "" {
+		return CommandHelp{}, false
+	}
+
+	namespace := strings.SplitN(command, ":", 2)[0]
+	enabledPath := GetenvWithDefault("PLUGIN_ENABLED_PATH", filepath.Join(pluginPath, "enabled"))
+	scripts, err := filepath.Glob(filepath.Join(enabledPath, "*", "commands"))
+	if err != nil {
+		return CommandHelp{}, false
+	}
+
+	for _, script := range scripts {
+		if pluginOrderPrefix.ReplaceAllString(filepath.Base(filepath.Dir(script)), "") != namespace {
+			continue
+		}
+
+		helpCmd := NewShellCmdWithArgs(script, "help", "--all", "--format", "json")
+		helpCmd.ShowOutput = false
+		output, err := helpCmd.Output()
+		if err != nil {
+			return CommandHelp{}, false
+		}
+
+		plugins := []PluginHelp{}
+		var plugin PluginHelp
+		if json.Unmarshal(output, &plugin) == nil && plugin.Name != "" {
+			plugins = append(plugins, plugin)
+		} else {
+			plugins = ParseHelpLines(string(output))
+		}
+		for _, plugin := range plugins {
+			for _, c := range plugin.Commands {
+				if c.Name == command {
+					return c, true
+				}
+			}
+		}
+	}
+	return CommandHelp{}, false
+}
+
+// argsFromUsage returns the positional arguments named by <placeholders> in
+// a usage line, treating <app> placeholders as app names
+func argsFromUsage(usage string) []Arg {
+	args := []Arg{}
+	fields := strings.Fields(usage)
+	for i := 1; i < len(fields); i++ {
+		field := fields[i]
+		if strings.HasPrefix(field, "[-") && !strings.HasSuffix(field, "]") && !strings.Contains(field, "|<") {
+			// skip the value of an optional flag
+			i++
+			continue
+		}
+		if index := strings.LastIndex(field, "|"); index != -1 {
+			field = field[index+1:]
+		}
+		optional := strings.HasPrefix(field, "[")
+		variadic := strings.Contains(field, "...")
+		field = strings.Trim(field, "[].")
+		if !strings.HasPrefix(field, "<") || !strings.HasSuffix(field, ">") {
+			continue
+		}
+
+		arg := Arg{Name: strings.Trim(field, "<>"), Optional: optional, Variadic: variadic}
+		if arg.Name == "app" {
+			arg.Complete = CompleteApp
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// CompleteWords returns the completion candidates for the last word, where
+// words are the command line arguments following clair
+func CompleteWords(plugins []PluginHelp, words []string) []string {
+	appGiven := false
+	for len(words) > 1 && strings.HasPrefix(words[0], "-") {
+		if words[0] == "--app" && len(words) == 2 {
+			return completeValues([]string{}, CompleteApp, words[1])
+		}
+		if words[0] == "--app" {
+			appGiven = true
+			words = words[1:]
+		}
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		words = []string{""}
+	}
+
+	current := words[len(words)-1]
+	if len(words) == 1 {
+		candidates := []string{"help", "version"}
+		for _, plugin := range plugins {
+			candidates = append(candidates, plugin.Name)
+			for _, command := range plugin.Commands {
+				candidates = append(candidates, command.Name)
+			}
+		}
+		sort.Strings(candidates)
+		return filterPrefix(candidates, current)
+	}
+
+	var command CommandHelp
+	for _, plugin := range plugins {
+		for _, c := range plugin.Commands {
+			if c.Name == words[0] {
+				command = c
+			}
+		}
+	}
+	if command.Name == "" {
+		return []string{}
+	}
+
+	flags := command.AllFlags()
+	flagsByName := map[string]Flag{}
+	for _, f := range flags {
+		flagsByName["--"+f.Name] = f
+		if f.Shorthand != "" {
+			flagsByName["-"+f.Shorthand] = f
+		}
+	}
+
+	if strings.HasPrefix(current, "-") {
+		candidates := []string{}
+		for _, f := range flags {
+			candidates = append(candidates, "--"+f.Name)
+		}
+		return filterPrefix(candidates, current)
+	}
+
+	position := 0
+	if appGiven && len(command.Args) > 0 && command.Args[0].Complete == CompleteApp {
+		position++
+	}
+	previous := words[1 : len(words)-1]
+	for i := 0; i < len(previous); i++ {
+		word := previous[i]
+		if !strings.HasPrefix(word, "-") {
+			position++
+			continue
+		}
+		if word == "--global" && command.Global {
+			position++
+			continue
+		}
+		if f, ok := flagsByName[word]; ok && f.Kind != KindBool {
+			if i == len(previous)-1 {
+				return completeValues(f.Values, f.Complete, current)
+			}
+			i++
+		}
+	}
+
+	if len(command.Args) == 0 {
+		return []string{}
+	}
+	if position >= len(command.Args) {
+		if !command.Args[len(command.Args)-1].Variadic {
+			return []string{}
+		}
+		position = len(command.Args) - 1
+	}
+	arg := command.Args[position]
+	return completeValues(arg.Values, arg.Complete, current)
+}
+
+func completeValues(values []string, complete string, current string) []string {
+	if complete == CompleteApp {
+		apps, err := ClairApps()
+		if err != nil {
+			return []string{}
+		}
+		values = append(append([]string{}, values...), apps...)
+	}
+	return filterPrefix(values, current)
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	matches := []string{}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// CommandHelpMetadata prints the help metadata of every enabled plugin
+func CommandHelpMetadata(format string) error {
+	if format != "json" && format != "man" {
+		return fmt.Errorf("Invalid format %s: must be json or man", format)
+	}
+
+	plugins, err := CollectPluginHelp()
+	if err != nil {
+		return err
+	}
+
+	if format == "man" {
+		fmt.Print(FormatManPage(plugins, clairVersion()))
+		return nil
+	}
+
+	return writeHelpJSON(plugins)
+}
+
+// writeHelpJSON prints help metadata without escaping the <> of usage placeholders
+func writeHelpJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(v)
+}
+
+// CommandHelpComplete prints the completion candidates for the command line
+func CommandHelpComplete(words []string) error {
+	plugins, err := CollectPluginHelp()
+	if err != nil {
+		return err
+	}
+
+	for _, candidate := range CompleteWords(plugins, words) {
+		fmt.Println(candidate)
+	}
+	return nil
+}
+
+// CommandHelpCompletion prints the completion script for a shell
+func CommandHelpCompletion(shell string) error {
+	script, err := CompletionScript(shell)
+	if err != nil {
+		return err
+	}
+	fmt.Print(script)
+	return nil
+}
+
+// CompletionScript returns the completion script for a shell. The scripts ask
+// `clair help --complete` for candidates, so they pick up newly installed
+// plugins and apps without being regenerated.
+func CompletionScript(shell string) (string, error) {
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "fish":
+		return fishCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	}
+	return "", fmt.Errorf("Invalid shell %s: must be one of %s", shell, strings.Join(completionShells, ", "))
+}
+
+const bashCompletion = `# bash completion for clair, generated by ` + "`clair help --completion bash`" + `
+_clair() {
+  local cur words cword
+  _get_comp_words_by_ref -n : cur words cword
+
+  local IFS=$'\n'
+  COMPREPLY=($(clair --quiet help --complete -- "${words[@]:1:cword}" 2>/dev/null))
+  __ltrim_colon_completions "$cur"
+} && complete -F _clair clair
+`
+
+const fishCompletion = `# fish completion for clair, generated by ` + "`clair help --completion fish`" + `
+function __clair_complete
+    set -l words (commandline -opc) (commandline -ct)
+    clair --quiet help --complete -- $words[2..-1] 2>/dev/null
+end
+
+complete -c clair -f -a '(__clair_complete)'
+`
+
+const zshCompletion = `#compdef clair
+# zsh completion for clair, generated by ` + "`clair help --completion zsh`" + `
+_clair() {
+  local -a candidates
+  candidates=("${(@f)$(clair --quiet help --complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+  compadd -Q -- "${candidates[@]}"
+}
+
+if [[ "$funcstack[1]" == "_clair" ]]; then
+  _clair "$@"
+else
+  compdef _clair clair
+fi
+`
+
+// FormatManPage returns a clair(1) man page documenting the plugin commands
+func FormatManPage(plugins []PluginHelp, version string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH CLAIR 1 \"\" \"%s\" \"User Commands\"\n", manEscape(strings.TrimSpace("clair "+version)))
+	b.WriteString(".SH NAME\n")
+	b.WriteString("clair \\- configure and get information from your clair installation\n")
+	b.WriteString(".SH SYNOPSIS\n")
+	b.WriteString(".B clair\n")
+	b.WriteString("[\\fB\\-\\-quiet\\fR|\\fB\\-\\-trace\\fR|\\fB\\-\\-force\\fR] \\fICOMMAND\\fR <app> [command-specific-options]\n")
+	b.WriteString(".SH DESCRIPTION\n")
+	b.WriteString("Run \\fBclair help \\-\\-all\\fR to list every command, or \\fBclair COMMAND:help\\fR for the commands of a plugin.\n")
+	b.WriteString(".SH COMMANDS\n")
+	for _, plugin := range plugins {
+		fmt.Fprintf(&b, ".SS %s\n", manEscape(plugin.Name))
+		if plugin.Description != "" {
+			b.WriteString(manEscape(plugin.Description) + "\n")
+		}
+		for _, command := range plugin.Commands {
+			b.WriteString(".TP\n")
+			fmt.Fprintf(&b, ".B %s\n", manEscape(command.Usage))
+			b.WriteString(manEscape(command.Description) + "\n")
+			flags := command.AllFlags()
+			if len(flags) == 0 {
+				continue
+			}
+			b.WriteString(".RS\n")
+			for _, f := range flags {
+				b.WriteString(".TP\n")
+				fmt.Fprintf(&b, "\\fB\\-\\-%s\\fR\n", manEscape(f.Name))
+				b.WriteString(manEscape(f.summary()) + "\n")
+			}
+			b.WriteString(".RE\n")
+		}
+	}
+	b.WriteString(".SH SHELL COMPLETION\n")
+	fmt.Fprintf(&b, "Completion scripts for %s are printed by \\fBclair help \\-\\-completion SHELL\\fR.\n", strings.Join(completionShells, ", "))
+	return b.String()
+}
+
+func manEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\e")
+	text = strings.ReplaceAll(text, "-", "\\-")
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = "\\&" + text
+	}
+	return text
+}
+
+func clairVersion() string {
+	libRoot := GetenvWithDefault("CLAIR_LIB_ROOT", "/var/lib/clair")
+	for _, file := range []string{"STABLE_VERSION", "VERSION"} {
+		if b, err := ioutil.ReadFile(filepath.Join(libRoot, file)); err == nil {
+			return strings.TrimSpace(string(b))
+		}
+	}
+	return ""
+}
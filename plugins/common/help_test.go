@@ -0,0 +1,67 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonParseHelpLines(t *testing.T) {
+	RegisterTestingT(t)
+
+	plugins := ParseHelpLines("\n" +
+		"    nginx, Manage the nginx proxy\n" +
+		"    nginx:build-config <app>, (Re)builds nginx config for given app\n" +
+		"    webhooks:add <url> [--events <event,...>], Add a webhook, notified about app events\n" +
+		"not a command line\n")
+
+	Expect(plugins).To(HaveLen(2))
+	Expect(plugins[0].Name).To(Equal("nginx"))
+	Expect(plugins[0].Description).To(Equal("Manage the nginx proxy"))
+	Expect(plugins[0].Commands).To(Equal([]CommandHelp{{
+		Name:        "nginx:build-config",
+		Usage:       "nginx:build-config <app>",
+		Description: "(Re)builds nginx config for given app",
+		Args:        []Arg{{Name: "app", Complete: CompleteApp}},
+	}}))
+	Expect(plugins[1].Commands[0].Usage).To(Equal("webhooks:add <url> [--events <event,...>]"))
+	Expect(plugins[1].Commands[0].Description).To(Equal("Add a webhook, notified about app events"))
+}
+
+func TestCommonPluginHelpJSON(t *testing.T) {
+	RegisterTestingT(t)
+	p, _ := newTestPlugin()
+
+	b, err := json.Marshal(p.Help())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(ContainSubstring(`{"name":"limit","kind":"int","default":"20"`))
+
+	var decoded PluginHelp
+	Expect(json.Unmarshal(b, &decoded)).To(Succeed())
+	Expect(decoded).To(Equal(p.Help()))
+	Expect(CompleteWords([]PluginHelp{decoded}, []string{"sdk-test:query", "--format", ""})).To(Equal([]string{"stdout", "json"}))
+}
+
+func TestCommonFormatManPage(t *testing.T) {
+	RegisterTestingT(t)
+	p, _ := newTestPlugin()
+
+	page := FormatManPage([]PluginHelp{p.Help()}, "0.30.9")
+	Expect(page).To(HavePrefix(".TH CLAIR 1 \"\" \"clair 0.30.9\" \"User Commands\"\n"))
+	Expect(page).To(ContainSubstring(".SS sdk\\-test\nExercise the plugin sdk\n"))
+	Expect(page).To(ContainSubstring(".TP\n.B sdk\\-test:unset [\\-\\-global|<app>] <key>\nUnset a property\n.RS\n.TP\n\\fB\\-\\-global\\fR\nact on the global settings instead of an app\n.RE\n"))
+	Expect(page).To(ContainSubstring("\\fB\\-\\-global\\fR\nset a global property\n"))
+}
+
+func TestCommonCompletionScript(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, shell := range []string{"bash", "fish", "zsh"} {
+		script, err := CompletionScript(shell)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(script).To(ContainSubstring("clair --quiet help --complete --"))
+	}
+	_, err := CompletionScript("tcsh")
+	Expect(err).To(MatchError("Invalid shell tcsh: must be one of bash, fish, zsh"))
+}
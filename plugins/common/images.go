@@ -0,0 +1,276 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageInfo contains the details of a single image
+type ImageInfo struct {
+	ID      string            `json:"id"`
+	Tags    []string          `json:"tags"`
+	Created time.Time         `json:"created"`
+	Size    int64             `json:"size"`
+	Labels  map[string]string `json:"labels"`
+	Stage   string            `json:"stage"`
+	InUse   bool              `json:"in_use"`
+}
+
+type imageInspectResult struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+	Created  string   `json:"Created"`
+	Size     int64    `json:"Size"`
+	Config   struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// AppImages returns all tagged images labeled with the app name or in the app
+// image repository, newest first
+func AppImages(appName string) ([]ImageInfo, error) {
+	runtime := GetContainerRuntime()
+	filters := []string{"dangling=false", fmt.Sprintf("label=%s=%v", AppNameLabel, appName)}
+	imageIDs, err := runtime.ImageList(NewListOptions(false, filters...))
+	if err != nil {
+		return []ImageInfo{}, err
+	}
+
+	// release images retagged by an app rename or clone keep their old label
+	repoImageIDs, err := runtime.ImageList(NewListOptions(false, fmt.Sprintf("reference=%s", GetAppImageRepo(appName))))
+	if err != nil {
+		return []ImageInfo{}, err
+	}
+	imageIDs = append(imageIDs, repoImageIDs...)
+
+	images, err := InspectImages(imageIDs)
+	if err != nil {
+		return images, err
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+	return images, nil
+}
+
+// ExportImage writes a tar archive of an image to the writer. The image is saved
+// by id so that importing the archive never overwrites existing tags.
+func ExportImage(image string, w io.Writer) error {
+	images, err := InspectImages([]string{image})
+	if err != nil {
+		return err
+	}
+
+	archive, err := GetContainerRuntime().ImageSave([]string{images[0].ID})
+	if err != nil {
+		return fmt.Errorf("Unable to export image %s: %s", image, err.Error())
+	}
+
+	if _, err := io.Copy(w, archive); err != nil {
+		archive.Close()
+		return fmt.Errorf("Unable to export image %s: %s", image, err.Error())
+	}
+
+	return archive.Close()
+}
+
+// ImportAppImage loads a single image from a tar archive, tags it into the app
+// image repository and labels it with the app name, returning the new image name
+func ImportAppImage(appName string, archive io.Reader, imageTag string) (string, error) {
+	references, err := GetContainerRuntime().ImageLoad(archive)
+	if err != nil {
+		return "", fmt.Errorf("Unable to import image: %s", err.Error())
+	}
+
+	images, err := InspectImages(references)
+	if err != nil {
+		return "", fmt.Errorf("Unable to verify imported image: %s", err.Error())
+	}
+	if len(images) != 1 {
+		return "", fmt.Errorf("Image archive must contain exactly one image, found %d", len(images))
+	}
+
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+	image := fmt.Sprintf("%s:%s", GetAppImageRepo(appName), imageTag)
+	if err := GetContainerRuntime().ImageTag(images[0].ID, image); err != nil {
+		return "", fmt.Errorf("Unable to tag imported image: %s", err.Error())
+	}
+
+	if images[0].Labels[AppNameLabel] != appName {
+		labelCmd := NewShellCmdWithArgs("docker-image-labeler", "relabel", fmt.Sprintf("--label=%s=%s", AppNameLabel, appName), image)
+		labelCmd.ShowOutput = false
+		if b, err := labelCmd.CombinedOutput(); err != nil {
+			return "", fmt.Errorf("Unable to label imported image: %s", strings.TrimSpace(string(b)))
+		}
+	}
+
+	if !VerifyImage(image) {
+		return "", fmt.Errorf("Imported image %s not found", image)
+	}
+
+	return image, nil
+}
+
+// AppImageInventory returns every image held by an app, found either by the app
+// label or the app image repository, newest first and marked when in use
+func AppImageInventory(appName string) ([]ImageInfo, error) {
+	imageIDs, err := ListAppImageIDs(appName)
+	if err != nil {
+		return []ImageInfo{}, err
+	}
+
+	images, err := InspectImages(imageIDs)
+	if err != nil {
+		return images, err
+	}
+
+	for i := range images {
+		images[i].InUse = ImageInUse(images[i].ID)
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		return images[i].Created.After(images[j].Created)
+	})
+	return images, nil
+}
+
+// ListAppImageIDs returns the ids of all images labeled with the app name or in the app image repository
+func ListAppImageIDs(appName string) ([]string, error) {
+	runtime := GetContainerRuntime()
+	imageIDs, err := runtime.ImageList(NewListOptions(false, fmt.Sprintf("label=%s=%v", AppNameLabel, appName)))
+	if err != nil {
+		return []string{}, err
+	}
+
+	repoImageIDs, err := runtime.ImageList(NewListOptions(false, fmt.Sprintf("reference=%s", GetAppImageRepo(appName))))
+	if err != nil {
+		return imageIDs, err
+	}
+
+	seen := map[string]bool{}
+	uniqueImageIDs := []string{}
+	for _, imageID := range append(imageIDs, repoImageIDs...) {
+		if imageID == "" || seen[imageID] {
+			continue
+		}
+		seen[imageID] = true
+		uniqueImageIDs = append(uniqueImageIDs, imageID)
+	}
+
+	return uniqueImageIDs, nil
+}
+
+// InspectImages returns the details for a list of images
+func InspectImages(imageIDs []string) ([]ImageInfo, error) {
+	images := []ImageInfo{}
+	seen := map[string]bool{}
+	runtime := GetContainerRuntime()
+	for _, imageID := range imageIDs {
+		b, err := runtime.ImageInspect(imageID)
+		if err != nil {
+			return images, err
+		}
+
+		var result imageInspectResult
+		if err := json.Unmarshal(b, &result); err != nil {
+			return images, fmt.Errorf("Unable to parse image inspect output: %v", err)
+		}
+		if seen[result.ID] {
+			continue
+		}
+		seen[result.ID] = true
+
+		created, _ := time.Parse(time.RFC3339Nano, result.Created)
+		images = append(images, ImageInfo{
+			ID:      result.ID,
+			Tags:    result.RepoTags,
+			Created: created,
+			Size:    result.Size,
+			Labels:  result.Config.Labels,
+			Stage:   result.Config.Labels[ImageStageLabel],
+		})
+	}
+
+	return images, nil
+}
+
+// ImageInUse returns true if any container was created from the image
+func ImageInUse(imageID string) bool {
+	containerIDs, err := GetContainerRuntime().ContainerList(NewListOptions(true, fmt.Sprintf("ancestor=%s", imageID)))
+	if err != nil {
+		return true
+	}
+
+	return len(containerIDs) > 0
+}
+
+// RemoveImageInfos removes the app image repository tags of images, falling
+// back to the image id for untagged images. Tags of other repositories are
+// kept, so images tagged outside of the app repository are not removed.
+func RemoveImageInfos(appName string, images []ImageInfo) {
+	runtime := GetContainerRuntime()
+	prefix := GetAppImageRepo(appName) + ":"
+	for _, image := range images {
+		references := []string{}
+		for _, tag := range image.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				references = append(references, tag)
+			}
+		}
+		if len(image.Tags) == 0 {
+			references = []string{image.ID}
+		}
+		for _, reference := range references {
+			if err := runtime.ImageRemove(reference); err != nil {
+				LogDebug(fmt.Sprintf("Unable to remove image %s: %s", reference, err.Error()))
+			}
+		}
+	}
+}
+
+// FormatBytes returns a human readable representation of a byte count
+func FormatBytes(size int64) string {
+	const unit = 1000
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "kMGTPE"[exp])
+}
+
+// ParseBytes parses a byte count such as `500kB`, `10MB` or `1GB`
+func ParseBytes(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRight(strings.ToUpper(value), "KMGTPEB")
+	unit := strings.ToUpper(strings.TrimPrefix(strings.ToUpper(value), number))
+
+	multiplier := int64(1)
+	if unit != "" && unit != "B" {
+		i := strings.IndexByte("KMGTPE", unit[0])
+		if i == -1 || (len(unit) > 1 && unit[1:] != "B") {
+			return 0, fmt.Errorf("Invalid size %s: must be a size such as 500kB, 10MB or 1GB", value)
+		}
+		for ; i >= 0; i-- {
+			multiplier *= 1000
+		}
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("Invalid size %s: must be a size such as 500kB, 10MB or 1GB", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
@@ -0,0 +1,87 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonAppImageInventory(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.Images["sha256:1111"].Labels[ImageStageLabel] = "release"
+	runtime.Images["sha256:1111"].Created = time.Now()
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:3333",
+		RepoTags: []string{"clair/test-app-1:build"},
+		Created:  time.Now().Add(-time.Hour),
+		Size:     2000,
+	})
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:4444",
+		RepoTags: []string{"clair/other-app:latest"},
+	})
+
+	imageIDs, err := ListAppImageIDs(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(imageIDs).To(ConsistOf("sha256:1111", "sha256:2222", "sha256:3333"))
+
+	images, err := AppImageInventory(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(images).To(HaveLen(3))
+	Expect(images[0].ID).To(Equal("sha256:1111"))
+	Expect(images[0].Stage).To(Equal("release"))
+	Expect(images[0].InUse).To(BeTrue())
+	Expect(images[1].ID).To(Equal("sha256:3333"))
+	Expect(images[1].InUse).To(BeFalse())
+	Expect(images[1].Size).To(Equal(int64(2000)))
+}
+
+func TestCommonExportImportAppImage(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	var archive bytes.Buffer
+	Expect(ExportImage("clair/test-app-1:latest", &archive)).To(Succeed())
+
+	delete(runtime.Containers, "c1")
+	delete(runtime.Containers, "c2")
+	Expect(runtime.ImageRemove("sha256:1111")).To(Succeed())
+
+	image, err := ImportAppImage(testAppName, &archive, "imported")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(image).To(Equal("clair/test-app-1:imported"))
+	Expect(runtime.Images["sha256:1111"].RepoTags).To(Equal([]string{"clair/test-app-1:imported"}))
+
+	_, err = ImportAppImage(testAppName, bytes.NewBufferString("not an archive"), "")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCommonRemoveImageInfos(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:5555",
+		RepoTags: []string{"clair/test-app-1:release-1", "registry.example.com/shared:1"},
+		Labels:   map[string]string{AppNameLabel: testAppName},
+	})
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:6666",
+		RepoTags: []string{"clair/test-app-1:build", "clair/test-app-1:release-2"},
+		Labels:   map[string]string{AppNameLabel: testAppName},
+	})
+
+	images, err := InspectImages([]string{"sha256:2222", "sha256:5555", "sha256:6666"})
+	Expect(err).NotTo(HaveOccurred())
+	RemoveImageInfos(testAppName, images)
+
+	Expect(runtime.Images).NotTo(HaveKey("sha256:2222"))
+	Expect(runtime.Images).NotTo(HaveKey("sha256:6666"))
+	Expect(runtime.Images).To(HaveKey("sha256:5555"))
+	Expect(runtime.Images["sha256:5555"].RepoTags).To(Equal([]string{"registry.example.com/shared:1"}))
+}
@@ -1,17 +1,31 @@
 package common
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type ErrWithExitCode interface {
 	ExitCode() int
 }
 
+// LogEntry is a single log message emitted when CLAIR_LOG_FORMAT is set to json
+type LogEntry struct {
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	App       string `json:"app"`
+	Plugin    string `json:"plugin"`
+	Command   string `json:"command"`
+	Timestamp string `json:"timestamp"`
+}
+
 type writer struct {
 	mu     *sync.Mutex
 	source string
@@ -43,12 +57,12 @@ func (w *writer) Write(bytes []byte) (int, error) {
 }
 
 func LogFail(text string) {
-	fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", text))
+	logMessage(os.Stderr, "fail", " !     ", text)
 	os.Exit(1)
 }
 
 func LogFailWithError(err error) {
-	fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", err.Error()))
+	logMessage(os.Stderr, "fail", " !     ", err.Error())
 	if errExit, ok := err.(ErrWithExitCode); ok {
 		os.Exit(errExit.ExitCode())
 	}
@@ -57,7 +71,7 @@ func LogFailWithError(err error) {
 
 func LogFailWithErrorQuiet(err error) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", err.Error()))
+		logMessage(os.Stderr, "fail", " !     ", err.Error())
 	}
 	if errExit, ok := err.(ErrWithExitCode); ok {
 		os.Exit(errExit.ExitCode())
@@ -67,52 +81,82 @@ func LogFailWithErrorQuiet(err error) {
 
 func LogFailQuiet(text string) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", text))
+		logMessage(os.Stderr, "fail", " !     ", text)
 	}
 	os.Exit(1)
 }
 
+// Log writes command output as is, without the json formatting of log messages
 func Log(text string) {
-	fmt.Println(text)
+	LogTo(os.Stdout, text)
+}
+
+// LogTo writes command output to w, such as the ctx.Stdout() of a trigger
+func LogTo(w io.Writer, text string) {
+	fmt.Fprintln(w, text)
 }
 
 func LogQuiet(text string) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		fmt.Println(text)
+		Log(text)
 	}
 }
 
 func LogInfo1(text string) {
-	fmt.Println(fmt.Sprintf("-----> %s", text))
+	LogInfo1To(os.Stdout, text)
+}
+
+func LogInfo1To(w io.Writer, text string) {
+	logMessage(w, "info1", "-----> ", text)
 }
 
 func LogInfo1Quiet(text string) {
+	LogInfo1QuietTo(os.Stdout, text)
+}
+
+func LogInfo1QuietTo(w io.Writer, text string) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		LogInfo1(text)
+		LogInfo1To(w, text)
 	}
 }
 
 func LogInfo2(text string) {
-	fmt.Println(fmt.Sprintf("=====> %s", text))
+	LogInfo2To(os.Stdout, text)
+}
+
+func LogInfo2To(w io.Writer, text string) {
+	logMessage(w, "info2", "=====> ", text)
 }
 
 func LogInfo2Quiet(text string) {
+	LogInfo2QuietTo(os.Stdout, text)
+}
+
+func LogInfo2QuietTo(w io.Writer, text string) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		LogInfo2(text)
+		LogInfo2To(w, text)
 	}
 }
 
 func LogVerbose(text string) {
-	fmt.Println(fmt.Sprintf("       %s", text))
+	LogVerboseTo(os.Stdout, text)
+}
+
+func LogVerboseTo(w io.Writer, text string) {
+	logMessage(w, "verbose", "       ", text)
 }
 
 func LogVerboseStderr(text string) {
-	fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", text))
+	logMessage(os.Stderr, "verbose", " !     ", text)
 }
 
 func LogVerboseQuiet(text string) {
+	LogVerboseQuietTo(os.Stdout, text)
+}
+
+func LogVerboseQuietTo(w io.Writer, text string) {
 	if os.Getenv("CLAIR_QUIET_OUTPUT") == "" {
-		LogVerbose(text)
+		LogVerboseTo(w, text)
 	}
 }
 
@@ -157,11 +201,11 @@ func LogVerboseQuietContainerLogsTail(containerID string, lines int, tail bool)
 
 // LogWarn is the warning log formatter
 func LogWarn(text string) {
-	fmt.Fprintln(os.Stderr, fmt.Sprintf(" !     %s", text))
+	logMessage(os.Stderr, "warn", " !     ", text)
 }
 
 func LogExclaim(text string) {
-	fmt.Println(fmt.Sprintf(" !     %s", text))
+	logMessage(os.Stdout, "exclaim", " !     ", text)
 }
 
 func LogStderr(text string) {
@@ -170,6 +214,48 @@ func LogStderr(text string) {
 
 func LogDebug(text string) {
 	if os.Getenv("CLAIR_TRACE") == "1" {
-		fmt.Fprintln(os.Stderr, fmt.Sprintf(" ?     %s", strings.TrimPrefix(text, " ?     ")))
+		logMessage(os.Stderr, "debug", " ?     ", strings.TrimPrefix(text, " ?     "))
+	}
+}
+
+// FormatLogLine formats a log message, either as decorated text or, when
+// CLAIR_LOG_FORMAT is set to json, as a single json object
+func FormatLogLine(level string, prefix string, text string) string {
+	if os.Getenv("CLAIR_LOG_FORMAT") != "json" {
+		return prefix + text
+	}
+
+	b, err := json.Marshal(LogEntry{
+		Level:     level,
+		Message:   text,
+		App:       os.Getenv("CLAIR_APP_NAME"),
+		Plugin:    logPluginName(),
+		Command:   logCommandName(),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return prefix + text
+	}
+	return string(b)
+}
+
+func logMessage(w io.Writer, level string, prefix string, text string) {
+	fmt.Fprintln(w, FormatLogLine(level, prefix, text))
+}
+
+// logPluginName returns the plugin the running binary belongs to, based on the
+// subcommands/<name> and <plugin>/<trigger> layout of plugin directories
+func logPluginName() string {
+	dir := filepath.Dir(os.Args[0])
+	if filepath.Base(dir) == "subcommands" {
+		dir = filepath.Dir(dir)
+	}
+	return filepath.Base(dir)
+}
+
+func logCommandName() string {
+	if command := os.Getenv("CLAIR_COMMAND"); command != "" {
+		return command
 	}
+	return filepath.Base(os.Args[0])
 }
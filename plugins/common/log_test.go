@@ -0,0 +1,49 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonFormatLogLine(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(FormatLogLine("info1", "-----> ", "Deploying")).To(Equal("-----> Deploying"))
+
+	Expect(os.Setenv("CLAIR_LOG_FORMAT", "json")).To(Succeed())
+	defer os.Unsetenv("CLAIR_LOG_FORMAT")
+	Expect(os.Setenv("CLAIR_APP_NAME", testAppName)).To(Succeed())
+	defer os.Unsetenv("CLAIR_APP_NAME")
+	Expect(os.Setenv("CLAIR_COMMAND", "apps:create")).To(Succeed())
+	defer os.Unsetenv("CLAIR_COMMAND")
+
+	var entry LogEntry
+	Expect(json.Unmarshal([]byte(FormatLogLine("warn", " !     ", `Unable to "lock"`)), &entry)).To(Succeed())
+	Expect(entry.Level).To(Equal("warn"))
+	Expect(entry.Message).To(Equal(`Unable to "lock"`))
+	Expect(entry.App).To(Equal(testAppName))
+	Expect(entry.Command).To(Equal("apps:create"))
+	Expect(entry.Plugin).NotTo(BeEmpty())
+	Expect(entry.Timestamp).NotTo(BeEmpty())
+}
+
+func TestCommonLogJSONFormatKeepsCommandOutput(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(os.Setenv("CLAIR_LOG_FORMAT", "json")).To(Succeed())
+	defer os.Unsetenv("CLAIR_LOG_FORMAT")
+
+	reader, writer, err := os.Pipe()
+	Expect(err).NotTo(HaveOccurred())
+	stdout := os.Stdout
+	os.Stdout = writer
+	Log(`[{"name":"test-app-1"}]`)
+	os.Stdout = stdout
+	Expect(writer.Close()).To(Succeed())
+
+	b, err := io.ReadAll(reader)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(Equal(`[{"name":"test-app-1"}]` + "\n"))
+}
@@ -0,0 +1,309 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricFamily is a group of prometheus samples sharing a name, help text and type
+type MetricFamily struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []MetricSample
+}
+
+// MetricSample is a single prometheus sample
+type MetricSample struct {
+	// Suffix is appended to the family name, such as _sum or _count
+	Suffix string
+	Labels map[string]string
+	Value  float64
+}
+
+type metricsCollector struct {
+	families map[string]*MetricFamily
+}
+
+func newMetricsCollector() *metricsCollector {
+	return &metricsCollector{families: map[string]*MetricFamily{}}
+}
+
+func (c *metricsCollector) add(name string, metricType string, help string, suffix string, labels map[string]string, value float64) {
+	family, ok := c.families[name]
+	if !ok {
+		family = &MetricFamily{Name: name, Help: help, Type: metricType}
+		c.families[name] = family
+	}
+	family.Samples = append(family.Samples, MetricSample{Suffix: suffix, Labels: labels, Value: value})
+}
+
+func (c *metricsCollector) gauge(name string, help string, labels map[string]string, value float64) {
+	c.add(name, "gauge", help, "", labels, value)
+}
+
+func (c *metricsCollector) counter(name string, help string, labels map[string]string, value float64) {
+	c.add(name, "counter", help, "", labels, value)
+}
+
+func (c *metricsCollector) list() []MetricFamily {
+	families := []MetricFamily{}
+	for _, family := range c.families {
+		samples := family.Samples
+		sort.SliceStable(samples, func(i, j int) bool {
+			return formatMetricLabels(samples[i].Labels)+samples[i].Suffix < formatMetricLabels(samples[j].Labels)+samples[j].Suffix
+		})
+		families = append(families, *family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// CollectMetrics gathers app, container, image, deploy and property store metrics.
+// Deploy metrics are read from the event log, so counters reset when it rotates.
+func CollectMetrics() ([]MetricFamily, error) {
+	c := newMetricsCollector()
+	apps, err := ClairApps()
+	if err != nil {
+		apps = []string{}
+	}
+
+	deployed, locked := 0, 0
+	for _, appName := range apps {
+		labels := map[string]string{"app": appName}
+		isDeployed := IsDeployed(appName)
+		if isDeployed {
+			deployed++
+		}
+		c.gauge("clair_app_deployed", "Whether the app has been deployed", labels, boolMetric(isDeployed))
+
+		lockedAt, isLocked := appDeployLockedAt(appName)
+		if isLocked {
+			locked++
+			c.gauge("clair_app_lock_age_seconds", "Seconds since the app deploy lock was created", labels, time.Since(lockedAt).Seconds())
+		}
+		c.gauge("clair_app_locked", "Whether the app has a deploy lock in place", labels, boolMetric(isLocked))
+
+		collectContainerMetrics(c, appName)
+		collectImageMetrics(c, appName)
+	}
+
+	c.gauge("clair_apps", "Number of apps", nil, float64(len(apps)))
+	c.gauge("clair_apps_deployed", "Number of deployed apps", nil, float64(deployed))
+	c.gauge("clair_apps_undeployed", "Number of apps that have not been deployed", nil, float64(len(apps)-deployed))
+	c.gauge("clair_apps_locked", "Number of apps with a deploy lock in place", nil, float64(locked))
+
+	if err := collectDeployMetrics(c, EventsLogFile()); err != nil {
+		return c.list(), err
+	}
+	if err := collectPropertyMetrics(c, filepath.Join(MustGetEnv("CLAIR_LIB_ROOT"), "config")); err != nil {
+		return c.list(), err
+	}
+
+	return c.list(), nil
+}
+
+// WriteMetrics writes metric families in the prometheus text exposition format
+func WriteMetrics(w io.Writer, families []MetricFamily) error {
+	for _, family := range families {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", family.Name, family.Help, family.Name, family.Type); err != nil {
+			return err
+		}
+
+		for _, sample := range family.Samples {
+			value := strconv.FormatFloat(sample.Value, 'g', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s%s %s\n", family.Name, sample.Suffix, formatMetricLabels(sample.Labels), value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func collectContainerMetrics(c *metricsCollector, appName string) {
+	containers, err := ContainerIndex(appName, "")
+	if err != nil {
+		LogDebug(fmt.Sprintf("Unable to list containers for %s: %s", appName, err.Error()))
+		return
+	}
+
+	counts := map[[2]string]int{}
+	for _, container := range containers {
+		counts[[2]string{container.ProcessType, container.State}]++
+	}
+	for key, count := range counts {
+		labels := map[string]string{"app": appName, "process_type": key[0], "state": key[1]}
+		c.gauge("clair_app_containers", "Number of app containers by process type and state", labels, float64(count))
+	}
+}
+
+func collectImageMetrics(c *metricsCollector, appName string) {
+	images, err := AppImageInventory(appName)
+	if err != nil {
+		LogDebug(fmt.Sprintf("Unable to list images for %s: %s", appName, err.Error()))
+		return
+	}
+
+	var inUse, reclaimable int64
+	for _, image := range images {
+		if image.InUse {
+			inUse += image.Size
+		} else {
+			reclaimable += image.Size
+		}
+	}
+
+	c.gauge("clair_app_images", "Number of images held by the app", map[string]string{"app": appName}, float64(len(images)))
+	c.gauge("clair_app_image_bytes", "Disk usage of app images", map[string]string{"app": appName, "state": "in_use"}, float64(inUse))
+	c.gauge("clair_app_image_bytes", "Disk usage of app images", map[string]string{"app": appName, "state": "reclaimable"}, float64(reclaimable))
+}
+
+func collectDeployMetrics(c *metricsCollector, path string) error {
+	events, err := QueryEvents(path, EventFilter{})
+	if err != nil {
+		return fmt.Errorf("Unable to read event log: %s", err.Error())
+	}
+
+	type deployStats struct {
+		deploys      int
+		failures     int
+		durationSum  float64
+		durations    int
+		lastDeploy   time.Time
+		lastFailure  time.Time
+		lastDuration float64
+	}
+
+	stats := map[string]*deployStats{}
+	for _, event := range events {
+		if event.Type != EventAppDeployed && event.Type != EventAppDeployFailed {
+			continue
+		}
+
+		s, ok := stats[event.App]
+		if !ok {
+			s = &deployStats{}
+			stats[event.App] = s
+		}
+
+		if event.Type == EventAppDeployed {
+			s.deploys++
+			s.lastDeploy = event.Timestamp
+		} else {
+			s.failures++
+			s.lastFailure = event.Timestamp
+		}
+
+		if duration, err := strconv.ParseFloat(event.Data["duration"], 64); err == nil {
+			s.durations++
+			s.durationSum += duration
+			s.lastDuration = duration
+		}
+	}
+
+	for appName, s := range stats {
+		labels := map[string]string{"app": appName}
+		c.counter("clair_app_deploys_total", "Number of successful deploys in the event log", labels, float64(s.deploys))
+		c.counter("clair_app_deploy_failures_total", "Number of failed deploys in the event log", labels, float64(s.failures))
+		if s.durations > 0 {
+			c.add("clair_app_deploy_duration_seconds", "summary", "Time taken by deploys in the event log", "_sum", labels, s.durationSum)
+			c.add("clair_app_deploy_duration_seconds", "summary", "Time taken by deploys in the event log", "_count", labels, float64(s.durations))
+			c.gauge("clair_app_last_deploy_duration_seconds", "Time taken by the most recent deploy", labels, s.lastDuration)
+		}
+		if !s.lastDeploy.IsZero() {
+			c.gauge("clair_app_last_deploy_timestamp_seconds", "Time of the most recent successful deploy", labels, float64(s.lastDeploy.Unix()))
+		}
+		if !s.lastFailure.IsZero() {
+			c.gauge("clair_app_last_deploy_failure_timestamp_seconds", "Time of the most recent failed deploy", labels, float64(s.lastFailure.Unix()))
+		}
+	}
+
+	return nil
+}
+
+func collectPropertyMetrics(c *metricsCollector, configPath string) error {
+	type storeStats struct {
+		files int
+		size  int64
+	}
+
+	stats := map[string]*storeStats{}
+	err := filepath.Walk(configPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(configPath, path)
+		if err != nil {
+			return err
+		}
+		pluginName := strings.SplitN(filepath.ToSlash(rel), "/", 2)[0]
+		s, ok := stats[pluginName]
+		if !ok {
+			s = &storeStats{}
+			stats[pluginName] = s
+		}
+		s.files++
+		s.size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("Unable to read property store: %s", err.Error())
+	}
+
+	for pluginName, s := range stats {
+		labels := map[string]string{"plugin": pluginName}
+		c.gauge("clair_property_store_bytes", "Size of the property store", labels, float64(s.size))
+		c.gauge("clair_property_store_files", "Number of files in the property store", labels, float64(s.files))
+	}
+	return nil
+}
+
+func appDeployLockedAt(appName string) (time.Time, bool) {
+	fi, err := os.Stat(filepath.Join(AppRoot(appName), ".deploy.lock"))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return fi.ModTime(), true
+}
+
+func boolMetric(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func formatMetricLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := []string{}
+	for _, key := range keys {
+		value := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[key])
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, key, value))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
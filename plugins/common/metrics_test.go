@@ -0,0 +1,87 @@
+package common
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonWriteMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	c := newMetricsCollector()
+	c.gauge("clair_apps", "Number of apps", nil, 2)
+	c.gauge("clair_app_locked", "Whether the app has a deploy lock in place", map[string]string{"app": "b"}, 0)
+	c.gauge("clair_app_locked", "Whether the app has a deploy lock in place", map[string]string{"app": `a"1`}, 1)
+
+	var out bytes.Buffer
+	Expect(WriteMetrics(&out, c.list())).To(Succeed())
+	Expect(out.String()).To(Equal(`# HELP clair_app_locked Whether the app has a deploy lock in place
+# TYPE clair_app_locked gauge
+clair_app_locked{app="a\"1"} 1
+clair_app_locked{app="b"} 0
+# HELP clair_apps Number of apps
+# TYPE clair_apps gauge
+clair_apps 2
+`))
+}
+
+func TestCommonCollectDeployMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "clair-events")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+	now := time.Unix(1700000000, 0).UTC()
+	events := []Event{
+		{Type: EventAppDeployed, App: testAppName, Data: map[string]string{"duration": "10.000"}, Timestamp: now.Add(-time.Hour)},
+		{Type: EventAppDeployFailed, App: testAppName, Data: map[string]string{"duration": "4.500"}, Timestamp: now.Add(-time.Minute)},
+		{Type: EventAppDeployed, App: testAppName, Timestamp: now},
+		{Type: EventAppLocked, App: testAppName, Timestamp: now},
+	}
+	for _, event := range events {
+		Expect(AppendEvent(path, event, EventLogRotation{})).To(Succeed())
+	}
+
+	c := newMetricsCollector()
+	Expect(collectDeployMetrics(c, path)).To(Succeed())
+
+	var out bytes.Buffer
+	Expect(WriteMetrics(&out, c.list())).To(Succeed())
+	Expect(out.String()).To(ContainSubstring(`clair_app_deploys_total{app="test-app-1"} 2`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_deploy_failures_total{app="test-app-1"} 1`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_deploy_duration_seconds_count{app="test-app-1"} 2`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_deploy_duration_seconds_sum{app="test-app-1"} 14.5`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_last_deploy_duration_seconds{app="test-app-1"} 4.5`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_last_deploy_timestamp_seconds{app="test-app-1"} 1.7e+09`))
+	Expect(out.String()).To(ContainSubstring("# TYPE clair_app_deploy_duration_seconds summary"))
+}
+
+func TestCommonCollectContainerAndPropertyMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	c := newMetricsCollector()
+	collectContainerMetrics(c, testAppName)
+
+	configPath, err := ioutil.TempDir("", "clair-config")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(configPath)
+	Expect(os.MkdirAll(filepath.Join(configPath, "apps", testAppName), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(configPath, "apps", testAppName, "created-at"), []byte("1700000000"), 0644)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(configPath, "apps", testAppName, "deploy-source"), []byte("git"), 0644)).To(Succeed())
+	Expect(collectPropertyMetrics(c, configPath)).To(Succeed())
+
+	var out bytes.Buffer
+	Expect(WriteMetrics(&out, c.list())).To(Succeed())
+	Expect(out.String()).To(ContainSubstring(`clair_app_containers{app="test-app-1",process_type="web",state="running"} 1`))
+	Expect(out.String()).To(ContainSubstring(`clair_app_containers{app="test-app-1",process_type="worker",state="exited"} 1`))
+	Expect(out.String()).To(ContainSubstring(`clair_property_store_bytes{plugin="apps"} 13`))
+	Expect(out.String()).To(ContainSubstring(`clair_property_store_files{plugin="apps"} 2`))
+}
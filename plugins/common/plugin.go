@@ -0,0 +1,567 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	flag "github.com/spf13/pflag"
+)
+
+// ArgKind is the type of a command flag or trigger argument
+type ArgKind int
+
+const (
+	// KindString is a free-form string value
+	KindString ArgKind = iota
+
+	// KindBool is a true or false value
+	KindBool
+
+	// KindInt is an integer value
+	KindInt
+)
+
+var argKindNames = map[ArgKind]string{
+	KindString: "string",
+	KindBool:   "bool",
+	KindInt:    "int",
+}
+
+// String returns the name of the kind
+func (k ArgKind) String() string {
+	return argKindNames[k]
+}
+
+// MarshalJSON encodes the kind by name
+func (k ArgKind) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.String())
+}
+
+// UnmarshalJSON decodes a kind name, treating unknown kinds as strings
+func (k *ArgKind) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return err
+	}
+	*k = KindString
+	for kind, kindName := range argKindNames {
+		if kindName == name {
+			*k = kind
+		}
+	}
+	return nil
+}
+
+// CompleteApp completes a flag or argument with the app names
+const CompleteApp = "app"
+
+// Flag is a flag accepted by a plugin command
+type Flag struct {
+	Name        string   `json:"name"`
+	Shorthand   string   `json:"shorthand,omitempty"`
+	Kind        ArgKind  `json:"kind"`
+	Default     string   `json:"default,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Required    bool     `json:"required,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Complete    string   `json:"complete,omitempty"`
+}
+
+// Arg is a positional argument accepted by a plugin command. Arguments
+// completing to an app name an existing app, App marks arguments naming an app
+// that may not exist yet, such as the new name of a renamed app.
+type Arg struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Optional    bool     `json:"optional,omitempty"`
+	Variadic    bool     `json:"variadic,omitempty"`
+	Values      []string `json:"values,omitempty"`
+	Complete    string   `json:"complete,omitempty"`
+	App         bool     `json:"app,omitempty"`
+}
+
+// Command is a plugin subcommand. Global commands accept --global in place of
+// their leading app argument, and InfoFlag commands accept a single report
+// flag selecting the value to display.
+type Command struct {
+	Name        string
+	Description string
+	Args        []Arg
+	Flags       []Flag
+	Global      bool
+	InfoFlag    bool
+	Run         func(ctx *Context) error
+}
+
+// TriggerArg is a positional argument passed to a plugin trigger
+type TriggerArg struct {
+	Name     string
+	Kind     ArgKind
+	Optional bool
+	Variadic bool
+}
+
+// Trigger is a plugin trigger handler. Handlers may be called in-process by
+// PluginTrigger and PluginTriggerOutput, so they must write their output to
+// ctx.Stdout() and return errors rather than exiting.
+type Trigger struct {
+	Name string
+	Args []TriggerArg
+	Run  func(ctx *Context) error
+}
+
+// Plugin holds the commands and triggers registered by a Go plugin
+type Plugin struct {
+	Name        string
+	Description string
+	commands    map[string]*Command
+	triggers    map[string]*Trigger
+}
+
+// UsageError is returned when a command or trigger is called with invalid arguments
+type UsageError struct {
+	Message string
+	Usage   string
+}
+
+// Error returns the usage error message along with the expected usage
+func (e *UsageError) Error() string {
+	if e.Usage == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("%s\nUsage: clair %s", e.Message, e.Usage)
+}
+
+var registeredPlugins = map[string]*Plugin{}
+
+// pluginOrderPrefix matches the numeric prefix plugin directories use to
+// control the order plugn calls them in, such as 20_events
+var pluginOrderPrefix = regexp.MustCompile(`^[0-9]+_`)
+
+// NewPlugin returns a plugin whose commands are namespaced under name
+func NewPlugin(name string, description string) *Plugin {
+	p := &Plugin{
+		Name:        name,
+		Description: description,
+		commands:    map[string]*Command{},
+		triggers:    map[string]*Trigger{},
+	}
+	registeredPlugins[name] = p
+	return p
+}
+
+// RegisteredPlugins returns the plugins compiled into the running binary
+func RegisteredPlugins() []*Plugin {
+	names := []string{}
+	for name := range registeredPlugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	plugins := []*Plugin{}
+	for _, name := range names {
+		plugins = append(plugins, registeredPlugins[name])
+	}
+	return plugins
+}
+
+// registeredTriggers returns the compiled in handlers of every enabled plugin
+// implementing a trigger, in the order plugn would call them. It returns false
+// when PLUGIN_PATH is unset or an implementing plugin is not compiled into the
+// running binary, in which case the trigger has to be dispatched via plugn.
+func registeredTriggers(triggerName string) ([]*Trigger, bool) {
+	pluginPath := os.Getenv("PLUGIN_PATH")
+	if pluginPath == "" {
+		return nil, false
+	}
+
+	files, err := filepath.Glob(filepath.Join(pluginPath, "enabled", "*", triggerName))
+	if err != nil {
+		return nil, false
+	}
+
+	triggers := []*Trigger{}
+	for _, file := range files {
+		plugin, ok := registeredPlugins[pluginOrderPrefix.ReplaceAllString(filepath.Base(filepath.Dir(file)), "")]
+		if !ok {
+			return nil, false
+		}
+
+		trigger, ok := plugin.triggers[triggerName]
+		if !ok {
+			return nil, false
+		}
+		triggers = append(triggers, trigger)
+	}
+	return triggers, true
+}
+
+// AddCommand registers a subcommand, panicking on duplicate names as that is
+// a programming error
+func (p *Plugin) AddCommand(command Command) {
+	if _, ok := p.commands[command.Name]; ok {
+		panic(fmt.Sprintf("command %s:%s registered twice", p.Name, command.Name))
+	}
+	p.commands[command.Name] = &command
+}
+
+// AddTrigger registers a trigger handler, panicking on duplicate names as that
+// is a programming error
+func (p *Plugin) AddTrigger(trigger Trigger) {
+	if _, ok := p.triggers[trigger.Name]; ok {
+		panic(fmt.Sprintf("trigger %s registered twice by %s", trigger.Name, p.Name))
+	}
+	p.triggers[trigger.Name] = &trigger
+}
+
+// Commands returns the registered subcommands sorted by name
+func (p *Plugin) Commands() []*Command {
+	names := []string{}
+	for name := range p.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	commands := []*Command{}
+	for _, name := range names {
+		commands = append(commands, p.commands[name])
+	}
+	return commands
+}
+
+// Command returns the subcommand called with the full command name, such as apps:list
+func (p *Plugin) Command(fullName string) (*Command, bool) {
+	if !strings.HasPrefix(fullName, p.Name+":") {
+		return nil, false
+	}
+	command, ok := p.commands[strings.TrimPrefix(fullName, p.Name+":")]
+	return command, ok
+}
+
+// Trigger returns the handler for a trigger
+func (p *Plugin) Trigger(name string) (*Trigger, bool) {
+	trigger, ok := p.triggers[name]
+	return trigger, ok
+}
+
+// Triggers returns the registered trigger handlers sorted by name
+func (p *Plugin) Triggers() []*Trigger {
+	names := []string{}
+	for name := range p.triggers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	triggers := []*Trigger{}
+	for _, name := range names {
+		triggers = append(triggers, p.triggers[name])
+	}
+	return triggers
+}
+
+// FullName returns the command name including the plugin namespace
+func (p *Plugin) FullName(command *Command) string {
+	return p.Name + ":" + command.Name
+}
+
+// Help returns the help metadata for the plugin and its commands
+func (p *Plugin) Help() PluginHelp {
+	help := PluginHelp{Name: p.Name, Description: p.Description, Commands: []CommandHelp{}}
+	for _, command := range p.Commands() {
+		commandHelp := CommandHelp{
+			Name:        p.FullName(command),
+			Description: command.Description,
+			Args:        command.Args,
+			Flags:       command.Flags,
+			Global:      command.Global,
+			InfoFlag:    command.InfoFlag,
+		}
+		commandHelp.Usage = commandHelp.Synopsis()
+		help.Commands = append(help.Commands, commandHelp)
+	}
+	return help
+}
+
+// Complete returns the completion candidates for the last word, where words
+// are the command line arguments following clair
+func (p *Plugin) Complete(words []string) []string {
+	return CompleteWords([]PluginHelp{p.Help()}, words)
+}
+
+// RunCommands is the main function of the plugin commands binary, printing help
+// for the plugin and exiting with CLAIR_NOT_IMPLEMENTED_EXIT for anything else
+func (p *Plugin) RunCommands() {
+	args := os.Args[1:]
+	cmd := ""
+	if len(args) > 0 {
+		cmd = args[0]
+	}
+
+	switch cmd {
+	case p.Name, p.Name + ":help":
+		fmt.Print(p.Help().Usage())
+	case "help":
+		flags := flag.NewFlagSet("help", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		all := flags.Bool("all", false, "--all: list every command")
+		format := flags.String("format", "stdout", "format: [ stdout | json ]")
+		flags.Parse(args[1:])
+
+		if *format == "json" {
+			if err := writeHelpJSON(p.Help()); err != nil {
+				LogFailWithError(err)
+			}
+		} else if *all {
+			fmt.Println(p.Help().HelpLines())
+		} else {
+			fmt.Printf("\n    %s, %s\n", p.Name, p.Description)
+		}
+	default:
+		clairNotImplementExitCode, err := strconv.Atoi(os.Getenv("CLAIR_NOT_IMPLEMENTED_EXIT"))
+		if err != nil {
+			fmt.Println("failed to retrieve CLAIR_NOT_IMPLEMENTED_EXIT environment variable")
+			clairNotImplementExitCode = 10
+		}
+		os.Exit(clairNotImplementExitCode)
+	}
+}
+
+// RunSubcommand is the main function of the plugin subcommands binary,
+// dispatching on the name it was invoked as
+func (p *Plugin) RunSubcommand() {
+	parts := strings.Split(os.Args[0], "/")
+	subcommand := parts[len(parts)-1]
+
+	var err error
+	if command, ok := p.commands[subcommand]; ok {
+		err = p.runCommand(command, os.Args[2:])
+	} else {
+		err = fmt.Errorf("Invalid plugin subcommand call: %s", subcommand)
+	}
+
+	if err != nil {
+		LogFailWithError(err)
+	}
+}
+
+// RunTrigger is the main function of the plugin triggers binary, dispatching
+// on the name it was invoked as
+func (p *Plugin) RunTrigger() {
+	parts := strings.Split(os.Args[0], "/")
+	name := parts[len(parts)-1]
+
+	var err error
+	if trigger, ok := p.triggers[name]; ok {
+		err = trigger.Call(os.Args[1:])
+	} else {
+		err = fmt.Errorf("Invalid plugin trigger call: %s", name)
+	}
+
+	if err != nil {
+		LogFailWithError(err)
+	}
+}
+
+func (p *Plugin) runCommand(command *Command, args []string) error {
+	help := p.Help()
+	var commandHelp CommandHelp
+	for _, c := range help.Commands {
+		if c.Name == p.FullName(command) {
+			commandHelp = c
+		}
+	}
+	usage := commandHelp.Usage
+
+	ctx := &Context{names: map[string]int{}}
+	if command.InfoFlag {
+		var err error
+		if args, ctx.infoFlag, err = ParseReportArgs(p.Name, args); err != nil {
+			return &UsageError{Message: err.Error(), Usage: usage}
+		}
+	}
+
+	flags := flag.NewFlagSet(p.FullName(command), flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	for _, f := range commandHelp.AllFlags() {
+		if err := addFlag(flags, f); err != nil {
+			return err
+		}
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Print(help.Usage())
+			return nil
+		}
+		return &UsageError{Message: err.Error(), Usage: usage}
+	}
+
+	for _, f := range command.Flags {
+		if f.Required && !flags.Changed(f.Name) {
+			return &UsageError{Message: fmt.Sprintf("Please specify the --%s flag", f.Name), Usage: usage}
+		}
+	}
+
+	ctx.flags = flags
+	ctx.args = flags.Args()
+	if command.Global {
+		if global, _ := flags.GetBool("global"); global {
+			ctx.args = append([]string{"--global"}, ctx.args...)
+		}
+	}
+
+	required := 0
+	variadic := false
+	for i, arg := range command.Args {
+		ctx.names[arg.Name] = i
+		if !arg.Optional {
+			required = i + 1
+		}
+		variadic = variadic || arg.Variadic
+	}
+	if len(ctx.args) < required {
+		return &UsageError{
+			Message: fmt.Sprintf("Please specify the %s argument", command.Args[len(ctx.args)].Name),
+			Usage:   usage,
+		}
+	}
+	if !variadic && len(ctx.args) > len(command.Args) {
+		return &UsageError{
+			Message: fmt.Sprintf("Unexpected argument %s", ctx.args[len(command.Args)]),
+			Usage:   usage,
+		}
+	}
+
+	return command.Run(ctx)
+}
+
+func addFlag(flags *flag.FlagSet, f Flag) error {
+	switch f.Kind {
+	case KindBool:
+		flags.BoolP(f.Name, f.Shorthand, ToBool(f.Default), f.Description)
+	case KindInt:
+		value := 0
+		if f.Default != "" {
+			var err error
+			if value, err = strconv.Atoi(f.Default); err != nil {
+				return fmt.Errorf("Invalid default for --%s: %s", f.Name, err.Error())
+			}
+		}
+		flags.IntP(f.Name, f.Shorthand, value, f.Description)
+	default:
+		flags.StringP(f.Name, f.Shorthand, f.Default, f.Description)
+	}
+	return nil
+}
+
+// Call validates the trigger arguments and calls the handler. Arguments past
+// the declared ones are ignored, as callers may pass more than a handler reads.
+func (t *Trigger) Call(args []string) error {
+	return t.call(args, os.Stdout)
+}
+
+func (t *Trigger) call(args []string, stdout io.Writer) error {
+	ctx := &Context{args: args, names: map[string]int{}, stdout: stdout}
+	for i, arg := range t.Args {
+		ctx.names[arg.Name] = i
+		if i >= len(args) {
+			if !arg.Optional && !arg.Variadic {
+				return &UsageError{Message: fmt.Sprintf("Trigger %s missing the %s argument", t.Name, arg.Name)}
+			}
+			continue
+		}
+
+		switch arg.Kind {
+		case KindBool:
+			if _, err := strconv.ParseBool(args[i]); err != nil && args[i] != "" {
+				return &UsageError{Message: fmt.Sprintf("Trigger %s argument %s must be a boolean", t.Name, arg.Name)}
+			}
+		case KindInt:
+			if _, err := strconv.Atoi(args[i]); err != nil && args[i] != "" {
+				return &UsageError{Message: fmt.Sprintf("Trigger %s argument %s must be an integer", t.Name, arg.Name)}
+			}
+		}
+	}
+	return t.Run(ctx)
+}
+
+// Context holds the flags and arguments a command or trigger was called with
+type Context struct {
+	flags    *flag.FlagSet
+	args     []string
+	names    map[string]int
+	infoFlag string
+	stdout   io.Writer
+}
+
+// Stdout returns the writer trigger output is captured from
+func (c *Context) Stdout() io.Writer {
+	if c.stdout == nil {
+		return os.Stdout
+	}
+	return c.stdout
+}
+
+// Args returns the positional arguments
+func (c *Context) Args() []string {
+	return c.args
+}
+
+// Arg returns the positional argument at index i, or an empty string
+func (c *Context) Arg(i int) string {
+	if i < 0 || i >= len(c.args) {
+		return ""
+	}
+	return c.args[i]
+}
+
+// Rest returns the positional arguments starting at the named argument
+func (c *Context) Rest(name string) []string {
+	i, ok := c.names[name]
+	if !ok || i >= len(c.args) {
+		return []string{}
+	}
+	return c.args[i:]
+}
+
+// String returns the value of a flag or named argument
+func (c *Context) String(name string) string {
+	if c.flags != nil && c.flags.Lookup(name) != nil {
+		return c.flags.Lookup(name).Value.String()
+	}
+	if i, ok := c.names[name]; ok {
+		return c.Arg(i)
+	}
+	return ""
+}
+
+// Bool returns the value of a boolean flag or named argument
+func (c *Context) Bool(name string) bool {
+	return ToBool(c.String(name))
+}
+
+// Int returns the value of an integer flag or named argument
+func (c *Context) Int(name string) int {
+	i, _ := strconv.Atoi(c.String(name))
+	return i
+}
+
+// Changed returns true if the flag was passed on the command line
+func (c *Context) Changed(name string) bool {
+	return c.flags != nil && c.flags.Changed(name)
+}
+
+// InfoFlag returns the report flag passed to an InfoFlag command
+func (c *Context) InfoFlag() string {
+	return c.infoFlag
+}
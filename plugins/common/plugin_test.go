@@ -0,0 +1,375 @@
+package common
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func newTestPlugin() (*Plugin, *Context) {
+	p := NewPlugin("sdk-test", "Exercise the plugin sdk")
+	called := &Context{}
+	p.AddCommand(Command{
+		Name:        "set",
+		Description: "Set a property",
+		Args:        []Arg{{Name: "key", Values: []string{"max-age", "max-size"}}, {Name: "value", Optional: true}},
+		Flags:       []Flag{{Name: "global", Kind: KindBool, Description: "--global: set a global property"}},
+		Run: func(ctx *Context) error {
+			*called = *ctx
+			return nil
+		},
+	})
+	p.AddCommand(Command{
+		Name:        "query",
+		Description: "Query things",
+		Flags: []Flag{
+			{Name: "limit", Kind: KindInt, Default: "20", Placeholder: "<count>"},
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}},
+		},
+		Run: func(ctx *Context) error {
+			*called = *ctx
+			return nil
+		},
+	})
+	p.AddCommand(Command{
+		Name:        "unset",
+		Description: "Unset a property",
+		Global:      true,
+		Args:        []Arg{{Name: "app", Complete: CompleteApp}, {Name: "key", Values: []string{"max-age", "max-size"}}},
+		Run: func(ctx *Context) error {
+			*called = *ctx
+			return nil
+		},
+	})
+	p.AddCommand(Command{
+		Name:        "report",
+		Description: "Report things",
+		InfoFlag:    true,
+		Args:        []Arg{{Name: "app", Optional: true}},
+		Flags:       []Flag{{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}}},
+		Run: func(ctx *Context) error {
+			*called = *ctx
+			return nil
+		},
+	})
+	p.AddTrigger(Trigger{
+		Name: "post-thing",
+		Args: []TriggerArg{{Name: "app"}, {Name: "count", Kind: KindInt}, {Name: "force", Kind: KindBool, Optional: true}},
+		Run: func(ctx *Context) error {
+			*called = *ctx
+			return nil
+		},
+	})
+	p.AddTrigger(Trigger{
+		Name: "thing-output",
+		Args: []TriggerArg{{Name: "app"}},
+		Run: func(ctx *Context) error {
+			fmt.Fprintf(ctx.Stdout(), "%s.", ctx.String("app"))
+			return nil
+		},
+	})
+	return p, called
+}
+
+// setupTestPluginPath creates a PLUGIN_PATH with the given trigger scripts
+// enabled per plugin directory, returning the path and a cleanup func
+func setupTestPluginPath(triggers map[string][]string) (string, func()) {
+	dir, err := ioutil.TempDir("", "clair-plugins")
+	Expect(err).NotTo(HaveOccurred())
+	for plugin, names := range triggers {
+		Expect(os.MkdirAll(filepath.Join(dir, "enabled", plugin), 0755)).To(Succeed())
+		for _, name := range names {
+			script := []byte("#!/bin/sh\nprintf '%s.' \"$1\"\n")
+			Expect(ioutil.WriteFile(filepath.Join(dir, "enabled", plugin, name), script, 0755)).To(Succeed())
+		}
+	}
+
+	pluginPath, hadPluginPath := os.LookupEnv("PLUGIN_PATH")
+	Expect(os.Setenv("PLUGIN_PATH", dir)).To(Succeed())
+	return dir, func() {
+		if hadPluginPath {
+			os.Setenv("PLUGIN_PATH", pluginPath)
+		} else {
+			os.Unsetenv("PLUGIN_PATH")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCommonPluginHelp(t *testing.T) {
+	RegisterTestingT(t)
+	p, _ := newTestPlugin()
+
+	help := p.Help()
+	Expect(help.HelpLines()).To(Equal("\n" +
+		"    sdk-test:query [--limit <count>] [--format stdout|json], Query things\n" +
+		"    sdk-test:report [<app>] [--format stdout|json] [<flag>], Report things\n" +
+		"    sdk-test:set <key> [<value>] [--global], Set a property\n" +
+		"    sdk-test:unset [--global|<app>] <key>, Unset a property\n"))
+	Expect(help.Usage()).To(HavePrefix("Usage: clair sdk-test[:COMMAND]\n\nExercise the plugin sdk\n\nAdditional commands:\n" +
+		"    sdk-test:query [--limit <count>] [--format stdout|json]  Query things\n"))
+	Expect(RegisteredPlugins()).To(ContainElement(p))
+	Expect(func() { p.AddCommand(Command{Name: "set"}) }).To(Panic())
+}
+
+func TestCommonPluginRunCommand(t *testing.T) {
+	RegisterTestingT(t)
+	p, called := newTestPlugin()
+	set, ok := p.Command("sdk-test:set")
+	Expect(ok).To(BeTrue())
+
+	Expect(p.runCommand(set, []string{"--global", "max-age", "1d"})).To(Succeed())
+	Expect(called.String("key")).To(Equal("max-age"))
+	Expect(called.String("value")).To(Equal("1d"))
+	Expect(called.Bool("global")).To(BeTrue())
+	Expect(called.Changed("global")).To(BeTrue())
+
+	err := p.runCommand(set, []string{})
+	Expect(err).To(MatchError("Please specify the key argument\nUsage: clair sdk-test:set <key> [<value>] [--global]"))
+	Expect(p.runCommand(set, []string{"a", "b", "c"})).To(MatchError(HavePrefix("Unexpected argument c")))
+	Expect(p.runCommand(set, []string{"--bogus", "a"})).To(MatchError(HavePrefix("unknown flag: --bogus")))
+
+	query, _ := p.Command("sdk-test:query")
+	Expect(p.runCommand(query, []string{})).To(Succeed())
+	Expect(called.Int("limit")).To(Equal(20))
+	Expect(called.String("format")).To(Equal("stdout"))
+	Expect(called.Changed("limit")).To(BeFalse())
+
+	unset, _ := p.Command("sdk-test:unset")
+	Expect(p.runCommand(unset, []string{"--global", "max-age"})).To(Succeed())
+	Expect(called.String("app")).To(Equal("--global"))
+	Expect(called.String("key")).To(Equal("max-age"))
+	Expect(p.runCommand(unset, []string{testAppName, "max-size"})).To(Succeed())
+	Expect(called.String("app")).To(Equal(testAppName))
+	Expect(p.runCommand(unset, []string{"--global"})).To(MatchError(HavePrefix("Please specify the key argument")))
+
+	report, _ := p.Command("sdk-test:report")
+	Expect(p.runCommand(report, []string{testAppName, "--sdk-test-dir", "--format", "json"})).To(Succeed())
+	Expect(called.String("app")).To(Equal(testAppName))
+	Expect(called.InfoFlag()).To(Equal("--sdk-test-dir"))
+	Expect(called.String("format")).To(Equal("json"))
+	Expect(p.runCommand(report, []string{"--a", "--b"})).To(MatchError(HavePrefix("sdk-test:report command allows only a single flag")))
+}
+
+func TestCommonPluginTrigger(t *testing.T) {
+	RegisterTestingT(t)
+	p, called := newTestPlugin()
+	trigger, ok := p.Trigger("post-thing")
+	Expect(ok).To(BeTrue())
+
+	Expect(trigger.Call([]string{testAppName, "3"})).To(Succeed())
+	Expect(called.String("app")).To(Equal(testAppName))
+	Expect(called.Int("count")).To(Equal(3))
+	Expect(called.Bool("force")).To(BeFalse())
+
+	Expect(trigger.Call([]string{testAppName})).To(MatchError("Trigger post-thing missing the count argument"))
+	Expect(trigger.Call([]string{testAppName, "three"})).To(MatchError("Trigger post-thing argument count must be an integer"))
+	Expect(trigger.Call([]string{testAppName, "3", "maybe"})).To(MatchError("Trigger post-thing argument force must be a boolean"))
+	Expect(trigger.Call([]string{testAppName, "3", "true", "extra"})).To(Succeed())
+	Expect(called.Args()).To(HaveLen(4))
+}
+
+func TestCommonPluginTriggerInProcess(t *testing.T) {
+	RegisterTestingT(t)
+	newTestPlugin()
+	other := NewPlugin("sdk-test-other", "Exercise in-process trigger dispatch")
+	other.AddTrigger(Trigger{
+		Name: "thing-output",
+		Run: func(ctx *Context) error {
+			fmt.Fprint(ctx.Stdout(), "other.")
+			return nil
+		},
+	})
+	dir, cleanup := setupTestPluginPath(map[string][]string{
+		"10_sdk-test":    {"thing-output"},
+		"sdk-test-other": {"thing-output"},
+	})
+	defer cleanup()
+
+	triggers, ok := registeredTriggers("thing-output")
+	Expect(ok).To(BeTrue())
+	Expect(triggers).To(HaveLen(2))
+	output, err := PluginTriggerOutput("thing-output", testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(output)).To(Equal(testAppName + ".other."))
+
+	Expect(PluginTriggerOutput("thing-output")).Error().To(MatchError("Trigger thing-output missing the app argument"))
+
+	triggers, ok = registeredTriggers("no-such-trigger")
+	Expect(ok).To(BeTrue())
+	Expect(triggers).To(BeEmpty())
+	Expect(PluginTriggerOutput("no-such-trigger", testAppName)).To(BeEmpty())
+
+	Expect(os.MkdirAll(filepath.Join(dir, "enabled", "shell-plugin"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "enabled", "shell-plugin", "thing-output"), []byte{}, 0755)).To(Succeed())
+	_, ok = registeredTriggers("thing-output")
+	Expect(ok).To(BeFalse())
+
+	os.Unsetenv("PLUGIN_PATH")
+	_, ok = registeredTriggers("thing-output")
+	Expect(ok).To(BeFalse())
+}
+
+// BenchmarkPluginTriggerOutput compares calling a trigger in-process with
+// dispatching it through plugn, which forks plugn and the trigger script
+func BenchmarkPluginTriggerOutput(b *testing.B) {
+	RegisterTestingT(b)
+	newTestPlugin()
+	_, cleanup := setupTestPluginPath(map[string][]string{"sdk-test": {"thing-output"}})
+	defer cleanup()
+
+	b.Run("in-process", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := PluginTriggerOutput("thing-output", testAppName); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("plugn", func(b *testing.B) {
+		if _, err := exec.LookPath("plugin"); err != nil {
+			b.Skip("plugn is not installed")
+		}
+		for i := 0; i < b.N; i++ {
+			if _, err := PluginTriggerSetup("thing-output", testAppName).Output(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func newTestSchedulerPlugin() {
+	scheduler := NewPlugin("sdk-test-scheduler", "Exercise report trigger dispatch")
+	scheduler.AddTrigger(Trigger{
+		Name: "scheduler-detect",
+		Args: []TriggerArg{{Name: "app"}},
+		Run: func(ctx *Context) error {
+			fmt.Fprint(ctx.Stdout(), "sdk-test")
+			return nil
+		},
+	})
+	scheduler.AddTrigger(Trigger{
+		Name: "scheduler-is-deployed",
+		Args: []TriggerArg{{Name: "scheduler"}, {Name: "app"}},
+		Run: func(ctx *Context) error {
+			if ctx.String("scheduler") != "sdk-test" {
+				return fmt.Errorf("unexpected scheduler %s", ctx.String("scheduler"))
+			}
+			return nil
+		},
+	})
+}
+
+// setupTestReport creates an app per name and a fake plugn on PATH that
+// records each invocation, returning the invocation log and a cleanup func
+func setupTestReport(dir string, appNames []string) (string, func()) {
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+
+	clairRoot := filepath.Join(os.Getenv("CLAIR_LIB_ROOT"), "home")
+	os.Setenv("CLAIR_ROOT", clairRoot)
+	for _, appName := range appNames {
+		Expect(os.MkdirAll(filepath.Join(clairRoot, appName), 0755)).To(Succeed())
+	}
+
+	forks := filepath.Join(dir, "forks")
+	Expect(os.MkdirAll(filepath.Join(dir, "bin"), 0755)).To(Succeed())
+	script := []byte("#!/bin/sh\necho \"$@\" >> " + forks + "\n")
+	Expect(ioutil.WriteFile(filepath.Join(dir, "bin", "plugin"), script, 0755)).To(Succeed())
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", filepath.Join(dir, "bin")+string(os.PathListSeparator)+path)
+	return forks, func() {
+		os.Setenv("PATH", path)
+		os.Setenv("CLAIR_ROOT", "/home/clair")
+		teardown()
+	}
+}
+
+func reportDeployed(appName string) string {
+	return strconv.FormatBool(IsDeployed(appName))
+}
+
+func TestCommonReportTriggersInProcess(t *testing.T) {
+	RegisterTestingT(t)
+	newTestSchedulerPlugin()
+	dir, cleanup := setupTestPluginPath(map[string][]string{
+		"sdk-test-scheduler": {"scheduler-detect", "scheduler-is-deployed"},
+	})
+	defer cleanup()
+	appNames := []string{testAppName, "test-app-2", "test-app-3"}
+	forks, teardown := setupTestReport(dir, appNames)
+	defer teardown()
+
+	for _, appName := range appNames {
+		report := CollectReport(appName, "", map[string]ReportFunc{"--app-deployed": reportDeployed})
+		Expect(report).To(Equal(map[string]string{"--app-deployed": "true"}))
+		Expect(PropertyGet("common", appName, "deployed")).To(Equal("true"))
+	}
+	Expect(forks).NotTo(BeAnExistingFile())
+
+	Expect(os.MkdirAll(filepath.Join(dir, "enabled", "shell-scheduler"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(dir, "enabled", "shell-scheduler", "scheduler-detect"), []byte{}, 0755)).To(Succeed())
+	Expect(PropertyDelete("common", testAppName, "deployed")).To(Succeed())
+	CollectReport(testAppName, "--app-deployed", map[string]ReportFunc{"--app-deployed": reportDeployed})
+	b, err := ioutil.ReadFile(forks)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(ContainSubstring("trigger scheduler-detect " + testAppName))
+}
+
+// BenchmarkReportDeployed compares reporting whether an app is deployed with
+// the scheduler triggers dispatched in-process and through plugn
+func BenchmarkReportDeployed(b *testing.B) {
+	RegisterTestingT(b)
+	newTestSchedulerPlugin()
+	dir, cleanup := setupTestPluginPath(map[string][]string{
+		"sdk-test-scheduler": {"scheduler-detect", "scheduler-is-deployed"},
+	})
+	defer cleanup()
+	plugn, plugnErr := exec.LookPath("plugin")
+	_, teardown := setupTestReport(dir, []string{testAppName})
+	defer teardown()
+
+	report := func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			PropertyDelete("common", testAppName, "deployed")
+			CollectReport(testAppName, "", map[string]ReportFunc{"--app-deployed": reportDeployed})
+		}
+	}
+	b.Run("in-process", report)
+
+	b.Run("plugn", func(b *testing.B) {
+		if plugnErr != nil {
+			b.Skip("plugn is not installed")
+		}
+		path := os.Getenv("PATH")
+		os.Setenv("PATH", filepath.Dir(plugn)+string(os.PathListSeparator)+path)
+		defer os.Setenv("PATH", path)
+		Expect(os.MkdirAll(filepath.Join(dir, "enabled", "shell-scheduler"), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "enabled", "shell-scheduler", "scheduler-detect"), []byte{}, 0755)).To(Succeed())
+		report(b)
+	})
+}
+
+func TestCommonPluginComplete(t *testing.T) {
+	RegisterTestingT(t)
+	p, _ := newTestPlugin()
+
+	Expect(p.Complete([]string{"sdk-test:"})).To(Equal([]string{"sdk-test:query", "sdk-test:report", "sdk-test:set", "sdk-test:unset"}))
+	Expect(p.Complete([]string{"sdk"})).To(Equal([]string{"sdk-test", "sdk-test:query", "sdk-test:report", "sdk-test:set", "sdk-test:unset"}))
+	Expect(p.Complete([]string{"--quiet", "sdk-test:s"})).To(Equal([]string{"sdk-test:set"}))
+	Expect(p.Complete([]string{"sdk-test:unset", "--global", "max-a"})).To(Equal([]string{"max-age"}))
+	Expect(p.Complete([]string{"sdk-test:unset", "--"})).To(Equal([]string{"--global"}))
+	Expect(p.Complete([]string{"sdk-test:s"})).To(Equal([]string{"sdk-test:set"}))
+	Expect(p.Complete([]string{"sdk-test:set", "max-"})).To(Equal([]string{"max-age", "max-size"}))
+	Expect(p.Complete([]string{"sdk-test:set", "--global", "max-s"})).To(Equal([]string{"max-size"}))
+	Expect(p.Complete([]string{"sdk-test:set", "max-age", "1d", ""})).To(BeEmpty())
+	Expect(p.Complete([]string{"sdk-test:query", "--"})).To(Equal([]string{"--limit", "--format"}))
+	Expect(p.Complete([]string{"sdk-test:query", "--format", "j"})).To(Equal([]string{"json"}))
+	Expect(p.Complete([]string{"other:query", ""})).To(BeEmpty())
+}
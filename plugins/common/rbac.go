@@ -0,0 +1,425 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// RoleAdmin may run every command
+	RoleAdmin = "admin"
+
+	// RoleDeployer may view apps, deploy them and manage their processes and config
+	RoleDeployer = "deployer"
+
+	// RoleViewer may only run commands that display information
+	RoleViewer = "viewer"
+)
+
+// Roles maps each built-in role to the scopes it grants
+var Roles = map[string][]string{
+	RoleAdmin: {"*"},
+	RoleDeployer: {
+		"*:read",
+		"apps:lock",
+		"apps:rollback",
+		"apps:unlock",
+		"config:*",
+		"deploy",
+		"git:*",
+		"ps:*",
+		"registry:pull",
+		"registry:push",
+	},
+	RoleViewer: {"*:read"},
+}
+
+// Grant gives a user or group a role, optionally limited to apps matching a
+// name pattern or carrying a label
+type Grant struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"subject"`
+	Role      string    `json:"role"`
+	App       string    `json:"app,omitempty"`
+	Label     string    `json:"label,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsScoped returns true if the grant is limited to some apps
+func (g Grant) IsScoped() bool {
+	return g.App != "" || g.Label != ""
+}
+
+// MatchesApp returns true if the grant applies to the app
+func (g Grant) MatchesApp(appName string, labels map[string]string) bool {
+	if g.App != "" {
+		if matched, _ := path.Match(g.App, appName); !matched {
+			return false
+		}
+	}
+	if g.Label != "" {
+		key, value := splitLabel(g.Label)
+		if v, ok := labels[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// RBACEnabled returns true if commands are authorized against the configured grants
+func RBACEnabled() bool {
+	return ToBool(PropertyGet("auth", "--global", "enabled"))
+}
+
+// RBACApplies returns true if the user is subject to the configured grants.
+// Only ssh sessions, which run as the system user, are checked; root and
+// local users invoking clair through sudo are trusted.
+func RBACApplies(sshUser string) bool {
+	return sshUser == GetenvWithDefault("CLAIR_SYSTEM_USER", "clair") && RBACEnabled()
+}
+
+// AuthorizeCommand returns an error unless the user may run the command
+// against the app
+func AuthorizeCommand(sshUser string, keyName string, command string, appName string) error {
+	if !RBACApplies(sshUser) {
+		return nil
+	}
+
+	grants, err := UserGrants(keyName)
+	if err != nil {
+		return err
+	}
+
+	scope := CommandScope(command)
+	labels := GetAppLabels(appName)
+	for _, grant := range grants {
+		if !scopeAllows(Roles[grant.Role], scope) {
+			continue
+		}
+		if appName == "" {
+			if !grant.IsScoped() || strings.HasSuffix(scope, ":read") {
+				return nil
+			}
+			continue
+		}
+		if grant.MatchesApp(appName, labels) {
+			return nil
+		}
+	}
+
+	if appName == "" {
+		return fmt.Errorf("%s is not allowed to run %s", keyName, command)
+	}
+	return fmt.Errorf("%s is not allowed to run %s on %s", keyName, command, appName)
+}
+
+// AuthorizeInvocation returns an error unless the user may run the command
+// invocation against every app it names
+func AuthorizeInvocation(sshUser string, keyName string, args []string) error {
+	if len(args) == 0 || !RBACApplies(sshUser) {
+		return nil
+	}
+
+	appNames := CommandAppNames(args)
+	if len(appNames) == 0 {
+		return AuthorizeCommand(sshUser, keyName, args[0], "")
+	}
+	for _, appName := range appNames {
+		if err := AuthorizeCommand(sshUser, keyName, args[0], appName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FilterAppsForUser returns the apps the user has been granted any role on
+func FilterAppsForUser(keyName string, apps []string) ([]string, error) {
+	grants, err := UserGrants(keyName)
+	if err != nil {
+		return []string{}, err
+	}
+
+	filteredApps := []string{}
+	for _, appName := range apps {
+		labels := GetAppLabels(appName)
+		for _, grant := range grants {
+			if grant.MatchesApp(appName, labels) {
+				filteredApps = append(filteredApps, appName)
+				break
+			}
+		}
+	}
+	return filteredApps, nil
+}
+
+// UserGrants returns the grants given to a user directly or through their groups
+func UserGrants(keyName string) ([]Grant, error) {
+	grants, err := GetGrants()
+	if err != nil {
+		return grants, err
+	}
+
+	subjects := map[string]bool{"user:" + keyName: true}
+	for _, group := range UserGroups(keyName) {
+		subjects["group:"+group] = true
+	}
+
+	userGrants := []Grant{}
+	for _, grant := range grants {
+		if subjects[grant.Subject] {
+			userGrants = append(userGrants, grant)
+		}
+	}
+	return userGrants, nil
+}
+
+// GetGrants returns every configured grant
+func GetGrants() ([]Grant, error) {
+	grants := []Grant{}
+	lines, err := PropertyListGet("auth", "--global", "grants")
+	if err != nil {
+		return grants, err
+	}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var grant Grant
+		if err := json.Unmarshal([]byte(line), &grant); err != nil {
+			LogWarn(fmt.Sprintf("Skipping invalid grant entry: %s", err.Error()))
+			continue
+		}
+		grants = append(grants, grant)
+	}
+	return grants, nil
+}
+
+// AddGrant stores a new grant
+func AddGrant(subject string, role string, app string, label string) (Grant, error) {
+	grant := Grant{Subject: subject, Role: role, App: app, Label: label, CreatedAt: time.Now().UTC()}
+	if err := validateSubject(subject); err != nil {
+		return grant, err
+	}
+	if _, ok := Roles[role]; !ok {
+		return grant, fmt.Errorf("Invalid role %s: must be one of %s", role, strings.Join(RoleNames(), ", "))
+	}
+	if _, err := path.Match(app, ""); err != nil {
+		return grant, fmt.Errorf("Invalid app pattern %s", app)
+	}
+	if label != "" {
+		if key, _ := splitLabel(label); key == "" || !strings.Contains(label, "=") {
+			return grant, fmt.Errorf("Invalid label %s: must be of the form key=value", label)
+		}
+	}
+
+	id, err := randomHex(4)
+	if err != nil {
+		return grant, err
+	}
+	grant.ID = id
+
+	b, err := json.Marshal(grant)
+	if err != nil {
+		return grant, err
+	}
+	return grant, PropertyListAdd("auth", "--global", "grants", string(b), 0)
+}
+
+// RemoveGrant removes a grant by id
+func RemoveGrant(id string) error {
+	grants, err := GetGrants()
+	if err != nil {
+		return err
+	}
+
+	lines := []string{}
+	for _, grant := range grants {
+		if grant.ID == id {
+			continue
+		}
+		b, err := json.Marshal(grant)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(b))
+	}
+	if len(lines) == len(grants) {
+		return fmt.Errorf("Grant %s not found", id)
+	}
+
+	return PropertyListWrite("auth", "--global", "grants", lines)
+}
+
+// RoleNames returns the names of the built-in roles
+func RoleNames() []string {
+	names := []string{}
+	for name := range Roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetGroups returns every group and its members
+func GetGroups() (map[string][]string, error) {
+	groups := map[string][]string{}
+	properties, err := PropertyGetAll("auth", "--global")
+	if err != nil {
+		return groups, err
+	}
+
+	for property := range properties {
+		if !strings.HasPrefix(property, "group.") {
+			continue
+		}
+
+		group := strings.TrimPrefix(property, "group.")
+		members, err := PropertyListGet("auth", "--global", property)
+		if err != nil {
+			return groups, err
+		}
+		groups[group] = removeEmptyEntries(members)
+	}
+	return groups, nil
+}
+
+// UserGroups returns the groups a user belongs to
+func UserGroups(keyName string) []string {
+	groups, err := GetGroups()
+	if err != nil {
+		return []string{}
+	}
+
+	userGroups := []string{}
+	for group, members := range groups {
+		for _, member := range members {
+			if member == keyName {
+				userGroups = append(userGroups, group)
+				break
+			}
+		}
+	}
+	sort.Strings(userGroups)
+	return userGroups
+}
+
+// AddGroupMember adds a user to a group, creating the group if needed
+func AddGroupMember(group string, keyName string) error {
+	if err := validateName("group", group); err != nil {
+		return err
+	}
+	if err := validateName("user", keyName); err != nil {
+		return err
+	}
+
+	members, err := PropertyListGet("auth", "--global", "group."+group)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member == keyName {
+			return fmt.Errorf("%s is already a member of %s", keyName, group)
+		}
+	}
+
+	return PropertyListAdd("auth", "--global", "group."+group, keyName, 0)
+}
+
+// RemoveGroupMember removes a user from a group, removing the group once empty
+func RemoveGroupMember(group string, keyName string) error {
+	if err := validateName("group", group); err != nil {
+		return err
+	}
+	if err := PropertyListRemove("auth", "--global", "group."+group, keyName); err != nil {
+		return err
+	}
+
+	members, err := PropertyListGet("auth", "--global", "group."+group)
+	if err == nil && len(removeEmptyEntries(members)) == 0 {
+		return PropertyDelete("auth", "--global", "group."+group)
+	}
+	return err
+}
+
+// GetAppLabels returns the labels used to grant access to an app
+func GetAppLabels(appName string) map[string]string {
+	labels := map[string]string{}
+	if appName == "" {
+		return labels
+	}
+
+	lines, err := PropertyListGet("auth", appName, "labels")
+	if err != nil {
+		return labels
+	}
+	for _, line := range lines {
+		if key, value := splitLabel(line); key != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// SetAppLabel sets or, when the value is empty, removes an app label
+func SetAppLabel(appName string, key string, value string) error {
+	if err := validateName("label", key); err != nil {
+		return err
+	}
+	if _, ok := GetAppLabels(appName)[key]; ok {
+		if err := PropertyListRemoveByPrefix("auth", appName, "labels", key+"="); err != nil {
+			return err
+		}
+	}
+	if value == "" {
+		return nil
+	}
+	return PropertyListAdd("auth", appName, "labels", key+"="+value, 0)
+}
+
+func splitLabel(label string) (string, string) {
+	parts := strings.SplitN(strings.TrimSpace(label), "=", 2)
+	if len(parts) != 2 {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
+
+func scopeAllows(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == "*" || g == scope {
+			return true
+		}
+		if strings.HasSuffix(g, ":*") && strings.HasPrefix(scope, strings.TrimSuffix(g, "*")) {
+			return true
+		}
+		if strings.HasPrefix(g, "*:") && strings.HasSuffix(scope, strings.TrimPrefix(g, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateName(kind string, name string) error {
+	if name == "" {
+		return fmt.Errorf("Please specify a %s name", kind)
+	}
+	if strings.ContainsAny(name, "/:= \t\n") || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("Invalid %s name %s", kind, name)
+	}
+	return nil
+}
+
+func validateSubject(subject string) error {
+	parts := strings.SplitN(subject, ":", 2)
+	if len(parts) != 2 || (parts[0] != "user" && parts[0] != "group") {
+		return errors.New("Invalid subject: must be of the form user:<key-name> or group:<group>")
+	}
+	return validateName(parts[0], parts[1])
+}
@@ -0,0 +1,81 @@
+package common
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonRBACScopes(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(CommandScope("deploy")).To(Equal("deploy"))
+	Expect(CommandScope("report")).To(Equal("report:read"))
+
+	Expect(scopeAllows(Roles[RoleViewer], "apps:read")).To(BeTrue())
+	Expect(scopeAllows(Roles[RoleViewer], "apps:lock")).To(BeFalse())
+	Expect(scopeAllows(Roles[RoleDeployer], "deploy")).To(BeTrue())
+	Expect(scopeAllows(Roles[RoleDeployer], "ps:restart")).To(BeTrue())
+	Expect(scopeAllows(Roles[RoleDeployer], "apps:destroy")).To(BeFalse())
+	Expect(scopeAllows(Roles[RoleAdmin], "apps:destroy")).To(BeTrue())
+
+	grant := Grant{App: "payments-*", Label: "env=prod"}
+	Expect(grant.MatchesApp("payments-api", map[string]string{"env": "prod"})).To(BeTrue())
+	Expect(grant.MatchesApp("payments-api", map[string]string{"env": "staging"})).To(BeFalse())
+	Expect(grant.MatchesApp("billing", map[string]string{"env": "prod"})).To(BeFalse())
+}
+
+func TestCommonRBACAuthorize(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	Expect(AuthorizeCommand("root", "alice", "apps:destroy", "payments-api")).To(Succeed())
+	Expect(PropertyWrite("auth", "--global", "enabled", "true")).To(Succeed())
+
+	Expect(AuthorizeCommand("root", "alice", "apps:destroy", "payments-api")).To(MatchError("alice is not allowed to run apps:destroy on payments-api"))
+	Expect(AuthorizeCommand("ubuntu", "default", "apps:destroy", "payments-api")).To(Succeed())
+
+	_, err = AddGrant("user:alice", "owner", "", "")
+	Expect(err).To(MatchError("Invalid role owner: must be one of admin, deployer, viewer"))
+	_, err = AddGrant("alice", RoleViewer, "", "")
+	Expect(err).To(HaveOccurred())
+
+	_, err = AddGrant("user:alice", RoleViewer, "", "")
+	Expect(err).NotTo(HaveOccurred())
+	grant, err := AddGrant("group:payments", RoleDeployer, "payments-*", "")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = AddGrant("group:payments", RoleAdmin, "", "env=staging")
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(AuthorizeCommand("root", "alice", "apps:report", "billing")).To(Succeed())
+	Expect(AuthorizeCommand("root", "alice", "deploy", "payments-api")).NotTo(Succeed())
+
+	Expect(AddGroupMember("payments", "alice")).To(Succeed())
+	Expect(AddGroupMember("payments", "alice")).To(MatchError("alice is already a member of payments"))
+	Expect(UserGroups("alice")).To(Equal([]string{"payments"}))
+	Expect(AuthorizeCommand("root", "alice", "deploy", "payments-api")).To(Succeed())
+	Expect(AuthorizeCommand("root", "alice", "deploy", "billing")).NotTo(Succeed())
+	Expect(AuthorizeCommand("root", "alice", "apps:create", "")).NotTo(Succeed())
+	Expect(AuthorizeCommand("root", "alice", "apps:destroy", "payments-api")).NotTo(Succeed())
+
+	Expect(SetAppLabel("payments-api", "env", "prod")).To(Succeed())
+	Expect(SetAppLabel("payments-api", "team", "payments")).To(Succeed())
+	Expect(SetAppLabel("payments-api", "env", "staging")).To(Succeed())
+	Expect(GetAppLabels("payments-api")).To(Equal(map[string]string{"env": "staging", "team": "payments"}))
+	Expect(AuthorizeCommand("root", "alice", "apps:destroy", "payments-api")).To(Succeed())
+
+	apps, err := FilterAppsForUser("bob", []string{"billing", "payments-api"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(apps).To(BeEmpty())
+
+	Expect(RemoveGrant(grant.ID)).To(Succeed())
+	Expect(RemoveGrant(grant.ID)).To(MatchError("Grant " + grant.ID + " not found"))
+	Expect(SetAppLabel("payments-api", "env", "")).To(Succeed())
+	Expect(AuthorizeCommand("root", "alice", "deploy", "payments-api")).NotTo(Succeed())
+
+	Expect(RemoveGroupMember("payments", "alice")).To(Succeed())
+	groups, err := GetGroups()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(groups).To(BeEmpty())
+}
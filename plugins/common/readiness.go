@@ -0,0 +1,318 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	readinessInitialBackoff = 250 * time.Millisecond
+	readinessMaxBackoff     = 5 * time.Second
+	readinessLogLines       = 20
+
+	// readinessStableWindow is how long a container without a HEALTHCHECK or
+	// readiness probe must have been running to be considered ready
+	readinessStableWindow = 2 * time.Second
+)
+
+// ReadinessProbe is a check run against a container to determine if it is ready
+type ReadinessProbe struct {
+	// Type is one of http, tcp or cmd
+	Type string
+
+	// Port is the container port used by http and tcp probes
+	Port string
+
+	// Path is the request path used by http probes
+	Path string
+
+	// Command is the command executed inside the container by cmd probes
+	Command string
+}
+
+// ContainerNotReadyError is returned when a container fails to become ready
+type ContainerNotReadyError struct {
+	ContainerID string
+	Reason      string
+	Logs        []string
+}
+
+// Error returns a description of the failure including the last container logs
+func (err *ContainerNotReadyError) Error() string {
+	message := fmt.Sprintf("Container %s is not ready: %s", err.ContainerID, err.Reason)
+	if len(err.Logs) == 0 {
+		return message
+	}
+
+	return fmt.Sprintf("%s\nLast %d lines of container output:\n%s", message, len(err.Logs), strings.Join(err.Logs, "\n"))
+}
+
+type readinessInspectResult struct {
+	Name   string `json:"Name"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+	State struct {
+		Status    string `json:"Status"`
+		Running   bool   `json:"Running"`
+		ExitCode  int    `json:"ExitCode"`
+		StartedAt string `json:"StartedAt"`
+		Health    *struct {
+			Status string `json:"Status"`
+			Log    []struct {
+				ExitCode int    `json:"ExitCode"`
+				Output   string `json:"Output"`
+			} `json:"Log"`
+		} `json:"Health"`
+	} `json:"State"`
+	NetworkSettings struct {
+		IPAddress string `json:"IPAddress"`
+		Networks  map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// ContainerWaitTilReady polls a container until it is ready or the timeout elapses.
+//
+// Containers with a HEALTHCHECK are ready once healthy, and containers whose app
+// defines a readiness probe for their process type are ready once the probe
+// passes. Containers with neither are ready once they have stayed running for
+// a short stability window.
+func ContainerWaitTilReady(containerID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := readinessInitialBackoff
+	var probe *ReadinessProbe
+	probeLoaded := false
+	reason := "timed out waiting for container"
+
+	for {
+		result, err := inspectForReadiness(containerID)
+		if err != nil {
+			return &ContainerNotReadyError{ContainerID: containerID, Reason: err.Error()}
+		}
+
+		if !probeLoaded {
+			probe = containerReadinessProbe(result)
+			probeLoaded = true
+		}
+
+		ready, done, checkReason := checkReadiness(containerID, result, probe)
+		if ready {
+			return nil
+		}
+		if checkReason != "" {
+			reason = checkReason
+		}
+		if done {
+			return newContainerNotReadyError(containerID, reason)
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			if result.State.Health == nil && probe == nil && result.State.Running {
+				return nil
+			}
+			return newContainerNotReadyError(containerID, reason)
+		}
+
+		if backoff > remaining {
+			backoff = remaining
+		}
+		if result.State.Health == nil && probe == nil && result.State.Running {
+			if wait := readinessStableWindow - runningFor(result); wait > 0 && wait < backoff {
+				backoff = wait
+			}
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > readinessMaxBackoff {
+			backoff = readinessMaxBackoff
+		}
+	}
+}
+
+// ParseReadinessProbe parses a probe of the form `http://:5000/health`, `tcp://:5000` or `cmd:<command>`
+func ParseReadinessProbe(value string) (ReadinessProbe, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "cmd:") {
+		command := strings.TrimSpace(strings.TrimPrefix(value, "cmd:"))
+		if command == "" {
+			return ReadinessProbe{}, fmt.Errorf("Invalid readiness probe %s: missing command", value)
+		}
+		return ReadinessProbe{Type: "cmd", Command: command}, nil
+	}
+
+	probeType, rest, ok := strings.Cut(value, "://")
+	if !ok || (probeType != "http" && probeType != "tcp") {
+		return ReadinessProbe{}, fmt.Errorf("Invalid readiness probe %s: must begin with http://, tcp:// or cmd:", value)
+	}
+
+	hostPort, path, _ := strings.Cut(rest, "/")
+	port := strings.TrimPrefix(hostPort, ":")
+	if ToInt(port, 0) <= 0 {
+		return ReadinessProbe{}, fmt.Errorf("Invalid readiness probe %s: missing port", value)
+	}
+
+	probe := ReadinessProbe{Type: probeType, Port: port}
+	if probeType == "http" {
+		probe.Path = "/" + path
+	}
+	return probe, nil
+}
+
+// Run executes the probe against a container reachable at the given address
+func (p ReadinessProbe) Run(containerID string, address string) error {
+	switch p.Type {
+	case "http":
+		client := http.Client{Timeout: 5 * time.Second}
+		response, err := client.Get(fmt.Sprintf("http://%s%s", net.JoinHostPort(address, p.Port), p.Path))
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+		if response.StatusCode >= 400 {
+			return fmt.Errorf("http probe %s returned %s", p.Path, response.Status)
+		}
+		return nil
+	case "tcp":
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort(address, p.Port), 5*time.Second)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case "cmd":
+		b, err := GetContainerRuntime().ContainerExec(containerID, []string{"/bin/sh", "-c", p.Command})
+		if err != nil {
+			output := strings.TrimSpace(string(b))
+			if output == "" {
+				output = err.Error()
+			}
+			return fmt.Errorf("command probe failed: %s", output)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("Unknown readiness probe type %s", p.Type)
+}
+
+func checkReadiness(containerID string, result readinessInspectResult, probe *ReadinessProbe) (bool, bool, string) {
+	if !result.State.Running {
+		if result.State.Status == "created" || result.State.Status == "restarting" {
+			return false, false, fmt.Sprintf("container is %s", result.State.Status)
+		}
+		return false, true, fmt.Sprintf("container is %s with exit code %d", result.State.Status, result.State.ExitCode)
+	}
+
+	if health := result.State.Health; health != nil {
+		switch health.Status {
+		case "unhealthy":
+			reason := "container is unhealthy"
+			if len(health.Log) > 0 {
+				reason = fmt.Sprintf("%s: %s", reason, strings.TrimSpace(health.Log[len(health.Log)-1].Output))
+			}
+			return false, true, reason
+		case "healthy":
+		default:
+			return false, false, fmt.Sprintf("container health is %s", health.Status)
+		}
+	}
+
+	if probe != nil {
+		if err := probe.Run(containerID, containerAddress(result)); err != nil {
+			return false, false, fmt.Sprintf("%s readiness probe failed: %s", probe.Type, err.Error())
+		}
+		return true, true, ""
+	}
+
+	if result.State.Health != nil {
+		return true, true, ""
+	}
+	if runningFor(result) >= readinessStableWindow {
+		return true, true, ""
+	}
+	return false, false, "container has not been running for long enough"
+}
+
+// runningFor returns how long a running container has been up, treating
+// containers without a start time as stable
+func runningFor(result readinessInspectResult) time.Duration {
+	startedAt, err := time.Parse(time.RFC3339Nano, result.State.StartedAt)
+	if err != nil || startedAt.IsZero() {
+		return readinessStableWindow
+	}
+	return time.Since(startedAt)
+}
+
+func containerAddress(result readinessInspectResult) string {
+	if result.NetworkSettings.IPAddress != "" {
+		return result.NetworkSettings.IPAddress
+	}
+	for _, network := range result.NetworkSettings.Networks {
+		if network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+	return "127.0.0.1"
+}
+
+func containerReadinessProbe(result readinessInspectResult) *ReadinessProbe {
+	appName := result.Config.Labels[AppNameLabel]
+	processType := result.Config.Labels[ProcessTypeLabel]
+	if processType == "" {
+		processType, _ = splitContainerName(strings.TrimPrefix(result.Name, "/"))
+	}
+	if appName == "" || processType == "" {
+		return nil
+	}
+
+	key := fmt.Sprintf("CLAIR_READINESS_PROBE_%s", strings.ToUpper(strings.Replace(processType, "-", "_", -1)))
+	b, err := PluginTriggerOutput("config-get", []string{appName, key}...)
+	if err != nil {
+		return nil
+	}
+
+	value := strings.TrimSpace(string(b[:]))
+	if value == "" {
+		return nil
+	}
+
+	probe, err := ParseReadinessProbe(value)
+	if err != nil {
+		LogWarn(err.Error())
+		return nil
+	}
+	return &probe
+}
+
+func inspectForReadiness(containerID string) (readinessInspectResult, error) {
+	var result readinessInspectResult
+	b, err := GetContainerRuntime().ContainerInspect(containerID)
+	if err != nil {
+		return result, err
+	}
+
+	if err := json.Unmarshal(b, &result); err != nil {
+		return result, fmt.Errorf("Unable to parse container inspect output: %v", err)
+	}
+	return result, nil
+}
+
+func newContainerNotReadyError(containerID string, reason string) error {
+	b, err := GetContainerRuntime().ContainerLogs(containerID, readinessLogLines)
+
+	logs := []string{}
+	if err == nil {
+		logs = removeEmptyEntries(strings.Split(strings.TrimRight(string(b), "\n"), "\n"))
+	}
+
+	return &ContainerNotReadyError{
+		ContainerID: containerID,
+		Reason:      reason,
+		Logs:        logs,
+	}
+}
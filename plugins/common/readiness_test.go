@@ -0,0 +1,99 @@
+package common
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonParseReadinessProbe(t *testing.T) {
+	RegisterTestingT(t)
+	probe, err := ParseReadinessProbe("http://:5000/health")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(probe).To(Equal(ReadinessProbe{Type: "http", Port: "5000", Path: "/health"}))
+
+	probe, err = ParseReadinessProbe("tcp://:6379")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(probe).To(Equal(ReadinessProbe{Type: "tcp", Port: "6379"}))
+
+	probe, err = ParseReadinessProbe("cmd: pg_isready")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(probe).To(Equal(ReadinessProbe{Type: "cmd", Command: "pg_isready"}))
+
+	_, err = ParseReadinessProbe("udp://:53")
+	Expect(err).To(HaveOccurred())
+	_, err = ParseReadinessProbe("http:///health")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCommonReadinessProbeRun(t *testing.T) {
+	RegisterTestingT(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	Expect(err).NotTo(HaveOccurred())
+	host, port, err := net.SplitHostPort(u.Host)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(ReadinessProbe{Type: "http", Port: port, Path: "/health"}.Run("c1", host)).To(Succeed())
+	Expect(ReadinessProbe{Type: "http", Port: port, Path: "/"}.Run("c1", host)).To(HaveOccurred())
+	Expect(ReadinessProbe{Type: "tcp", Port: port}.Run("c1", host)).To(Succeed())
+}
+
+func TestCommonContainerWaitTilReady(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.AddContainer(FakeContainer{ID: "healthy", Status: "running", Health: "healthy"})
+	runtime.AddContainer(FakeContainer{ID: "unhealthy", Status: "running", Health: "unhealthy"})
+
+	start := time.Now()
+	Expect(ContainerWaitTilReady("healthy", 10*time.Second)).To(Succeed())
+	Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+
+	err := ContainerWaitTilReady("unhealthy", 10*time.Second)
+	Expect(err).To(MatchError(ContainSubstring("container is unhealthy")))
+	Expect(time.Since(start)).To(BeNumerically("<", 2*time.Second))
+
+	err = ContainerWaitTilReady("c2", 10*time.Second)
+	Expect(err).To(MatchError(ContainSubstring("container is exited")))
+
+	Expect(ContainerWaitTilReady("c1", 300*time.Millisecond)).To(Succeed())
+	Expect(ContainerWaitTilReady("missing", time.Second)).To(HaveOccurred())
+
+	runtime.AddContainer(FakeContainer{ID: "starting", Status: "running", StartedAt: time.Now()})
+	start = time.Now()
+	Expect(ContainerWaitTilReady("starting", time.Minute)).To(Succeed())
+	Expect(time.Since(start)).To(BeNumerically(">=", readinessStableWindow-100*time.Millisecond))
+	Expect(time.Since(start)).To(BeNumerically("<", readinessStableWindow+time.Second))
+
+	runtime.AddContainer(FakeContainer{ID: "crashed", Status: "exited", Logs: []string{"booting", "panic: no database"}})
+	err = ContainerWaitTilReady("crashed", time.Second)
+	Expect(err).To(MatchError(ContainSubstring("Last 2 lines of container output:\nbooting\npanic: no database")))
+}
+
+func TestCommonReadinessProbeCmd(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.AddContainer(FakeContainer{ID: "db", Status: "running", Exec: func(cmd []string) ([]byte, error) {
+		if cmd[2] == "pg_isready" {
+			return []byte("accepting connections\n"), nil
+		}
+		return []byte("no response\n"), errors.New("exit status 2")
+	}})
+
+	Expect(ReadinessProbe{Type: "cmd", Command: "pg_isready"}.Run("db", "")).To(Succeed())
+	Expect(ReadinessProbe{Type: "cmd", Command: "false"}.Run("db", "")).To(MatchError("command probe failed: no response"))
+}
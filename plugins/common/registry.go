@@ -0,0 +1,364 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+var registryManifestTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// RegistryClient talks to a container registry using the registry v2 HTTP API
+type RegistryClient struct {
+	// Server is the registry host, optionally including a scheme
+	Server string
+
+	// Auth contains the credentials used for basic and token authentication
+	Auth RegistryAuth
+
+	client  *http.Client
+	baseURL string
+	token   string
+}
+
+// RegistryTag contains the details of a single tag in a registry repository
+type RegistryTag struct {
+	Tag     string    `json:"tag"`
+	Digest  string    `json:"digest"`
+	Created time.Time `json:"created"`
+}
+
+// NewRegistryClient returns a client for the registry at the given server. Servers
+// without a scheme use https, except for localhost which uses plain http.
+func NewRegistryClient(server string, auth RegistryAuth) *RegistryClient {
+	baseURL := strings.TrimSuffix(server, "/")
+	if !strings.Contains(baseURL, "://") {
+		host := strings.Split(baseURL, ":")[0]
+		if host == "localhost" || strings.HasPrefix(host, "127.") {
+			baseURL = "http://" + baseURL
+		} else {
+			baseURL = "https://" + baseURL
+		}
+	}
+
+	return &RegistryClient{
+		Server:  server,
+		Auth:    auth,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		baseURL: baseURL,
+	}
+}
+
+// RegistryHost returns a registry server without its scheme, as used in image references
+func RegistryHost(server string) string {
+	if i := strings.Index(server, "://"); i != -1 {
+		server = server[i+3:]
+	}
+	return strings.TrimSuffix(server, "/")
+}
+
+// Ping verifies the registry is reachable and accepts the configured credentials
+func (c *RegistryClient) Ping() error {
+	response, err := c.request("GET", "/v2/", nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// ListTags returns all tags in a repository
+func (c *RegistryClient) ListTags(repository string) ([]string, error) {
+	response, err := c.request("GET", fmt.Sprintf("/v2/%s/tags/list", repository), nil)
+	if err != nil {
+		return []string{}, err
+	}
+	defer response.Body.Close()
+
+	var result struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return []string{}, fmt.Errorf("Unable to parse registry tag list: %v", err)
+	}
+
+	sort.Strings(result.Tags)
+	return result.Tags, nil
+}
+
+// GetTag returns the digest and image creation time of a tag. Tags pointing at a
+// manifest list have no single creation time and report a zero time.
+func (c *RegistryClient) GetTag(repository string, tag string) (RegistryTag, error) {
+	registryTag := RegistryTag{Tag: tag}
+	response, err := c.request("GET", fmt.Sprintf("/v2/%s/manifests/%s", repository, tag), map[string]string{
+		"Accept": strings.Join(registryManifestTypes, ", "),
+	})
+	if err != nil {
+		return registryTag, err
+	}
+	defer response.Body.Close()
+
+	registryTag.Digest = response.Header.Get("Docker-Content-Digest")
+	var manifest struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&manifest); err != nil {
+		return registryTag, fmt.Errorf("Unable to parse manifest for %s:%s: %v", repository, tag, err)
+	}
+	if manifest.Config.Digest == "" {
+		return registryTag, nil
+	}
+
+	blob, err := c.request("GET", fmt.Sprintf("/v2/%s/blobs/%s", repository, manifest.Config.Digest), nil)
+	if err != nil {
+		return registryTag, err
+	}
+	defer blob.Body.Close()
+
+	var config struct {
+		Created time.Time `json:"created"`
+	}
+	if err := json.NewDecoder(blob.Body).Decode(&config); err != nil {
+		return registryTag, fmt.Errorf("Unable to parse image config for %s:%s: %v", repository, tag, err)
+	}
+	registryTag.Created = config.Created
+	return registryTag, nil
+}
+
+// DeleteTag removes the manifest a tag points at from the registry
+func (c *RegistryClient) DeleteTag(repository string, tag string) error {
+	registryTag, err := c.GetTag(repository, tag)
+	if err != nil {
+		return err
+	}
+	if registryTag.Digest == "" {
+		return fmt.Errorf("Registry did not return a digest for %s:%s", repository, tag)
+	}
+
+	response, err := c.request("DELETE", fmt.Sprintf("/v2/%s/manifests/%s", repository, registryTag.Digest), nil)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+	return nil
+}
+
+// PruneTags removes all tags from a repository except the most recently created
+// tags and any tags listed in keep, returning the removed tags
+func (c *RegistryClient) PruneTags(repository string, count int, keep []string, dryRun bool) ([]string, error) {
+	removed := []string{}
+	tags, err := c.ListTags(repository)
+	if err != nil {
+		return removed, err
+	}
+
+	kept := map[string]bool{}
+	for _, tag := range keep {
+		kept[tag] = true
+	}
+
+	registryTags := []RegistryTag{}
+	for _, tag := range tags {
+		registryTag, err := c.GetTag(repository, tag)
+		if err != nil {
+			return removed, err
+		}
+		if registryTag.Created.IsZero() {
+			kept[tag] = true
+		}
+		registryTags = append(registryTags, registryTag)
+	}
+
+	sort.SliceStable(registryTags, func(i, j int) bool {
+		return registryTags[i].Created.After(registryTags[j].Created)
+	})
+
+	keptDigests := map[string]bool{}
+	for i, registryTag := range registryTags {
+		if i < count || kept[registryTag.Tag] {
+			keptDigests[registryTag.Digest] = true
+		}
+	}
+
+	deletedDigests := map[string]bool{}
+	for _, registryTag := range registryTags {
+		if keptDigests[registryTag.Digest] {
+			continue
+		}
+
+		removed = append(removed, registryTag.Tag)
+		if dryRun || deletedDigests[registryTag.Digest] {
+			continue
+		}
+		if err := c.DeleteTag(repository, registryTag.Tag); err != nil {
+			return removed, err
+		}
+		deletedDigests[registryTag.Digest] = true
+	}
+
+	return removed, nil
+}
+
+func (c *RegistryClient) request(method string, path string, headers map[string]string) (*http.Response, error) {
+	response, err := c.doRequest(method, path, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusUnauthorized {
+		challenge := response.Header.Get("WWW-Authenticate")
+		response.Body.Close()
+		if strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+			if err := c.fetchToken(challenge); err != nil {
+				return nil, err
+			}
+			response, err = c.doRequest(method, path, headers)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			return nil, fmt.Errorf("Unable to authenticate with registry %s", c.Server)
+		}
+	}
+
+	if response.StatusCode >= 400 {
+		defer response.Body.Close()
+		return nil, registryError(response, method, path)
+	}
+
+	return response, nil
+}
+
+func (c *RegistryClient) doRequest(method string, path string, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	} else if c.Auth.Username != "" {
+		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+	}
+
+	LogDebug(fmt.Sprintf("registry api %s %s", method, c.baseURL+path))
+	response, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to reach registry %s: %v", c.Server, err)
+	}
+	return response, nil
+}
+
+func (c *RegistryClient) fetchToken(challenge string) error {
+	params := parseAuthChallenge(challenge)
+	realm := params["realm"]
+	if realm == "" {
+		return fmt.Errorf("Registry %s returned an invalid authentication challenge", c.Server)
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s?%s", realm, query.Encode()), nil)
+	if err != nil {
+		return err
+	}
+	if c.Auth.Username != "" {
+		req.SetBasicAuth(c.Auth.Username, c.Auth.Password)
+	}
+
+	response, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Unable to fetch registry token from %s: %v", realm, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("Unable to authenticate with registry %s: %s", c.Server, response.Status)
+	}
+
+	var result struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(response.Body).Decode(&result); err != nil {
+		return fmt.Errorf("Unable to parse registry token: %v", err)
+	}
+
+	c.token = result.Token
+	if c.token == "" {
+		c.token = result.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("Registry %s did not return a token", c.Server)
+	}
+	return nil
+}
+
+func parseAuthChallenge(challenge string) map[string]string {
+	params := map[string]string{}
+	if i := strings.Index(challenge, " "); i != -1 {
+		challenge = challenge[i+1:]
+	}
+
+	var key, value strings.Builder
+	inKey, inQuote := true, false
+	flush := func() {
+		if k := strings.ToLower(strings.TrimSpace(key.String())); k != "" {
+			params[k] = value.String()
+		}
+		key.Reset()
+		value.Reset()
+		inKey = true
+	}
+	for _, r := range challenge {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+		case inKey && r == '=':
+			inKey = false
+		case !inQuote && r == ',':
+			flush()
+		case inKey:
+			key.WriteRune(r)
+		default:
+			value.WriteRune(r)
+		}
+	}
+	flush()
+	return params
+}
+
+func registryError(response *http.Response, method string, path string) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+	var result struct {
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(b, &result); err == nil && len(result.Errors) > 0 {
+		return fmt.Errorf("Registry returned %s: %s", result.Errors[0].Code, result.Errors[0].Message)
+	}
+
+	return fmt.Errorf("Registry returned %s for %s %s", response.Status, method, path)
+}
@@ -0,0 +1,147 @@
+package common
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+type fakeRegistry struct {
+	tags    map[string]string
+	created map[string]time.Time
+	deleted []string
+}
+
+func newFakeRegistryServer(registry *fakeRegistry) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "clair" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "registry-token"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="registry",scope="repository:clair/test-app-1:pull,push,delete"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/clair/test-app-1/")
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case path == "tags/list":
+			tags := []string{}
+			for tag := range registry.tags {
+				tags = append(tags, tag)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": "clair/test-app-1", "tags": tags})
+		case strings.HasPrefix(path, "manifests/") && r.Method == "GET":
+			digest, ok := registry.tags[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				json.NewEncoder(w).Encode(map[string]interface{}{"errors": []map[string]string{{"code": "MANIFEST_UNKNOWN", "message": "manifest unknown"}}})
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"config": map[string]string{"digest": "config-" + digest}})
+		case strings.HasPrefix(path, "manifests/") && r.Method == "DELETE":
+			digest := strings.TrimPrefix(path, "manifests/")
+			registry.deleted = append(registry.deleted, digest)
+			for tag, tagDigest := range registry.tags {
+				if tagDigest == digest {
+					delete(registry.tags, tag)
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case strings.HasPrefix(path, "blobs/config-"):
+			digest := strings.TrimPrefix(path, "blobs/config-")
+			json.NewEncoder(w).Encode(map[string]time.Time{"created": registry.created[digest]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestCommonRegistryClient(t *testing.T) {
+	RegisterTestingT(t)
+	now := time.Now().UTC()
+	registry := &fakeRegistry{
+		tags: map[string]string{
+			"latest":    "sha256:3333",
+			"release-1": "sha256:1111",
+			"release-2": "sha256:2222",
+			"release-3": "sha256:3333",
+		},
+		created: map[string]time.Time{
+			"sha256:1111": now.Add(-72 * time.Hour),
+			"sha256:2222": now.Add(-48 * time.Hour),
+			"sha256:3333": now.Add(-24 * time.Hour),
+		},
+	}
+	server := newFakeRegistryServer(registry)
+	defer server.Close()
+
+	client := NewRegistryClient(server.URL, RegistryAuth{Username: "clair", Password: "secret"})
+	Expect(client.Ping()).To(Succeed())
+	tags, err := client.ListTags("clair/test-app-1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tags).To(Equal([]string{"latest", "release-1", "release-2", "release-3"}))
+
+	registryTag, err := client.GetTag("clair/test-app-1", "release-2")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(registryTag.Digest).To(Equal("sha256:2222"))
+	Expect(registryTag.Created.Equal(now.Add(-48 * time.Hour))).To(BeTrue())
+
+	_, err = client.GetTag("clair/test-app-1", "missing")
+	Expect(err).To(MatchError("Registry returned MANIFEST_UNKNOWN: manifest unknown"))
+
+	removed, err := client.PruneTags("clair/test-app-1", 1, []string{"release-2"}, true)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(Equal([]string{"release-1"}))
+	Expect(registry.deleted).To(BeEmpty())
+
+	removed, err = client.PruneTags("clair/test-app-1", 1, []string{}, false)
+	Expect(err).NotTo(HaveOccurred())
+	sort.Strings(removed)
+	Expect(removed).To(Equal([]string{"release-1", "release-2"}))
+	Expect(registry.deleted).To(Equal([]string{"sha256:2222", "sha256:1111"}))
+	Expect(registry.tags).To(HaveLen(2))
+
+	unauthorized := NewRegistryClient(server.URL, RegistryAuth{Username: "clair", Password: "wrong"})
+	Expect(unauthorized.Ping()).NotTo(Succeed())
+}
+
+func TestCommonRegistryHost(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(RegistryHost("https://registry.example.com/")).To(Equal("registry.example.com"))
+	Expect(RegistryHost("localhost:5000")).To(Equal("localhost:5000"))
+	Expect(NewRegistryClient("localhost:5000", RegistryAuth{}).baseURL).To(Equal("http://localhost:5000"))
+	Expect(NewRegistryClient("registry.example.com", RegistryAuth{}).baseURL).To(Equal("https://registry.example.com"))
+}
+
+func TestCommonImagePushPull(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	Expect(runtime.ImageTag("sha256:1111", "localhost:5000/clair/test-app-1:latest")).To(Succeed())
+	Expect(runtime.ImagePush("localhost:5000/clair/test-app-1", RegistryAuth{})).To(Succeed())
+	Expect(runtime.Registry).To(HaveKey("localhost:5000/clair/test-app-1:latest"))
+
+	Expect(runtime.ImageRemove("sha256:1111")).To(Succeed())
+	Expect(VerifyImage("localhost:5000/clair/test-app-1:latest")).To(BeFalse())
+	Expect(runtime.ImagePull("localhost:5000/clair/test-app-1:latest", RegistryAuth{})).To(Succeed())
+	Expect(VerifyImage("localhost:5000/clair/test-app-1:latest")).To(BeTrue())
+	Expect(runtime.ImagePull("localhost:5000/clair/test-app-1:missing", RegistryAuth{})).NotTo(Succeed())
+}
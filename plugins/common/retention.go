@@ -0,0 +1,137 @@
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageRetentionPolicy controls which unused app images are kept during cleanup
+type ImageRetentionPolicy struct {
+	// Count is the number of most recent images to keep
+	Count int
+
+	// MaxAge keeps any image created within the duration
+	MaxAge time.Duration
+}
+
+// Retains returns true if the image at the given position in a newest-first list is kept
+func (p ImageRetentionPolicy) Retains(position int, image ImageInfo, now time.Time) bool {
+	if p.Count > 0 && position < p.Count {
+		return true
+	}
+
+	return p.MaxAge > 0 && now.Sub(image.Created) < p.MaxAge
+}
+
+// GetImageRetentionPolicy returns the image retention policy for an app, falling
+// back to the global policy for any setting the app does not define
+func GetImageRetentionPolicy(appName string) (ImageRetentionPolicy, error) {
+	policy := ImageRetentionPolicy{}
+	count := appsPropertyOrGlobal(appName, "image-retention-count")
+	if count != "" {
+		i, err := strconv.Atoi(count)
+		if err != nil || i < 1 {
+			return policy, fmt.Errorf("Invalid image-retention-count %s: must be a positive integer", count)
+		}
+		policy.Count = i
+	}
+
+	maxAge := appsPropertyOrGlobal(appName, "image-retention-max-age")
+	if maxAge != "" {
+		duration, err := ParseRetentionAge(maxAge)
+		if err != nil {
+			return policy, err
+		}
+		policy.MaxAge = duration
+	}
+
+	return policy, nil
+}
+
+// ParseRetentionAge parses a duration such as `12h`, `7d` or `2w`
+func ParseRetentionAge(value string) (time.Duration, error) {
+	duration, err := ParseAge(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid image-retention-max-age %s: must be a duration such as 12h, 7d or 2w", value)
+	}
+	return duration, nil
+}
+
+// ParseAge parses a positive duration, accepting day (`7d`) and week (`2w`)
+// units in addition to those understood by time.ParseDuration
+func ParseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	multiplier := time.Duration(0)
+	switch {
+	case strings.HasSuffix(value, "d"):
+		multiplier = 24 * time.Hour
+	case strings.HasSuffix(value, "w"):
+		multiplier = 7 * 24 * time.Hour
+	}
+
+	if multiplier > 0 {
+		i, err := strconv.Atoi(strings.TrimRight(value, "dw"))
+		if err == nil && i > 0 {
+			return time.Duration(i) * multiplier, nil
+		}
+	} else if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return duration, nil
+	}
+
+	return 0, fmt.Errorf("Invalid duration %s: must be a duration such as 12h, 7d or 2w", value)
+}
+
+// ImageRetentionCandidates returns the unused app images that are not kept by
+// the policy. The policy only applies to released images, including those
+// tagged for a release, unused images of other build stages are always
+// candidates.
+func ImageRetentionCandidates(appName string, policy ImageRetentionPolicy) ([]ImageInfo, error) {
+	candidates := []ImageInfo{}
+	images, err := AppImages(appName)
+	if err != nil {
+		return candidates, err
+	}
+
+	now := time.Now()
+	position := 0
+	for _, image := range images {
+		if ImageInUse(image.ID) {
+			continue
+		}
+		if image.Stage != ImageStageRelease && !hasReleaseTag(appName, image) {
+			candidates = append(candidates, image)
+			continue
+		}
+
+		if !policy.Retains(position, image, now) {
+			candidates = append(candidates, image)
+		}
+		position++
+	}
+
+	return candidates, nil
+}
+
+// hasReleaseTag returns true if the image is tagged for a release of the app
+func hasReleaseTag(appName string, image ImageInfo) bool {
+	prefix := GetAppImageRepo(appName) + ":release-"
+	for _, tag := range image.Tags {
+		if strings.HasPrefix(tag, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func appsPropertyOrGlobal(appName string, property string) string {
+	value := ""
+	if appName != "" && appName != "--global" {
+		value = strings.TrimSpace(PropertyGet("apps", appName, property))
+	}
+	if value == "" {
+		value = strings.TrimSpace(PropertyGet("apps", "--global", property))
+	}
+	return value
+}
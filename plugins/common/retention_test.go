@@ -0,0 +1,123 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupRetentionImages(runtime *FakeRuntime) {
+	now := time.Now()
+	for i, id := range []string{"sha256:a1", "sha256:a2", "sha256:a3", "sha256:a4"} {
+		runtime.AddImage(FakeImage{
+			ID:       id,
+			RepoTags: []string{"clair/test-app-1:" + id[7:]},
+			Labels:   map[string]string{AppNameLabel: testAppName, ImageStageLabel: ImageStageRelease},
+			Created:  now.Add(-time.Duration(i+1) * 24 * time.Hour),
+			Size:     1000,
+		})
+	}
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:b1",
+		RepoTags: []string{"clair/test-app-1:build"},
+		Labels:   map[string]string{AppNameLabel: testAppName, ImageStageLabel: "build"},
+		Created:  now,
+		Size:     1000,
+	})
+	runtime.AddImage(FakeImage{
+		ID:       "sha256:r1",
+		RepoTags: []string{"clair/test-app-1:release-1"},
+		Labels:   map[string]string{AppNameLabel: "renamed-app", ImageStageLabel: ImageStageRelease},
+		Created:  now.Add(-10 * 24 * time.Hour),
+		Size:     1000,
+	})
+}
+
+func TestCommonParseRetentionAge(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(ParseRetentionAge("12h")).To(Equal(12 * time.Hour))
+	Expect(ParseRetentionAge("7d")).To(Equal(7 * 24 * time.Hour))
+	Expect(ParseRetentionAge("2w")).To(Equal(14 * 24 * time.Hour))
+
+	_, err := ParseRetentionAge("soon")
+	Expect(err).To(HaveOccurred())
+	_, err = ParseRetentionAge("-1d")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCommonImageRetentionCandidates(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	setupRetentionImages(runtime)
+
+	images, err := ImageRetentionCandidates(testAppName, ImageRetentionPolicy{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(images).To(HaveLen(6))
+
+	images, err = ImageRetentionCandidates(testAppName, ImageRetentionPolicy{Count: 2})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(images).To(HaveLen(4))
+	Expect(images[0].ID).To(Equal("sha256:b1"))
+	Expect(images[1].ID).To(Equal("sha256:a3"))
+	Expect(images[2].ID).To(Equal("sha256:a4"))
+	Expect(images[3].ID).To(Equal("sha256:r1"))
+
+	images, err = ImageRetentionCandidates(testAppName, ImageRetentionPolicy{Count: 5})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(images).To(HaveLen(1))
+	Expect(images[0].ID).To(Equal("sha256:b1"))
+
+	images, err = ImageRetentionCandidates(testAppName, ImageRetentionPolicy{Count: 1, MaxAge: 60 * time.Hour})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(images).To(HaveLen(4))
+	Expect(images[3].ID).To(Equal("sha256:r1"))
+}
+
+func TestCommonDockerCleanupRetention(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	setupRetentionImages(runtime)
+
+	libRoot, err := ioutil.TempDir("", "clair-lib-root")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(libRoot)
+	Expect(os.Setenv("CLAIR_LIB_ROOT", libRoot)).To(Succeed())
+	defer os.Unsetenv("CLAIR_LIB_ROOT")
+
+	for appName, count := range map[string]string{"--global": "3", testAppName: "1"} {
+		Expect(os.MkdirAll(getPluginAppPropertyPath("apps", appName), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(getPropertyPath("apps", appName, "image-retention-count"), []byte(count), 0644)).To(Succeed())
+	}
+	policy, err := GetImageRetentionPolicy(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy).To(Equal(ImageRetentionPolicy{Count: 1}))
+
+	Expect(ioutil.WriteFile(getPropertyPath("apps", testAppName, "image-retention-count"), []byte("0"), 0644)).To(Succeed())
+	_, err = GetImageRetentionPolicy(testAppName)
+	Expect(err).To(MatchError("Invalid image-retention-count 0: must be a positive integer"))
+	Expect(ioutil.WriteFile(getPropertyPath("apps", testAppName, "image-retention-count"), []byte("1"), 0644)).To(Succeed())
+
+	Expect(DockerCleanup(testAppName, false, true)).To(Succeed())
+	Expect(runtime.Images).To(HaveKey("sha256:a4"))
+	Expect(runtime.Containers).To(HaveKey("c2"))
+
+	Expect(DockerCleanup(testAppName, false, false)).To(Succeed())
+	Expect(runtime.Images).To(HaveKey("sha256:1111"))
+	Expect(runtime.Images).To(HaveKey("sha256:a1"))
+	Expect(runtime.Images).NotTo(HaveKey("sha256:a2"))
+	Expect(runtime.Images).NotTo(HaveKey("sha256:a4"))
+	Expect(runtime.Images).NotTo(HaveKey("sha256:b1"))
+	Expect(runtime.Images).NotTo(HaveKey("sha256:r1"))
+}
+
+func TestCommonFormatBytes(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(FormatBytes(999)).To(Equal("999B"))
+	Expect(FormatBytes(1500)).To(Equal("1.5kB"))
+	Expect(FormatBytes(2500000000)).To(Equal("2.5GB"))
+}
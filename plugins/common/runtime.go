@@ -0,0 +1,371 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ContainerRuntime is the interface clair uses to talk to the container engine
+type ContainerRuntime interface {
+	// ContainerCopyFrom streams a tar archive of a path within a container
+	ContainerCopyFrom(containerID string, path string) (io.ReadCloser, error)
+
+	// ContainerCreate creates a container from an image and returns its id
+	ContainerCreate(image string, options ContainerCreateOptions) (string, error)
+
+	// ContainerExec runs a command in a running container and returns its
+	// combined output, failing when the command exits non-zero
+	ContainerExec(containerID string, cmd []string) ([]byte, error)
+
+	// ContainerInspect returns the raw inspect json for a container
+	ContainerInspect(containerID string) ([]byte, error)
+
+	// ContainerList returns the ids of all containers matching the options
+	ContainerList(options ListOptions) ([]string, error)
+
+	// ContainerLogs returns the last lines of a container's combined output
+	ContainerLogs(containerID string, tail int) ([]byte, error)
+
+	// ContainerRemove removes a container
+	ContainerRemove(containerID string, force bool) error
+
+	// ContainerStart starts a created or stopped container
+	ContainerStart(containerID string) error
+
+	// ImageInspect returns the raw inspect json for an image
+	ImageInspect(image string) ([]byte, error)
+
+	// ImageLoad loads images from a tar archive and returns the loaded references
+	ImageLoad(archive io.Reader) ([]string, error)
+
+	// ImageList returns the ids of all images matching the options
+	ImageList(options ListOptions) ([]string, error)
+
+	// ImagePull pulls an image from a registry
+	ImagePull(image string, auth RegistryAuth) error
+
+	// ImagePrune removes all unused images matching the filters
+	ImagePrune(filters map[string][]string) error
+
+	// ImagePush pushes an image to a registry
+	ImagePush(image string, auth RegistryAuth) error
+
+	// ImageRemove removes an image
+	ImageRemove(image string) error
+
+	// ImageSave streams a tar archive containing the images
+	ImageSave(images []string) (io.ReadCloser, error)
+
+	// ImageTag adds a repository:tag reference to an existing image
+	ImageTag(image string, reference string) error
+}
+
+// ContainerCreateOptions contains the settings used to create a container
+type ContainerCreateOptions struct {
+	Binds       []string
+	Cmd         []string
+	DNS         []string
+	Entrypoint  []string
+	Env         []string
+	ExtraArgs   []string
+	ExtraHosts  []string
+	Labels      map[string]string
+	Name        string
+	NetworkMode string
+	User        string
+	WorkingDir  string
+}
+
+// RegistryAuth contains the credentials used to authenticate against a registry
+type RegistryAuth struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// ListOptions contains the settings used to list containers or images
+type ListOptions struct {
+	All     bool
+	Filters map[string][]string
+}
+
+var (
+	containerRuntime   ContainerRuntime
+	containerRuntimeMu sync.Mutex
+)
+
+// GetContainerRuntime returns the configured container runtime
+func GetContainerRuntime() ContainerRuntime {
+	containerRuntimeMu.Lock()
+	defer containerRuntimeMu.Unlock()
+
+	if containerRuntime == nil {
+		profile, err := GetRuntimeProfile()
+		if err != nil {
+			LogFailWithError(err)
+		}
+
+		if profile.UseAPI {
+			containerRuntime = NewDockerAPIRuntime(DockerHost())
+		} else {
+			containerRuntime = NewCLIRuntime(profile)
+		}
+	}
+	return containerRuntime
+}
+
+// SetContainerRuntime overrides the container runtime, primarily for testing
+func SetContainerRuntime(runtime ContainerRuntime) {
+	containerRuntimeMu.Lock()
+	defer containerRuntimeMu.Unlock()
+
+	containerRuntime = runtime
+}
+
+// NewListOptions returns list options for a set of `key=value` filters
+func NewListOptions(all bool, filters ...string) ListOptions {
+	options := ListOptions{
+		All:     all,
+		Filters: map[string][]string{},
+	}
+
+	for _, filter := range filters {
+		parts := strings.SplitN(filter, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		options.Filters[parts[0]] = append(options.Filters[parts[0]], parts[1])
+	}
+
+	return options
+}
+
+// containerCreateValueFlags are the docker container create flags that map
+// onto create options, all of which take a value
+var containerCreateValueFlags = map[string]bool{
+	"--add-host":   true,
+	"--dns":        true,
+	"--entrypoint": true,
+	"--env":        true,
+	"--label":      true,
+	"--name":       true,
+	"--net":        true,
+	"--network":    true,
+	"--user":       true,
+	"--volume":     true,
+	"--workdir":    true,
+	"-e":           true,
+	"-l":           true,
+	"-u":           true,
+	"-v":           true,
+	"-w":           true,
+}
+
+// ParseContainerCreateArgs converts docker container create flags into create
+// options. Flags without a matching option, such as --memory or -d, are kept
+// verbatim in ExtraArgs along with any values that follow them, leaving their
+// arity to the runtime cli.
+func ParseContainerCreateArgs(args []string) (ContainerCreateOptions, error) {
+	options := ContainerCreateOptions{
+		Labels: map[string]string{},
+	}
+
+	passthrough := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(arg, "-") {
+			if !passthrough {
+				return options, fmt.Errorf("Unexpected container create argument: %s", arg)
+			}
+			options.ExtraArgs = append(options.ExtraArgs, arg)
+			continue
+		}
+
+		flag, value, hasValue := strings.Cut(arg, "=")
+		passthrough = !containerCreateValueFlags[flag]
+		if passthrough {
+			options.ExtraArgs = append(options.ExtraArgs, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return options, fmt.Errorf("Missing value for container create flag: %s", flag)
+			}
+			i++
+			value = args[i]
+		}
+
+		switch flag {
+		case "--add-host":
+			options.ExtraHosts = append(options.ExtraHosts, value)
+		case "--dns":
+			options.DNS = append(options.DNS, value)
+		case "--entrypoint":
+			options.Entrypoint = []string{value}
+		case "--env", "-e":
+			options.Env = append(options.Env, value)
+		case "--label", "-l":
+			key, labelValue, _ := strings.Cut(value, "=")
+			options.Labels[key] = labelValue
+		case "--name":
+			options.Name = value
+		case "--net", "--network":
+			options.NetworkMode = value
+		case "--user", "-u":
+			options.User = value
+		case "--volume", "-v":
+			options.Binds = append(options.Binds, value)
+		case "--workdir", "-w":
+			options.WorkingDir = value
+		}
+	}
+
+	return options, nil
+}
+
+// ShellSplit splits a string into words, respecting single and double quotes
+// and backslash escapes
+func ShellSplit(s string) []string {
+	words := []string{}
+	var current strings.Builder
+	inWord := false
+	escaped := false
+	var quote rune
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			escaped = false
+			if quote == '"' && !strings.ContainsRune("$`\"\\\n", r) {
+				current.WriteRune('\\')
+			}
+			if r != '\n' {
+				current.WriteRune(r)
+				inWord = true
+			}
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if escaped {
+		current.WriteRune('\\')
+		inWord = true
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+
+	return words
+}
+
+// parseLoadedImages extracts the image references from image load output
+func parseLoadedImages(output string) []string {
+	references := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		for _, prefix := range []string{"Loaded image ID: ", "Loaded image: "} {
+			if strings.HasPrefix(line, prefix) {
+				references = append(references, strings.TrimSpace(strings.TrimPrefix(line, prefix)))
+				break
+			}
+		}
+	}
+	return references
+}
+
+// splitImageReference splits an image reference into its repository and tag
+func splitImageReference(reference string) (string, string) {
+	repository, tag := reference, "latest"
+	if i := strings.LastIndex(reference, ":"); i > strings.LastIndex(reference, "/") {
+		repository, tag = reference[:i], reference[i+1:]
+	}
+	return repository, tag
+}
+
+func decodeInspect(b []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(b)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return data, fmt.Errorf("Unable to parse inspect output: %v", err)
+	}
+
+	for key, value := range data {
+		data[key] = normalizeInspect(key, value)
+	}
+	return data, nil
+}
+
+// normalizeInspect converts maps holding only strings, such as Labels, to
+// map[string]string and null Labels to an empty map, so that templates like
+// `{{index .Config.Labels "key"}}` render a missing key as an empty string the
+// way the docker cli does, rather than as <no value>
+func normalizeInspect(key string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case nil:
+		if key == "Labels" {
+			return map[string]string{}
+		}
+	case map[string]interface{}:
+		stringMap := map[string]string{}
+		for k, item := range value {
+			value[k] = normalizeInspect(k, item)
+			if s, ok := value[k].(string); ok && stringMap != nil {
+				stringMap[k] = s
+			} else {
+				stringMap = nil
+			}
+		}
+		if stringMap != nil {
+			return stringMap
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeInspect(key, item)
+		}
+	}
+	return v
+}
+
+var inspectTemplateFuncs = template.FuncMap{
+	"join": func(values []interface{}, sep string) string {
+		s := make([]string, len(values))
+		for i, value := range values {
+			s[i] = fmt.Sprint(value)
+		}
+		return strings.Join(s, sep)
+	},
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+}
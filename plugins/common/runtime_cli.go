@@ -0,0 +1,324 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// CLIRuntime implements ContainerRuntime by shelling out to a runtime cli
+type CLIRuntime struct {
+	Profile RuntimeProfile
+}
+
+// NewCLIRuntime returns a runtime driving the cli described by the profile
+func NewCLIRuntime(profile RuntimeProfile) *CLIRuntime {
+	return &CLIRuntime{Profile: profile}
+}
+
+// ContainerCopyFrom streams a tar archive of a path within a container
+func (r *CLIRuntime) ContainerCopyFrom(containerID string, path string) (io.ReadCloser, error) {
+	b, err := r.output("container-cp", fmt.Sprintf("%s:%s", containerID, path), "-")
+	if err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
+}
+
+// ContainerCreate creates a container from an image and returns its id
+func (r *CLIRuntime) ContainerCreate(image string, options ContainerCreateOptions) (string, error) {
+	args := []string{}
+	labelKeys := []string{}
+	for key := range options.Labels {
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+	for _, key := range labelKeys {
+		args = append(args, fmt.Sprintf("--label=%s=%s", key, options.Labels[key]))
+	}
+	for _, env := range options.Env {
+		args = append(args, fmt.Sprintf("--env=%s", env))
+	}
+	if options.Name != "" {
+		args = append(args, fmt.Sprintf("--name=%s", options.Name))
+	}
+	if options.User != "" {
+		args = append(args, fmt.Sprintf("--user=%s", options.User))
+	}
+	if options.WorkingDir != "" {
+		args = append(args, fmt.Sprintf("--workdir=%s", options.WorkingDir))
+	}
+	if len(options.Entrypoint) > 0 {
+		args = append(args, fmt.Sprintf("--entrypoint=%s", options.Entrypoint[0]))
+	}
+	if options.NetworkMode != "" {
+		args = append(args, fmt.Sprintf("--network=%s", options.NetworkMode))
+	}
+	for _, bind := range options.Binds {
+		args = append(args, fmt.Sprintf("--volume=%s", bind))
+	}
+	for _, host := range options.ExtraHosts {
+		args = append(args, fmt.Sprintf("--add-host=%s", host))
+	}
+	for _, dns := range options.DNS {
+		args = append(args, fmt.Sprintf("--dns=%s", dns))
+	}
+	args = append(args, options.ExtraArgs...)
+	args = append(args, image)
+	args = append(args, options.Cmd...)
+
+	b, err := r.output("container-create", args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ContainerExec runs a command in a running container and returns its
+// combined output, failing when the command exits non-zero
+func (r *CLIRuntime) ContainerExec(containerID string, cmd []string) ([]byte, error) {
+	execCmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args("container-exec", append([]string{containerID}, cmd...)...)...)
+	execCmd.ShowOutput = false
+	return execCmd.CombinedOutput()
+}
+
+// ContainerInspect returns the raw inspect json for a container
+func (r *CLIRuntime) ContainerInspect(containerID string) ([]byte, error) {
+	return r.inspect("container-inspect", containerID)
+}
+
+// ContainerList returns the ids of all containers matching the options
+func (r *CLIRuntime) ContainerList(options ListOptions) ([]string, error) {
+	args := []string{r.Profile.Flag("quiet")}
+	if options.All {
+		args = append(args, r.Profile.Flag("all"))
+	}
+	args = append(args, r.filterArgs(options.Filters)...)
+	return r.list("container-list", args...)
+}
+
+// ContainerLogs returns the last lines of a container's combined output
+func (r *CLIRuntime) ContainerLogs(containerID string, tail int) ([]byte, error) {
+	logsCmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args("container-logs", r.Profile.Flag("tail"), fmt.Sprintf("%d", tail), containerID)...)
+	logsCmd.ShowOutput = false
+	return logsCmd.CombinedOutput()
+}
+
+// ContainerRemove removes a container
+func (r *CLIRuntime) ContainerRemove(containerID string, force bool) error {
+	args := []string{}
+	if force {
+		args = append(args, r.Profile.Flag("force"))
+	}
+	args = append(args, containerID)
+
+	_, err := r.output("container-remove", args...)
+	return err
+}
+
+// ContainerStart starts a created or stopped container
+func (r *CLIRuntime) ContainerStart(containerID string) error {
+	_, err := r.output("container-start", containerID)
+	return err
+}
+
+// ImageInspect returns the raw inspect json for an image
+func (r *CLIRuntime) ImageInspect(image string) ([]byte, error) {
+	return r.inspect("image-inspect", image)
+}
+
+// ImageLoad loads images from a tar archive and returns the loaded references
+func (r *CLIRuntime) ImageLoad(archive io.Reader) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args("image-load")...)
+	cmd.ShowOutput = false
+	cmd.Command.Stdin = archive
+	cmd.Command.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return []string{}, errors.New(message)
+	}
+
+	return parseLoadedImages(string(b)), nil
+}
+
+// ImageList returns the ids of all images matching the options
+func (r *CLIRuntime) ImageList(options ListOptions) ([]string, error) {
+	args := []string{r.Profile.Flag("quiet")}
+	if options.All {
+		args = append(args, r.Profile.Flag("all"))
+	}
+	args = append(args, r.filterArgs(options.Filters)...)
+	return r.list("image-list", args...)
+}
+
+// ImagePrune removes all unused images matching the filters
+func (r *CLIRuntime) ImagePrune(filters map[string][]string) error {
+	args := []string{r.Profile.Flag("force")}
+	pruneFilters := map[string][]string{}
+	for key, values := range filters {
+		if key == "dangling" && len(values) == 1 && values[0] == "false" {
+			args = append(args, r.Profile.Flag("all"))
+			continue
+		}
+		pruneFilters[key] = values
+	}
+	args = append(args, r.filterArgs(pruneFilters)...)
+
+	_, err := r.output("image-prune", args...)
+	return err
+}
+
+// ImagePull pulls an image from a registry
+func (r *CLIRuntime) ImagePull(image string, auth RegistryAuth) error {
+	if err := r.login(auth); err != nil {
+		return err
+	}
+
+	_, err := r.output("image-pull", image)
+	return err
+}
+
+// ImagePush pushes an image to a registry
+func (r *CLIRuntime) ImagePush(image string, auth RegistryAuth) error {
+	if err := r.login(auth); err != nil {
+		return err
+	}
+
+	_, err := r.output("image-push", image)
+	return err
+}
+
+// ImageRemove removes an image
+func (r *CLIRuntime) ImageRemove(image string) error {
+	_, err := r.output("image-remove", image)
+	return err
+}
+
+// ImageSave streams a tar archive containing the images
+func (r *CLIRuntime) ImageSave(images []string) (io.ReadCloser, error) {
+	cmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args("image-save", images...)...)
+	stderr := &bytes.Buffer{}
+	cmd.Command.Stderr = stderr
+	stdout, err := cmd.Command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Command.Start(); err != nil {
+		return nil, err
+	}
+
+	return &commandReadCloser{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+// ImageTag adds a repository:tag reference to an existing image
+func (r *CLIRuntime) ImageTag(image string, reference string) error {
+	_, err := r.output("image-tag", image, reference)
+	return err
+}
+
+// commandReadCloser streams the output of a running command and waits for it on close
+type commandReadCloser struct {
+	io.ReadCloser
+	cmd    *ShellCmd
+	stderr *bytes.Buffer
+}
+
+func (c *commandReadCloser) Close() error {
+	c.ReadCloser.Close()
+	if err := c.cmd.Command.Wait(); err != nil {
+		message := strings.TrimSpace(c.stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return errors.New(message)
+	}
+	return nil
+}
+
+func (r *CLIRuntime) filterArgs(filters map[string][]string) []string {
+	keys := []string{}
+	for key := range filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	args := []string{}
+	for _, key := range keys {
+		for _, value := range filters[key] {
+			args = append(args, r.Profile.Flag("filter"), fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	return args
+}
+
+func (r *CLIRuntime) inspect(operation string, id string) ([]byte, error) {
+	b, err := r.output(operation, id)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	var results []json.RawMessage
+	if err := json.Unmarshal(b, &results); err != nil {
+		return []byte{}, fmt.Errorf("Unable to parse %s inspect output: %v", r.Profile.Name, err)
+	}
+	if len(results) == 0 {
+		return []byte{}, fmt.Errorf("No such object: %s", id)
+	}
+	return results[0], nil
+}
+
+func (r *CLIRuntime) list(operation string, args ...string) ([]string, error) {
+	b, err := r.output(operation, args...)
+	if err != nil {
+		return []string{}, err
+	}
+
+	return removeEmptyEntries(strings.Split(strings.TrimSpace(string(b)), "\n")), nil
+}
+
+func (r *CLIRuntime) login(auth RegistryAuth) error {
+	if auth.Username == "" {
+		return nil
+	}
+
+	var stderr bytes.Buffer
+	cmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args("registry-login", "--username", auth.Username, "--password-stdin", auth.ServerAddress)...)
+	cmd.ShowOutput = false
+	cmd.Command.Stdin = strings.NewReader(auth.Password)
+	cmd.Command.Stderr = &stderr
+	if _, err := cmd.Output(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return fmt.Errorf("Unable to log into %s: %s", auth.ServerAddress, message)
+	}
+	return nil
+}
+
+func (r *CLIRuntime) output(operation string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := NewShellCmdWithArgs(r.Profile.Command, r.Profile.Args(operation, args...)...)
+	cmd.ShowOutput = false
+	cmd.Command.Stderr = &stderr
+	b, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return b, errors.New(message)
+	}
+	return b, nil
+}
@@ -0,0 +1,607 @@
+package common
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeContainer is a container held by the FakeRuntime
+type FakeContainer struct {
+	ID        string
+	Name      string
+	Image     string
+	Labels    map[string]string
+	Status    string
+	Health    string
+	StartedAt time.Time
+	Logs      []string
+
+	// Exec handles commands run in the container, which succeed when unset
+	Exec func(cmd []string) ([]byte, error)
+}
+
+// FakeImage is an image held by the FakeRuntime
+type FakeImage struct {
+	ID         string
+	RepoTags   []string
+	Labels     map[string]string
+	WorkingDir string
+	Env        []string
+	Files      map[string]string
+	Created    time.Time
+	Size       int64
+}
+
+// FakeRuntime is an in-memory ContainerRuntime for unit tests
+type FakeRuntime struct {
+	Containers map[string]*FakeContainer
+	Images     map[string]*FakeImage
+
+	// Registry holds the images pushed to a registry, keyed by image reference
+	Registry map[string]*FakeImage
+
+	mu      sync.Mutex
+	counter int
+}
+
+// NewFakeRuntime returns an empty FakeRuntime
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{
+		Containers: map[string]*FakeContainer{},
+		Images:     map[string]*FakeImage{},
+		Registry:   map[string]*FakeImage{},
+	}
+}
+
+// AddContainer registers a container with the runtime
+func (r *FakeRuntime) AddContainer(container FakeContainer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if container.Labels == nil {
+		container.Labels = map[string]string{}
+	}
+	r.Containers[container.ID] = &container
+}
+
+// AddImage registers an image with the runtime
+func (r *FakeRuntime) AddImage(image FakeImage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if image.Labels == nil {
+		image.Labels = map[string]string{}
+	}
+	r.Images[image.ID] = &image
+}
+
+// ContainerCopyFrom streams a tar archive of a path within a container
+func (r *FakeRuntime) ContainerCopyFrom(containerID string, path string) (io.ReadCloser, error) {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := r.findImage(container.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	path = strings.TrimSuffix(path, "/")
+	parent := path[:strings.LastIndex(path, "/")+1]
+	names := []string{}
+	for name := range image.Files {
+		if name == path || strings.HasPrefix(name, path+"/") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("Could not find the file %s in container %s", path, containerID)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range names {
+		content := image.Files[name]
+		header := &tar.Header{
+			Name:     strings.TrimPrefix(name, parent),
+			Mode:     0644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(&buf), nil
+}
+
+// ContainerCreate creates a container from an image and returns its id
+func (r *FakeRuntime) ContainerCreate(image string, options ContainerCreateOptions) (string, error) {
+	fakeImage, err := r.findImage(image)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	r.counter++
+	containerID := fmt.Sprintf("fake%060d", r.counter)
+	r.mu.Unlock()
+
+	r.AddContainer(FakeContainer{
+		ID:     containerID,
+		Name:   options.Name,
+		Image:  fakeImage.ID,
+		Labels: options.Labels,
+		Status: "created",
+	})
+	return containerID, nil
+}
+
+// ContainerInspect returns the raw inspect json for a container
+func (r *FakeRuntime) ContainerInspect(containerID string) ([]byte, error) {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	state := map[string]interface{}{
+		"Status":    container.Status,
+		"Running":   container.Status == "running",
+		"StartedAt": container.StartedAt.Format(time.RFC3339Nano),
+	}
+	if container.Health != "" {
+		state["Health"] = map[string]interface{}{"Status": container.Health}
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"Id":    container.ID,
+		"Name":  "/" + container.Name,
+		"Image": container.Image,
+		"Config": map[string]interface{}{
+			"Image":  container.Image,
+			"Labels": container.Labels,
+		},
+		"State": state,
+	})
+}
+
+// ContainerList returns the ids of all containers matching the options
+func (r *FakeRuntime) ContainerList(options ListOptions) ([]string, error) {
+	filters := map[string][]string{}
+	for key, values := range options.Filters {
+		filters[key] = values
+	}
+	for i, ancestor := range filters["ancestor"] {
+		if image, err := r.findImage(ancestor); err == nil {
+			filters["ancestor"] = append([]string{}, filters["ancestor"]...)
+			filters["ancestor"][i] = image.ID
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	containerIDs := []string{}
+	for _, container := range r.Containers {
+		if !options.All && container.Status != "running" {
+			continue
+		}
+		fields := map[string]string{"ancestor": container.Image, "status": container.Status}
+		if !fakeMatchesFilters(filters, container.Labels, fields) {
+			continue
+		}
+		containerIDs = append(containerIDs, container.ID)
+	}
+	return containerIDs, nil
+}
+
+// ContainerExec runs a command in a running container and returns its
+// combined output, failing when the command exits non-zero
+func (r *FakeRuntime) ContainerExec(containerID string, cmd []string) ([]byte, error) {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return []byte{}, err
+	}
+	if container.Status != "running" {
+		return []byte{}, fmt.Errorf("Container %s is not running", containerID)
+	}
+	if container.Exec == nil {
+		return []byte{}, nil
+	}
+	return container.Exec(cmd)
+}
+
+// ContainerLogs returns the last lines of a container's combined output
+func (r *FakeRuntime) ContainerLogs(containerID string, tail int) ([]byte, error) {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	logs := container.Logs
+	if tail >= 0 && len(logs) > tail {
+		logs = logs[len(logs)-tail:]
+	}
+	if len(logs) == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.Join(logs, "\n") + "\n"), nil
+}
+
+// ContainerRemove removes a container
+func (r *FakeRuntime) ContainerRemove(containerID string, force bool) error {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return err
+	}
+	if container.Status == "running" && !force {
+		return fmt.Errorf("You cannot remove a running container %s", containerID)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.Containers, container.ID)
+	return nil
+}
+
+// ContainerStart starts a created or stopped container
+func (r *FakeRuntime) ContainerStart(containerID string) error {
+	container, err := r.findContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	container.Status = "running"
+	container.StartedAt = time.Now().UTC()
+	return nil
+}
+
+// ImageInspect returns the raw inspect json for an image
+func (r *FakeRuntime) ImageInspect(image string) ([]byte, error) {
+	fakeImage, err := r.findImage(image)
+	if err != nil {
+		return []byte{}, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"Id":       fakeImage.ID,
+		"RepoTags": fakeImage.RepoTags,
+		"Created":  fakeImage.Created.Format(time.RFC3339Nano),
+		"Size":     fakeImage.Size,
+		"Config": map[string]interface{}{
+			"Env":        fakeImage.Env,
+			"Labels":     fakeImage.Labels,
+			"WorkingDir": fakeImage.WorkingDir,
+		},
+	})
+}
+
+// ImageLoad loads images from a tar archive and returns the loaded references
+func (r *FakeRuntime) ImageLoad(archive io.Reader) ([]string, error) {
+	files := map[string][]byte{}
+	tr := tar.NewReader(archive)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return []string{}, err
+		}
+		b, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return []string{}, err
+		}
+		files[header.Name] = b
+	}
+
+	var manifest []fakeImageManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		return []string{}, fmt.Errorf("invalid image archive: %v", err)
+	}
+
+	references := []string{}
+	for _, entry := range manifest {
+		var image FakeImage
+		if err := json.Unmarshal(files[entry.Config], &image); err != nil {
+			return references, fmt.Errorf("invalid image archive: %v", err)
+		}
+		image.RepoTags = nil
+		r.AddImage(image)
+		for _, tag := range entry.RepoTags {
+			if err := r.ImageTag(image.ID, tag); err != nil {
+				return references, err
+			}
+			references = append(references, tag)
+		}
+		if len(entry.RepoTags) == 0 {
+			references = append(references, image.ID)
+		}
+	}
+	return references, nil
+}
+
+// ImageList returns the ids of all images matching the options
+func (r *FakeRuntime) ImageList(options ListOptions) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	imageIDs := []string{}
+	for _, image := range r.Images {
+		dangling := "false"
+		if len(image.RepoTags) == 0 {
+			dangling = "true"
+		}
+		filters := map[string][]string{}
+		for key, values := range options.Filters {
+			if key != "reference" {
+				filters[key] = values
+			}
+		}
+		if !fakeMatchesFilters(filters, image.Labels, map[string]string{"dangling": dangling}) {
+			continue
+		}
+		if !fakeMatchesReferences(options.Filters["reference"], image.RepoTags) {
+			continue
+		}
+		imageIDs = append(imageIDs, image.ID)
+	}
+	return imageIDs, nil
+}
+
+// ImagePrune removes all unused images matching the filters
+func (r *FakeRuntime) ImagePrune(filters map[string][]string) error {
+	pruneFilters := map[string][]string{}
+	for key, values := range filters {
+		if key == "dangling" && len(values) == 1 && values[0] == "false" {
+			continue
+		}
+		pruneFilters[key] = values
+	}
+
+	imageIDs, err := r.ImageList(ListOptions{Filters: pruneFilters})
+	if err != nil {
+		return err
+	}
+
+	for _, imageID := range imageIDs {
+		if r.imageInUse(imageID) {
+			continue
+		}
+		r.ImageRemove(imageID)
+	}
+	return nil
+}
+
+// ImagePull pulls an image from a registry
+func (r *FakeRuntime) ImagePull(image string, auth RegistryAuth) error {
+	repository, tag := splitImageReference(image)
+	reference := fmt.Sprintf("%s:%s", repository, tag)
+
+	r.mu.Lock()
+	fakeImage, ok := r.Registry[reference]
+	r.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("manifest for %s not found", reference)
+	}
+
+	pulled := *fakeImage
+	pulled.RepoTags = nil
+	if _, err := r.findImage(pulled.ID); err != nil {
+		r.AddImage(pulled)
+	}
+	return r.ImageTag(pulled.ID, reference)
+}
+
+// ImagePush pushes an image to a registry
+func (r *FakeRuntime) ImagePush(image string, auth RegistryAuth) error {
+	repository, tag := splitImageReference(image)
+	reference := fmt.Sprintf("%s:%s", repository, tag)
+	fakeImage, err := r.findImage(reference)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Registry[reference] = fakeImage
+	return nil
+}
+
+// ImageRemove removes an image
+func (r *FakeRuntime) ImageRemove(image string) error {
+	fakeImage, err := r.findImage(image)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := []string{}
+	for _, tag := range fakeImage.RepoTags {
+		if tag != image {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) > 0 && len(tags) < len(fakeImage.RepoTags) {
+		// removing one of several tags only untags the image
+		fakeImage.RepoTags = tags
+		return nil
+	}
+	delete(r.Images, fakeImage.ID)
+	return nil
+}
+
+// ImageSave streams a tar archive containing the images
+func (r *FakeRuntime) ImageSave(images []string) (io.ReadCloser, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	manifest := []fakeImageManifest{}
+	for _, image := range images {
+		fakeImage, err := r.findImage(image)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := fakeImageManifest{Config: fmt.Sprintf("%s.json", strings.TrimPrefix(fakeImage.ID, "sha256:"))}
+		if image != fakeImage.ID {
+			entry.RepoTags = fakeImage.RepoTags
+		}
+		manifest = append(manifest, entry)
+
+		b, err := json.Marshal(fakeImage)
+		if err != nil {
+			return nil, err
+		}
+		if err := fakeWriteTarFile(tw, entry.Config, b); err != nil {
+			return nil, err
+		}
+	}
+
+	b, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := fakeWriteTarFile(tw, "manifest.json", b); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return ioutil.NopCloser(&buf), nil
+}
+
+// ImageTag adds a repository:tag reference to an existing image
+func (r *FakeRuntime) ImageTag(image string, reference string) error {
+	fakeImage, err := r.findImage(image)
+	if err != nil {
+		return err
+	}
+
+	repository, tag := splitImageReference(reference)
+	reference = fmt.Sprintf("%s:%s", repository, tag)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.Images {
+		tags := []string{}
+		for _, existing := range other.RepoTags {
+			if existing != reference {
+				tags = append(tags, existing)
+			}
+		}
+		other.RepoTags = tags
+	}
+	fakeImage.RepoTags = append(fakeImage.RepoTags, reference)
+	return nil
+}
+
+func (r *FakeRuntime) findContainer(containerID string) (*FakeContainer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, container := range r.Containers {
+		if id == containerID || container.Name == containerID || (len(containerID) >= 12 && strings.HasPrefix(id, containerID)) {
+			return container, nil
+		}
+	}
+	return nil, fmt.Errorf("No such container: %s", containerID)
+}
+
+func (r *FakeRuntime) findImage(image string) (*FakeImage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, fakeImage := range r.Images {
+		if id == image || strings.TrimPrefix(id, "sha256:") == image {
+			return fakeImage, nil
+		}
+		for _, tag := range fakeImage.RepoTags {
+			if tag == image || (!strings.Contains(image, ":") && tag == image+":latest") {
+				return fakeImage, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("No such image: %s", image)
+}
+
+func (r *FakeRuntime) imageInUse(imageID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, container := range r.Containers {
+		if container.Image == imageID {
+			return true
+		}
+	}
+	return false
+}
+
+type fakeImageManifest struct {
+	Config   string
+	RepoTags []string
+}
+
+func fakeWriteTarFile(tw *tar.Writer, name string, b []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(b)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := tw.Write(b)
+	return err
+}
+
+func fakeMatchesFilters(filters map[string][]string, labels map[string]string, fields map[string]string) bool {
+	for key, values := range filters {
+		for _, value := range values {
+			if key == "label" {
+				labelKey, labelValue, hasValue := strings.Cut(value, "=")
+				actual, ok := labels[labelKey]
+				if !ok || (hasValue && actual != labelValue) {
+					return false
+				}
+				continue
+			}
+
+			if fields[key] != value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func fakeMatchesReferences(references []string, repoTags []string) bool {
+	for _, reference := range references {
+		matched := false
+		for _, repoTag := range repoTags {
+			repository, _ := splitImageReference(repoTag)
+			if repoTag == reference || repository == reference {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
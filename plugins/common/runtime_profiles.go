@@ -0,0 +1,199 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// RuntimeProfile describes how clair drives a given container runtime cli
+type RuntimeProfile struct {
+	// Name is the value of CLAIR_CONTAINER_RUNTIME selecting the profile
+	Name string
+
+	// Command is the runtime binary
+	Command string
+
+	// UseAPI signals that the Docker Engine API should be used instead of the cli
+	UseAPI bool
+
+	// Commands maps a clair operation to the runtime subcommand implementing it
+	Commands map[string][]string
+
+	// Flags maps a clair flag name to the runtime flag implementing it
+	Flags map[string]string
+
+	// Capabilities lists the flags each operation must support
+	Capabilities map[string][]string
+}
+
+var (
+	dockerCommands = map[string][]string{
+		"container-cp":      {"container", "cp"},
+		"container-create":  {"container", "create"},
+		"container-exec":    {"container", "exec"},
+		"container-inspect": {"container", "inspect"},
+		"container-list":    {"container", "list"},
+		"container-logs":    {"container", "logs"},
+		"container-remove":  {"container", "rm"},
+		"container-start":   {"container", "start"},
+		"image-inspect":     {"image", "inspect"},
+		"image-list":        {"image", "list"},
+		"image-load":        {"image", "load"},
+		"image-prune":       {"image", "prune"},
+		"image-pull":        {"image", "pull"},
+		"image-push":        {"image", "push"},
+		"image-remove":      {"image", "rm"},
+		"image-save":        {"image", "save"},
+		"image-tag":         {"image", "tag"},
+		"registry-login":    {"login"},
+	}
+
+	dockerFlags = map[string]string{
+		"all":    "--all",
+		"filter": "--filter",
+		"force":  "--force",
+		"quiet":  "--quiet",
+		"tail":   "--tail",
+	}
+
+	dockerCapabilities = map[string][]string{
+		"container-create": {"--label"},
+		"container-list":   {"--all", "--filter", "--quiet"},
+		"container-logs":   {"--tail"},
+		"image-list":       {"--filter", "--quiet"},
+		"image-prune":      {"--all", "--filter", "--force"},
+		"registry-login":   {"--password-stdin"},
+	}
+
+	// RuntimeProfiles contains all supported container runtimes
+	RuntimeProfiles = map[string]RuntimeProfile{
+		"docker": {
+			Name:         "docker",
+			Command:      "docker",
+			UseAPI:       true,
+			Commands:     dockerCommands,
+			Flags:        dockerFlags,
+			Capabilities: dockerCapabilities,
+		},
+		"podman": {
+			Name:         "podman",
+			Command:      "podman",
+			Commands:     dockerCommands,
+			Flags:        dockerFlags,
+			Capabilities: dockerCapabilities,
+		},
+		"nerdctl": {
+			Name:    "nerdctl",
+			Command: "nerdctl",
+			Commands: map[string][]string{
+				"container-cp":      {"container", "cp"},
+				"container-create":  {"container", "create"},
+				"container-exec":    {"container", "exec"},
+				"container-inspect": {"container", "inspect", "--mode=dockercompat"},
+				"container-list":    {"container", "ls"},
+				"container-logs":    {"container", "logs"},
+				"container-remove":  {"container", "rm"},
+				"container-start":   {"container", "start"},
+				"image-inspect":     {"image", "inspect", "--mode=dockercompat"},
+				"image-list":        {"image", "ls"},
+				"image-load":        {"image", "load"},
+				"image-prune":       {"image", "prune"},
+				"image-pull":        {"image", "pull"},
+				"image-push":        {"image", "push"},
+				"image-remove":      {"image", "rm"},
+				"image-save":        {"image", "save"},
+				"image-tag":         {"image", "tag"},
+				"registry-login":    {"login"},
+			},
+			Flags: map[string]string{
+				"all":    "--all",
+				"filter": "--filter",
+				"force":  "--force",
+				"quiet":  "--quiet",
+				"tail":   "--tail",
+			},
+			Capabilities: map[string][]string{
+				"container-create": {"--label"},
+				"container-list":   {"--all", "--filter", "--quiet"},
+				"container-logs":   {"--tail"},
+				"image-list":       {"--filter", "--quiet"},
+				"image-prune":      {"--all", "--force"},
+				"registry-login":   {"--password-stdin"},
+			},
+		},
+	}
+)
+
+// Args returns the runtime arguments for a clair operation
+func (p RuntimeProfile) Args(operation string, args ...string) []string {
+	return append(append([]string{}, p.Commands[operation]...), args...)
+}
+
+// Flag returns the runtime flag for a clair flag name
+func (p RuntimeProfile) Flag(name string) string {
+	return p.Flags[name]
+}
+
+// GetRuntimeProfile returns the profile selected by CLAIR_CONTAINER_RUNTIME
+func GetRuntimeProfile() (RuntimeProfile, error) {
+	name := GetenvWithDefault("CLAIR_CONTAINER_RUNTIME", "docker")
+	profile, ok := RuntimeProfiles[name]
+	if !ok {
+		names := []string{}
+		for key := range RuntimeProfiles {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		return profile, fmt.Errorf("Invalid CLAIR_CONTAINER_RUNTIME %s, valid runtimes: %s", name, strings.Join(names, ", "))
+	}
+
+	if dockerBin := os.Getenv("DOCKER_BIN"); dockerBin != "" && dockerBin != "docker" {
+		profile.Command = dockerBin
+	}
+
+	return profile, nil
+}
+
+// VerifyRuntimeCapabilities checks that the selected runtime supports everything clair needs
+func VerifyRuntimeCapabilities() error {
+	profile, err := GetRuntimeProfile()
+	if err != nil {
+		return err
+	}
+
+	if _, err := exec.LookPath(profile.Command); err != nil {
+		return fmt.Errorf("Container runtime %s not found: %s", profile.Name, err.Error())
+	}
+
+	operations := []string{}
+	for operation := range profile.Commands {
+		operations = append(operations, operation)
+	}
+	sort.Strings(operations)
+
+	missing := []string{}
+	for _, operation := range operations {
+		helpCmd := NewShellCmdWithArgs(profile.Command, profile.Args(operation, "--help")...)
+		helpCmd.ShowOutput = false
+		b, err := helpCmd.CombinedOutput()
+		if err != nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", operation, strings.Join(profile.Commands[operation], " ")))
+			continue
+		}
+
+		for _, flag := range profile.Capabilities[operation] {
+			if !strings.Contains(string(b), flag) {
+				missing = append(missing, fmt.Sprintf("%s %s", operation, flag))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("Container runtime %s is missing required capabilities: %s", profile.Name, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonGetRuntimeProfile(t *testing.T) {
+	RegisterTestingT(t)
+	defer os.Unsetenv("CLAIR_CONTAINER_RUNTIME")
+
+	Expect(os.Setenv("CLAIR_CONTAINER_RUNTIME", "podman")).To(Succeed())
+	profile, err := GetRuntimeProfile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(profile.Command).To(Equal("podman"))
+	Expect(profile.UseAPI).To(BeFalse())
+
+	Expect(os.Setenv("CLAIR_CONTAINER_RUNTIME", "rkt")).To(Succeed())
+	_, err = GetRuntimeProfile()
+	Expect(err).To(MatchError("Invalid CLAIR_CONTAINER_RUNTIME rkt, valid runtimes: docker, nerdctl, podman"))
+}
+
+func TestCommonCLIRuntimeArgs(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := NewCLIRuntime(RuntimeProfiles["nerdctl"])
+	filterArgs := runtime.filterArgs(map[string][]string{
+		"status": {"exited"},
+		"label":  {"com.clair.app-name=test-app-1"},
+	})
+	Expect(runtime.Profile.Args("container-list", filterArgs...)).To(Equal([]string{
+		"container", "ls", "--filter", "label=com.clair.app-name=test-app-1", "--filter", "status=exited",
+	}))
+	Expect(runtime.Profile.Args("image-inspect", "clair/test-app-1")).To(Equal([]string{
+		"image", "inspect", "--mode=dockercompat", "clair/test-app-1",
+	}))
+}
+
+func TestCommonRuntimeProfileCapabilities(t *testing.T) {
+	RegisterTestingT(t)
+	for name, profile := range RuntimeProfiles {
+		for _, capabilities := range profile.Capabilities {
+			for _, capability := range capabilities {
+				if flag, ok := profile.Flags[strings.TrimPrefix(capability, "--")]; ok {
+					Expect(flag).To(Equal(capability), "%s checks %s but passes %s", name, capability, flag)
+				}
+			}
+		}
+	}
+}
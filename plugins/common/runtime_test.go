@@ -0,0 +1,234 @@
+package common
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupFakeRuntime() *FakeRuntime {
+	runtime := NewFakeRuntime()
+	runtime.AddImage(FakeImage{
+		ID:         "sha256:1111",
+		RepoTags:   []string{"clair/test-app-1:latest"},
+		Labels:     map[string]string{AppNameLabel: testAppName, "io.buildpacks.stack.id": "heroku-20"},
+		WorkingDir: "/app",
+	})
+	runtime.AddImage(FakeImage{
+		ID:     "sha256:2222",
+		Labels: map[string]string{AppNameLabel: testAppName},
+	})
+	runtime.AddContainer(FakeContainer{
+		ID:     "c1",
+		Name:   "test-app-1.web.1",
+		Image:  "sha256:1111",
+		Labels: map[string]string{AppNameLabel: testAppName, "clair": ""},
+		Status: "running",
+	})
+	runtime.AddContainer(FakeContainer{
+		ID:     "c2",
+		Name:   "test-app-1.worker.1",
+		Image:  "sha256:1111",
+		Labels: map[string]string{AppNameLabel: testAppName, "clair": ""},
+		Status: "exited",
+	})
+	SetContainerRuntime(runtime)
+	return runtime
+}
+
+func TestCommonContainerIsRunning(t *testing.T) {
+	RegisterTestingT(t)
+	setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	Expect(ContainerIsRunning("c1")).To(BeTrue())
+	Expect(ContainerIsRunning("c2")).To(BeFalse())
+	Expect(ContainerIsRunning("missing")).To(BeFalse())
+}
+
+func TestCommonDockerInspect(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	runtime.AddImage(FakeImage{ID: "sha256:3333", RepoTags: []string{"alpine:latest"}})
+
+	output, err := DockerInspect("clair/test-app-1:latest", "{{.Config.WorkingDir}}")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("/app"))
+	Expect(IsImageCnbBased("clair/test-app-1:latest")).To(BeTrue())
+	Expect(IsImageCnbBased("sha256:2222")).To(BeFalse())
+
+	output, err = DockerInspect("sha256:2222", "{{index .Config.Labels \"io.buildpacks.stack.id\"}}|{{.Config.Labels.missing}}")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("|"))
+	Expect(IsImageCnbBased("alpine:latest")).To(BeFalse())
+
+	output, err = DockerInspect("c1", "'{{.State.Running}}'")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("true"))
+}
+
+func TestCommonListDanglingImages(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	imageIDs, err := ListDanglingImages(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(imageIDs).To(Equal([]string{"sha256:2222"}))
+
+	RemoveImages(imageIDs)
+	Expect(runtime.Images).To(HaveLen(1))
+	Expect(VerifyImage("clair/test-app-1")).To(BeTrue())
+}
+
+func TestCommonListContainers(t *testing.T) {
+	RegisterTestingT(t)
+	setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+	Expect(os.Setenv("CLAIR_CONTAINER_LABEL", "clair")).To(Succeed())
+
+	containerIDs, err := listContainers("exited", testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(containerIDs).To(Equal([]string{"c2"}))
+}
+
+func TestCommonDockerContainerCreate(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	args := append([]string{"--label", "com.clair.app-name=test-app-1"}, ShellSplit("--label=org.label-schema.vendor=clair --label='description=a b'")...)
+	containerID, err := DockerContainerCreate("clair/test-app-1:latest", args)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(runtime.Containers[containerID].Labels).To(Equal(map[string]string{
+		"com.clair.app-name":      "test-app-1",
+		"org.label-schema.vendor": "clair",
+		"description":             "a b",
+	}))
+
+	args = ShellSplit("--network=clair -v /var/lib/data:/data --add-host db:10.0.0.2 --privileged --memory 1g")
+	options, err := ParseContainerCreateArgs(args)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(options.NetworkMode).To(Equal("clair"))
+	Expect(options.Binds).To(Equal([]string{"/var/lib/data:/data"}))
+	Expect(options.ExtraHosts).To(Equal([]string{"db:10.0.0.2"}))
+	Expect(options.ExtraArgs).To(Equal([]string{"--privileged", "--memory", "1g"}))
+	_, err = DockerContainerCreate("clair/test-app-1:latest", args)
+	Expect(err).NotTo(HaveOccurred())
+
+	_, err = DockerContainerCreate("clair/test-app-1:latest", []string{"--network"})
+	Expect(err).To(MatchError("Missing value for container create flag: --network"))
+
+	options, err = ParseContainerCreateArgs(ShellSplit("-d -P --name web --publish-all --no-healthcheck -e A=1 --oom-kill-disable -it --memory=1g --cpus 2 -p 80:5000 -u clair"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(options.Name).To(Equal("web"))
+	Expect(options.Env).To(Equal([]string{"A=1"}))
+	Expect(options.User).To(Equal("clair"))
+	Expect(options.ExtraArgs).To(Equal([]string{"-d", "-P", "--publish-all", "--no-healthcheck", "--oom-kill-disable", "-it", "--memory=1g", "--cpus", "2", "-p", "80:5000"}))
+
+	_, err = ParseContainerCreateArgs([]string{"web", "-d"})
+	Expect(err).To(MatchError("Unexpected container create argument: web"))
+}
+
+func TestCommonShellSplit(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(ShellSplit("")).To(BeEmpty())
+	Expect(ShellSplit("  -e  A=1\t-d ")).To(Equal([]string{"-e", "A=1", "-d"}))
+	Expect(ShellSplit(`--label='description=a b' -e "B=c d"`)).To(Equal([]string{"--label=description=a b", "-e", "B=c d"}))
+	Expect(ShellSplit(`-e A=a\ b -e B=\"c\" -e C=\'d\'`)).To(Equal([]string{"-e", "A=a b", "-e", `B="c"`, "-e", "C='d'"}))
+	Expect(ShellSplit(`-e "A=\"x\" \$HOME \n" -e 'B=\n'`)).To(Equal([]string{"-e", `A="x" $HOME \n`, "-e", `B=\n`}))
+	Expect(ShellSplit("-e A=1 \\\n -d")).To(Equal([]string{"-e", "A=1", "-d"}))
+	Expect(ShellSplit(`-e "" -e A\\B -e C\`)).To(Equal([]string{"-e", "", "-e", `A\B`, "-e", `C\`}))
+}
+
+func TestCommonDockerAPIRuntime(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := os.MkdirTemp("", "clair-docker-api")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "docker.sock")
+	listener, err := net.Listen("unix", socketPath)
+	Expect(err).NotTo(HaveOccurred())
+
+	var filters, tagQuery, registryAuth, removePath string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.41/containers/json":
+			filters = r.URL.Query().Get("filters")
+			json.NewEncoder(w).Encode([]map[string]string{{"Id": "c1"}})
+		case "/v1.41/images/sha256:1111/tag":
+			tagQuery = r.URL.RawQuery
+			w.WriteHeader(http.StatusCreated)
+		case "/v1.41/images/localhost:5000/clair/test-app-1/push":
+			registryAuth = r.Header.Get("X-Registry-Auth")
+			w.Write([]byte(`{"status":"Pushing"}` + "\n" + `{"error":"denied: requested access to the resource is denied"}`))
+		case "/v1.41/containers/c1/exec":
+			json.NewEncoder(w).Encode(map[string]string{"Id": "e1"})
+		case "/v1.41/exec/e1/start":
+			w.Write(append([]byte{2, 0, 0, 0, 0, 0, 0, 12}, "no response\n"...))
+		case "/v1.41/exec/e1/json":
+			json.NewEncoder(w).Encode(map[string]int{"ExitCode": 2})
+		case "/v1.41/containers/c1/logs":
+			w.Write(append(append([]byte{1, 0, 0, 0, 0, 0, 0, 4}, "one\n"...), append([]byte{2, 0, 0, 0, 0, 0, 0, 4}, "two\n"...)...))
+		case "/v1.41/images/clair/test-app-1:release-2":
+			removePath = r.URL.EscapedPath()
+			json.NewEncoder(w).Encode([]map[string]string{{"Untagged": "clair/test-app-1:release-2"}})
+		case "/v1.41/images/missing/json":
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "No such image: missing"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	runtime := NewDockerAPIRuntime("unix://" + socketPath)
+	containerIDs, err := runtime.ContainerList(NewListOptions(true, "label=com.clair.app-name=test-app-1"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(containerIDs).To(Equal([]string{"c1"}))
+	Expect(filters).To(Equal(`{"label":["com.clair.app-name=test-app-1"]}`))
+
+	output, err := runtime.ContainerExec("c1", []string{"pg_isready"})
+	Expect(err).To(MatchError("exit status 2"))
+	Expect(string(output)).To(Equal("no response\n"))
+	output, err = runtime.ContainerLogs("c1", 2)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(output)).To(Equal("one\ntwo\n"))
+
+	_, err = runtime.ImageInspect("missing")
+	Expect(err).To(MatchError("No such image: missing"))
+
+	Expect(runtime.ImageTag("sha256:1111", "localhost:5000/clair/test-app-1:release-2")).To(Succeed())
+	Expect(tagQuery).To(Equal("repo=localhost%3A5000%2Fclair%2Ftest-app-1&tag=release-2"))
+
+	Expect(runtime.ImageRemove("clair/test-app-1:release-2")).To(Succeed())
+	Expect(removePath).To(Equal("/v1.41/images/clair%2Ftest-app-1:release-2"))
+
+	err = runtime.ImagePush("localhost:5000/clair/test-app-1:release-2", RegistryAuth{Username: "clair", Password: "secret", ServerAddress: "localhost:5000"})
+	Expect(err).To(MatchError("denied: requested access to the resource is denied"))
+	b, err := base64.URLEncoding.DecodeString(registryAuth)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(b)).To(Equal(`{"username":"clair","password":"secret","serveraddress":"localhost:5000"}`))
+}
+
+func TestCommonImageTag(t *testing.T) {
+	RegisterTestingT(t)
+	runtime := setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	Expect(runtime.ImageTag("sha256:2222", "clair/test-app-1")).To(Succeed())
+	Expect(runtime.Images["sha256:2222"].RepoTags).To(Equal([]string{"clair/test-app-1:latest"}))
+	Expect(runtime.Images["sha256:1111"].RepoTags).To(BeEmpty())
+	Expect(runtime.ImageTag("missing", "clair/test-app-1:latest")).NotTo(Succeed())
+}
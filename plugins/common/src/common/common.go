@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	flag "github.com/spf13/pflag"
 	"github.com/vinybergamo/clair/plugins/common"
@@ -11,6 +13,8 @@ import (
 func main() {
 	quiet := flag.Bool("quiet", false, "--quiet: set CLAIR_QUIET_OUTPUT=1")
 	global := flag.Bool("global", false, "--global: Whether global or app-specific")
+	dryRun := flag.Bool("dry-run", false, "--dry-run: list what would be removed without removing anything")
+	format := flag.String("format", "", "--format: help metadata format, json or man")
 	flag.Parse()
 	cmd := flag.Arg(0)
 
@@ -20,13 +24,55 @@ func main() {
 
 	var err error
 	switch cmd {
+	case "audit-log":
+		decision := flag.Arg(1)
+		exitCode, _ := strconv.Atoi(flag.Arg(2))
+		var startedAt time.Time
+		if nanos, parseErr := strconv.ParseInt(flag.Arg(3), 10, 64); parseErr == nil {
+			startedAt = time.Unix(0, nanos)
+		}
+		var args []string
+		if flag.NArg() > 4 {
+			args = flag.Args()[4:]
+		}
+		err = common.RecordCommandAudit(decision, exitCode, startedAt, args)
+	case "auth-check":
+		err = common.AuthorizeInvocation(os.Getenv("SSH_USER"), os.Getenv("SSH_NAME"), flag.Args()[1:])
+	case "auth-token":
+		var token common.APIToken
+		token, err = common.AuthenticateAPIToken(os.Getenv("CLAIR_API_TOKEN"))
+		if err == nil {
+			err = token.AuthorizeInvocation(flag.Args()[1:])
+		}
+		if err == nil {
+			fmt.Print(token.ID)
+		}
+	case "deploy-failed":
+		appName := flag.Arg(1)
+		imageTag := flag.Arg(2)
+		common.EmitDeployFailedEvent(appName, imageTag)
 	case "docker-cleanup":
 		appName := flag.Arg(1)
 		force := common.ToBool(flag.Arg(2))
 		if *global {
 			appName = "--global"
 		}
-		err = common.DockerCleanup(appName, force)
+		err = common.DockerCleanup(appName, force, *dryRun)
+	case "help":
+		err = common.CommandHelpMetadata(*format)
+	case "help-complete":
+		err = common.CommandHelpComplete(flag.Args()[1:])
+	case "help-completion":
+		shell := flag.Arg(1)
+		err = common.CommandHelpCompletion(shell)
+	case "image-pin":
+		appName := flag.Arg(1)
+		image := flag.Arg(2)
+		_, err = common.PinAppImageID(appName, image)
+	case "image-verify":
+		appName := flag.Arg(1)
+		imageTag := flag.Arg(2)
+		err = common.VerifyDeployImage(appName, imageTag)
 	case "is-deployed":
 		appName := flag.Arg(1)
 		if !common.IsDeployed(appName) {
@@ -47,6 +93,14 @@ func main() {
 		} else {
 			fmt.Print("false")
 		}
+	case "resolve-app-args":
+		for _, arg := range common.ResolveCommandAppArgs(flag.Args()[1:]) {
+			fmt.Printf("%s\x00", arg)
+		}
+	case "resolve-app-name":
+		fmt.Print(common.ResolveAppName(flag.Arg(1)))
+	case "runtime-check":
+		err = common.VerifyRuntimeCapabilities()
 	case "scheduler-detect":
 		appName := flag.Arg(1)
 		if *global {
@@ -1,7 +1,9 @@
 package common
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -74,13 +76,25 @@ func (sc *ShellCmd) CombinedOutput() ([]byte, error) {
 	return sc.Command.CombinedOutput()
 }
 
+// PluginTrigger calls a trigger, in-process when every plugin implementing it
+// is compiled into the running binary and via plugn otherwise
 func PluginTrigger(triggerName string, args ...string) error {
 	LogDebug(fmt.Sprintf("plugin trigger %s %v", triggerName, args))
+	if triggers, ok := registeredTriggers(triggerName); ok {
+		return callTriggers(triggers, args, os.Stdout)
+	}
 	return PluginTriggerSetup(triggerName, args...).Run()
 }
 
+// PluginTriggerOutput calls a trigger like PluginTrigger and returns its stdout
 func PluginTriggerOutput(triggerName string, args ...string) ([]byte, error) {
 	LogDebug(fmt.Sprintf("plugin trigger %s %v", triggerName, args))
+	if triggers, ok := registeredTriggers(triggerName); ok {
+		var stdout bytes.Buffer
+		err := callTriggers(triggers, args, &stdout)
+		return stdout.Bytes(), err
+	}
+
 	rE, wE, _ := os.Pipe()
 	rO, wO, _ := os.Pipe()
 	session := PluginTriggerSetup(triggerName, args...)
@@ -110,6 +124,18 @@ func PluginTriggerOutput(triggerName string, args ...string) ([]byte, error) {
 	return readStdout, err
 }
 
+// callTriggers calls trigger handlers in order, stopping at the first failure
+// like plugn does
+func callTriggers(triggers []*Trigger, args []string, stdout io.Writer) error {
+	for _, trigger := range triggers {
+		LogDebug(fmt.Sprintf("plugin trigger %s called in-process", trigger.Name))
+		if err := trigger.call(args, stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func PluginTriggerSetup(triggerName string, args ...string) *sh.Session {
 	shellArgs := make([]interface{}, len(args)+2)
 	shellArgs[0] = "trigger"
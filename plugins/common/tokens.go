@@ -0,0 +1,394 @@
+package common
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// apiTokenPrefix starts every api token, followed by the token id and secret
+const apiTokenPrefix = "clair_"
+
+// readCommands are the subcommands covered by the <plugin>:read scope
+var readCommands = map[string]bool{
+	"deliveries": true,
+	"disk-usage": true,
+	"exists":     true,
+	"help":       true,
+	"images":     true,
+	"list":       true,
+	"locked":     true,
+	"openapi":    true,
+	"query":      true,
+	"releases":   true,
+	"report":     true,
+	"show":       true,
+}
+
+// adminCommands are the subcommands that display information only admins may
+// see and are therefore not covered by a read scope
+var adminCommands = map[string]bool{
+	"audit:query": true,
+}
+
+// readTopLevelCommands are the top-level commands that only display
+// information and are covered by a <command>:read scope. Any other top-level
+// command, such as deploy or run, requires a scope of its own name.
+var readTopLevelCommands = map[string]bool{
+	"api":      true,
+	"apps":     true,
+	"audit":    true,
+	"auth":     true,
+	"events":   true,
+	"help":     true,
+	"logs":     true,
+	"metrics":  true,
+	"registry": true,
+	"report":   true,
+	"url":      true,
+	"urls":     true,
+	"version":  true,
+	"webhooks": true,
+}
+
+// APIToken is a scoped credential used by automation in place of an ssh key
+type APIToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	Scopes     []string  `json:"scopes"`
+	Apps       []string  `json:"apps,omitempty"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	RevokedAt  time.Time `json:"revoked_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// Status returns whether the token is active, expired or revoked
+func (t APIToken) Status(now time.Time) string {
+	if !t.RevokedAt.IsZero() {
+		return "revoked"
+	}
+	if !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt) {
+		return "expired"
+	}
+	return "active"
+}
+
+// AllowsScope returns true if the token grants the scope. Scopes of the form
+// <plugin>:* grant every scope of a plugin, *:read grants every read scope
+// and * grants every scope.
+func (t APIToken) AllowsScope(scope string) bool {
+	return scopeAllows(t.Scopes, scope)
+}
+
+// AllowsApp returns true if the token may act on the app. Tokens without app
+// patterns may act on every app.
+func (t APIToken) AllowsApp(appName string) bool {
+	if len(t.Apps) == 0 || appName == "" {
+		return true
+	}
+
+	for _, pattern := range t.Apps {
+		if matched, _ := path.Match(pattern, appName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize returns an error unless the token may run the command against the
+// app. Tokens restricted to some apps may only run read commands without an app.
+func (t APIToken) Authorize(command string, appName string) error {
+	scope := CommandScope(command)
+	if !t.AllowsScope(scope) {
+		return fmt.Errorf("Token %s does not grant the %s scope", t.ID, scope)
+	}
+	if appName == "" && len(t.Apps) > 0 && !strings.HasSuffix(scope, ":read") {
+		return fmt.Errorf("Token %s may only run %s against its apps", t.ID, command)
+	}
+	if !t.AllowsApp(appName) {
+		return fmt.Errorf("Token %s does not grant access to %s", t.ID, appName)
+	}
+	return nil
+}
+
+// AuthorizeInvocation returns an error unless the token may run the command
+// invocation against every app it names
+func (t APIToken) AuthorizeInvocation(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	appNames := CommandAppNames(args)
+	if len(appNames) == 0 {
+		return t.Authorize(args[0], "")
+	}
+	for _, appName := range appNames {
+		if err := t.Authorize(args[0], appName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommandAppName returns the first app a command invocation acts on
+func CommandAppName(args []string) string {
+	if appNames := CommandAppNames(args); len(appNames) > 0 {
+		return appNames[0]
+	}
+	return ""
+}
+
+// CommandAppNames returns every app a command invocation acts on, taken from
+// the --app flag and the app arguments described by the command help
+// metadata. Commands without help metadata act on their first argument.
+func CommandAppNames(args []string) []string {
+	if len(args) == 0 {
+		return []string{}
+	}
+
+	appName := os.Getenv("CLAIR_APP_NAME")
+	help, ok := CommandHelpFor(args[0])
+	if !ok {
+		if appName != "" {
+			return []string{appName}
+		}
+		if len(args) > 1 && !strings.HasPrefix(args[1], "-") {
+			return []string{args[1]}
+		}
+		return []string{}
+	}
+
+	return commandAppNames(help, args[1:], appName)
+}
+
+// commandAppNames returns the app arguments of an invocation, where the --app
+// flag takes the place of the first app argument
+func commandAppNames(help CommandHelp, args []string, appName string) []string {
+	appNames := []string{}
+	seen := map[string]bool{}
+	if appName != "" {
+		appNames = append(appNames, appName)
+		seen[appName] = true
+		if len(help.Args) > 0 && (help.Args[0].Complete == CompleteApp || help.Args[0].App) {
+			args = append([]string{appName}, args...)
+		}
+	}
+
+	for _, index := range help.AppArgIndexes(args, false) {
+		if !seen[args[index]] {
+			seen[args[index]] = true
+			appNames = append(appNames, args[index])
+		}
+	}
+	return appNames
+}
+
+// CommandScope returns the scope required to run a command, <plugin>:read for
+// commands known to only display information and the command itself otherwise
+func CommandScope(command string) string {
+	parts := strings.SplitN(command, ":", 2)
+	if adminCommands[command] {
+		return command
+	}
+	if len(parts) == 1 {
+		if readTopLevelCommands[command] {
+			return command + ":read"
+		}
+		return command
+	}
+	if readCommands[parts[1]] {
+		return parts[0] + ":read"
+	}
+	return command
+}
+
+// ValidateTokenScope returns an error if the scope is malformed
+func ValidateTokenScope(scope string) error {
+	if scope == "*" || scope == "*:read" {
+		return nil
+	}
+
+	parts := strings.SplitN(scope, ":", 2)
+	if len(parts) == 1 && scope != "" && !readTopLevelCommands[scope] {
+		return nil
+	}
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return fmt.Errorf("Invalid scope %s: must be of the form <command>, <plugin>:<command>, <plugin>:read, <plugin>:* or *:read", scope)
+	}
+	return nil
+}
+
+// CreateAPIToken stores a new token and returns it along with the secret token
+// string, which is only ever available at creation
+func CreateAPIToken(name string, scopes []string, apps []string, ttl time.Duration, createdBy string) (string, APIToken, error) {
+	token := APIToken{Name: name, Scopes: scopes, Apps: apps, CreatedBy: createdBy, CreatedAt: time.Now().UTC()}
+	if len(scopes) == 0 {
+		return "", token, errors.New("Please specify at least one scope")
+	}
+	for _, scope := range scopes {
+		if err := ValidateTokenScope(scope); err != nil {
+			return "", token, err
+		}
+	}
+	for _, pattern := range apps {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", token, fmt.Errorf("Invalid app pattern %s", pattern)
+		}
+	}
+	if ttl > 0 {
+		token.ExpiresAt = token.CreatedAt.Add(ttl)
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", token, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", token, err
+	}
+	token.ID = id
+	token.Hash = hashTokenSecret(secret)
+
+	if err := writeAPIToken(token); err != nil {
+		return "", token, err
+	}
+	return apiTokenPrefix + id + "_" + secret, token, nil
+}
+
+// AuthenticateAPIToken returns the active token matching the token string and
+// records when it was last used
+func AuthenticateAPIToken(tokenString string) (APIToken, error) {
+	invalid := errors.New("Invalid api token")
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(tokenString), apiTokenPrefix), "_", 2)
+	if !strings.HasPrefix(tokenString, apiTokenPrefix) || len(parts) != 2 {
+		return APIToken{}, invalid
+	}
+
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return APIToken{}, invalid
+	}
+
+	token, err := GetAPIToken(parts[0])
+	if err != nil {
+		return APIToken{}, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(hashTokenSecret(parts[1])), []byte(token.Hash)) != 1 {
+		return APIToken{}, invalid
+	}
+
+	now := time.Now().UTC()
+	if status := token.Status(now); status != "active" {
+		return token, fmt.Errorf("Api token %s is %s", token.ID, status)
+	}
+
+	token.LastUsedAt = now
+	if err := writeAPIToken(token); err != nil {
+		LogDebug(fmt.Sprintf("Unable to record api token use: %s", err.Error()))
+	}
+	return token, nil
+}
+
+// CurrentAPIToken returns the token the current command was authenticated
+// with, as recorded in CLAIR_TOKEN_ID. The clair entrypoint clears the
+// variable on entry, so only clair_auth sets it for an invocation.
+func CurrentAPIToken() (APIToken, bool) {
+	id := os.Getenv("CLAIR_TOKEN_ID")
+	if id == "" {
+		return APIToken{}, false
+	}
+
+	token, err := GetAPIToken(id)
+	if err != nil {
+		return APIToken{}, false
+	}
+	return token, true
+}
+
+// GetAPIToken returns a stored token by id
+func GetAPIToken(id string) (APIToken, error) {
+	var token APIToken
+	value := PropertyGet("auth", "--global", "token."+id)
+	if value == "" {
+		return token, fmt.Errorf("Api token %s not found", id)
+	}
+
+	if err := json.Unmarshal([]byte(value), &token); err != nil {
+		return token, fmt.Errorf("Unable to parse api token %s: %s", id, err.Error())
+	}
+	return token, nil
+}
+
+// GetAPITokens returns every stored token, oldest first
+func GetAPITokens() ([]APIToken, error) {
+	tokens := []APIToken{}
+	properties, err := PropertyGetAll("auth", "--global")
+	if err != nil {
+		return tokens, err
+	}
+
+	for property := range properties {
+		if !strings.HasPrefix(property, "token.") {
+			continue
+		}
+
+		token, err := GetAPIToken(strings.TrimPrefix(property, "token."))
+		if err != nil {
+			LogWarn(err.Error())
+			continue
+		}
+		tokens = append(tokens, token)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// RevokeAPIToken marks a token as revoked so that it can no longer be used
+func RevokeAPIToken(id string) error {
+	token, err := GetAPIToken(id)
+	if err != nil {
+		return err
+	}
+	if !token.RevokedAt.IsZero() {
+		return fmt.Errorf("Api token %s is already revoked", id)
+	}
+
+	token.RevokedAt = time.Now().UTC()
+	return writeAPIToken(token)
+}
+
+func writeAPIToken(token APIToken) error {
+	b, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	return PropertyWrite("auth", "--global", "token."+token.ID, string(b))
+}
+
+func hashTokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
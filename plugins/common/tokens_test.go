@@ -0,0 +1,135 @@
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupTokenStore() (func(), error) {
+	libRoot, err := ioutil.TempDir("", "clair-lib-root")
+	if err != nil {
+		return func() {}, err
+	}
+
+	os.Setenv("CLAIR_LIB_ROOT", libRoot)
+	os.Setenv("CLAIR_SYSTEM_GROUP", "root")
+	os.Setenv("CLAIR_SYSTEM_USER", "root")
+	return func() {
+		os.RemoveAll(libRoot)
+		os.Unsetenv("CLAIR_LIB_ROOT")
+		os.Unsetenv("CLAIR_SYSTEM_GROUP")
+		os.Unsetenv("CLAIR_SYSTEM_USER")
+		os.Unsetenv("CLAIR_TOKEN_ID")
+	}, nil
+}
+
+func TestCommonAPITokenScopes(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(CommandScope("apps:report")).To(Equal("apps:read"))
+	Expect(CommandScope("apps")).To(Equal("apps:read"))
+	Expect(CommandScope("apps:lock")).To(Equal("apps:lock"))
+	Expect(CommandScope("events:query")).To(Equal("events:read"))
+	Expect(CommandScope("audit:query")).To(Equal("audit:query"))
+	Expect(CommandScope("run")).To(Equal("run"))
+	Expect(CommandScope("enter")).To(Equal("enter"))
+	Expect(APIToken{ID: "4", Scopes: []string{"*:read"}}.Authorize("run", "payments-api")).To(MatchError("Token 4 does not grant the run scope"))
+
+	token := APIToken{ID: "1", Scopes: []string{"apps:read", "apps:lock", "events:*"}, Apps: []string{"payments-*"}}
+	Expect(token.Authorize("apps:list", "")).To(Succeed())
+	Expect(token.Authorize("apps:lock", "payments-api")).To(Succeed())
+	Expect(token.Authorize("events:query", "payments-api")).To(Succeed())
+	Expect(token.Authorize("apps:destroy", "payments-api")).To(MatchError("Token 1 does not grant the apps:destroy scope"))
+	Expect(token.Authorize("apps:lock", "billing")).To(MatchError("Token 1 does not grant access to billing"))
+	Expect(token.Authorize("apps:lock", "")).To(MatchError("Token 1 may only run apps:lock against its apps"))
+	Expect(APIToken{ID: "3", Scopes: []string{"apps:lock"}}.Authorize("apps:lock", "")).To(Succeed())
+	Expect(APIToken{ID: "2", Scopes: []string{"*:read"}}.Authorize("audit:query", "")).To(MatchError("Token 2 does not grant the audit:query scope"))
+
+	Expect(ValidateTokenScope("*")).To(Succeed())
+	Expect(ValidateTokenScope("apps")).NotTo(Succeed())
+	Expect(ValidateTokenScope("run")).To(Succeed())
+	Expect(ValidateTokenScope("apps:")).NotTo(Succeed())
+}
+
+func TestCommonCommandAppNames(t *testing.T) {
+	RegisterTestingT(t)
+
+	clone := CommandHelp{
+		Name:  "apps:clone",
+		Args:  []Arg{{Name: "old-app", Complete: CompleteApp}, {Name: "new-app", App: true}},
+		Flags: []Flag{{Name: "skip-deploy", Kind: KindBool}},
+	}
+	Expect(commandAppNames(clone, []string{"--skip-deploy", "payments-api", "billing"}, "")).To(Equal([]string{"payments-api", "billing"}))
+	Expect(clone.AppArgIndexes([]string{"payments-api", "billing"}, true)).To(Equal([]int{0}))
+
+	aliasAdd := CommandHelp{Name: "apps:alias:add", Args: []Arg{{Name: "alias"}, {Name: "app", Complete: CompleteApp}}}
+	Expect(commandAppNames(aliasAdd, []string{"pay", "payments-api"}, "")).To(Equal([]string{"payments-api"}))
+
+	set := CommandHelp{
+		Name:   "registry:set",
+		Global: true,
+		Args:   []Arg{{Name: "app", Complete: CompleteApp}, {Name: "key"}, {Name: "value", Optional: true}},
+		Flags:  []Flag{{Name: "format"}},
+	}
+	Expect(commandAppNames(set, []string{"--global", "server", "example.com"}, "")).To(BeEmpty())
+	Expect(commandAppNames(set, []string{"--format", "json", "payments-api", "server"}, "")).To(Equal([]string{"payments-api"}))
+	Expect(commandAppNames(set, []string{"server", "example.com"}, "billing")).To(Equal([]string{"billing"}))
+
+	parsed := ParseHelpLines("    config:set [--global|<app>] [--no-restart] <key>=<value>, Set config vars\n")
+	Expect(parsed[0].Commands[0].Global).To(BeTrue())
+	Expect(commandAppNames(parsed[0].Commands[0], []string{"payments-api", "KEY=value"}, "")).To(Equal([]string{"payments-api"}))
+}
+
+func TestCommonAPITokenLifecycle(t *testing.T) {
+	RegisterTestingT(t)
+	teardown, err := setupTokenStore()
+	Expect(err).NotTo(HaveOccurred())
+	defer teardown()
+
+	_, _, err = CreateAPIToken("ci", []string{}, nil, 0, "admin")
+	Expect(err).To(MatchError("Please specify at least one scope"))
+
+	tokenString, token, err := CreateAPIToken("ci", []string{"apps:read"}, []string{"payments-*"}, time.Hour, "admin")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tokenString).To(HavePrefix("clair_" + token.ID + "_"))
+	Expect(token.Hash).NotTo(BeEmpty())
+	Expect(strings.Contains(PropertyGet("auth", "--global", "token."+token.ID), strings.Split(tokenString, "_")[2])).To(BeFalse())
+
+	authenticated, err := AuthenticateAPIToken(tokenString)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(authenticated.ID).To(Equal(token.ID))
+	stored, err := GetAPIToken(token.ID)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stored.LastUsedAt.IsZero()).To(BeFalse())
+
+	_, err = AuthenticateAPIToken(tokenString + "0")
+	Expect(err).To(MatchError("Invalid api token"))
+	_, err = AuthenticateAPIToken("clair_../../x_y")
+	Expect(err).To(MatchError("Invalid api token"))
+
+	Expect(os.Setenv("CLAIR_TOKEN_ID", token.ID)).To(Succeed())
+	Expect(filterApps([]string{"payments-api", "billing", "payments-worker"})).To(Equal([]string{"payments-api", "payments-worker"}))
+	_, err = filterApps([]string{"billing"})
+	Expect(err).To(HaveOccurred())
+	events := FilterEvents([]Event{{Type: "deploy", App: "payments-api"}, {Type: "deploy", App: "billing"}, {Type: "plugin-install"}})
+	Expect(events).To(Equal([]Event{{Type: "deploy", App: "payments-api"}}))
+
+	Expect(RevokeAPIToken(token.ID)).To(Succeed())
+	_, err = AuthenticateAPIToken(tokenString)
+	Expect(err).To(MatchError("Api token " + token.ID + " is revoked"))
+
+	expiredString, expired, err := CreateAPIToken("old", []string{"*"}, nil, time.Nanosecond, "admin")
+	Expect(err).NotTo(HaveOccurred())
+	time.Sleep(time.Millisecond)
+	_, err = AuthenticateAPIToken(expiredString)
+	Expect(err).To(MatchError("Api token " + expired.ID + " is expired"))
+
+	tokens, err := GetAPITokens()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tokens).To(HaveLen(2))
+	Expect(tokens[0].Name).To(Equal("ci"))
+}
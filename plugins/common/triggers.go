@@ -27,6 +27,10 @@ func TriggerCorePostDeploy(appName string) error {
 }
 
 func TriggerInstall() error {
+	if err := VerifyRuntimeCapabilities(); err != nil {
+		return fmt.Errorf("Unable to install the common plugin: %s", err.Error())
+	}
+
 	if err := PropertySetup("common"); err != nil {
 		return fmt.Errorf("Unable to install the common plugin: %s", err.Error())
 	}
@@ -0,0 +1,232 @@
+package common
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageVerificationPolicy controls the checks run against an app image before it is deployed
+type ImageVerificationPolicy struct {
+	// PinImageID requires the deployed image to match the image id pinned at release time
+	PinImageID bool
+
+	// PublicKey is the path to a PEM encoded public key used to verify image signatures
+	PublicKey string
+
+	// SignatureDir contains the detached signatures, named after the image id
+	SignatureDir string
+}
+
+// ImageVerificationResult is the outcome of verifying an app image
+type ImageVerificationResult struct {
+	Image             string    `json:"image"`
+	ImageID           string    `json:"image_id"`
+	PinnedImageID     string    `json:"pinned_image_id"`
+	ImageIDVerified   bool      `json:"image_id_verified"`
+	SignatureVerified bool      `json:"signature_verified"`
+	Status            string    `json:"status"`
+	Error             string    `json:"error,omitempty"`
+	VerifiedAt        time.Time `json:"verified_at"`
+}
+
+// IsSet returns true if the policy runs any checks
+func (p ImageVerificationPolicy) IsSet() bool {
+	return p.PinImageID || p.PublicKey != ""
+}
+
+// GetImageVerificationPolicy returns the image verification policy for an app,
+// falling back to the global policy for any setting the app does not define
+func GetImageVerificationPolicy(appName string) (ImageVerificationPolicy, error) {
+	policy := ImageVerificationPolicy{
+		PublicKey:    appsPropertyOrGlobal(appName, "image-verify-key"),
+		SignatureDir: appsPropertyOrGlobal(appName, "image-signature-dir"),
+	}
+
+	if pinImageID := appsPropertyOrGlobal(appName, "image-pin-id"); pinImageID != "" {
+		b, err := strconv.ParseBool(pinImageID)
+		if err != nil {
+			return policy, fmt.Errorf("Invalid image-pin-id %s: must be true or false", pinImageID)
+		}
+		policy.PinImageID = b
+	}
+
+	if policy.SignatureDir == "" {
+		policy.SignatureDir = filepath.Join(GetAppDataDirectory("apps", appName), "signatures")
+	}
+
+	return policy, nil
+}
+
+// PinAppImageID records the id of a freshly released app image so later
+// deploys can be pinned to it
+func PinAppImageID(appName string, image string) (string, error) {
+	imageID, err := appImageID(image)
+	if err != nil {
+		return "", err
+	}
+
+	return imageID, PropertyWrite("apps", appName, "image-pinned-id", imageID)
+}
+
+// VerifyAppImage checks an app image against a verification policy
+func VerifyAppImage(appName string, image string, policy ImageVerificationPolicy) ImageVerificationResult {
+	result := ImageVerificationResult{
+		Image:         image,
+		PinnedImageID: strings.TrimSpace(PropertyGet("apps", appName, "image-pinned-id")),
+		Status:        "skipped",
+		VerifiedAt:    time.Now().UTC(),
+	}
+	if !policy.IsSet() {
+		return result
+	}
+
+	fail := func(err error) ImageVerificationResult {
+		result.Status = "failed"
+		result.Error = err.Error()
+		return result
+	}
+
+	imageID, err := appImageID(image)
+	if err != nil {
+		return fail(err)
+	}
+	result.ImageID = imageID
+
+	if policy.PinImageID {
+		if result.PinnedImageID == "" {
+			return fail(fmt.Errorf("No image id has been pinned for %s", appName))
+		}
+		if result.PinnedImageID != imageID {
+			return fail(fmt.Errorf("Image id %s does not match pinned image id %s", imageID, result.PinnedImageID))
+		}
+		result.ImageIDVerified = true
+	}
+
+	if policy.PublicKey != "" {
+		publicKey, err := ioutil.ReadFile(policy.PublicKey)
+		if err != nil {
+			return fail(fmt.Errorf("Unable to read image verification key: %s", err.Error()))
+		}
+
+		signaturePath := filepath.Join(policy.SignatureDir, strings.TrimPrefix(imageID, "sha256:")+".sig")
+		signature, err := ioutil.ReadFile(signaturePath)
+		if err != nil {
+			return fail(fmt.Errorf("No signature found for image id %s", imageID))
+		}
+
+		if err := VerifyImageSignature(imageID, signature, publicKey); err != nil {
+			return fail(err)
+		}
+		result.SignatureVerified = true
+	}
+
+	result.Status = "verified"
+	return result
+}
+
+// VerifyDeployImage verifies the image that will be deployed for an app and
+// records the result, returning an error if verification fails
+func VerifyDeployImage(appName string, imageTag string) error {
+	policy, err := GetImageVerificationPolicy(appName)
+	if err != nil {
+		return err
+	}
+	if !policy.IsSet() {
+		return nil
+	}
+
+	image, err := GetDeployingAppImageName(appName, imageTag, "")
+	if err != nil {
+		return err
+	}
+
+	result := VerifyAppImage(appName, image, policy)
+	if b, err := json.Marshal(result); err == nil {
+		if err := PropertyWrite("apps", appName, "image-verification", string(b)); err != nil {
+			LogWarn(fmt.Sprintf("Unable to record image verification result: %s", err.Error()))
+		}
+	}
+
+	if result.Status == "failed" {
+		return fmt.Errorf("Image verification failed for %s: %s", image, result.Error)
+	}
+
+	LogVerboseQuiet(fmt.Sprintf("Verified image %s (%s)", image, result.ImageID))
+	return nil
+}
+
+// GetImageVerificationResult returns the last recorded image verification result for an app
+func GetImageVerificationResult(appName string) (ImageVerificationResult, bool) {
+	var result ImageVerificationResult
+	value := PropertyGet("apps", appName, "image-verification")
+	if value == "" {
+		return result, false
+	}
+
+	if err := json.Unmarshal([]byte(value), &result); err != nil {
+		return result, false
+	}
+	return result, true
+}
+
+// VerifyImageSignature verifies a detached signature of an image id. The
+// signature may be raw or base64 encoded, and the key must be a PEM encoded
+// ed25519, ecdsa or rsa public key.
+func VerifyImageSignature(imageID string, signature []byte, publicKey []byte) error {
+	block, _ := pem.Decode(publicKey)
+	if block == nil {
+		return errors.New("Invalid image verification key: no PEM data found")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("Invalid image verification key: %s", err.Error())
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature))); err == nil {
+		signature = decoded
+	}
+
+	hash := sha256.Sum256([]byte(imageID))
+	verified := false
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		verified = ed25519.Verify(k, []byte(imageID), signature)
+	case *ecdsa.PublicKey:
+		verified = ecdsa.VerifyASN1(k, hash[:], signature)
+	case *rsa.PublicKey:
+		verified = rsa.VerifyPKCS1v15(k, crypto.SHA256, hash[:], signature) == nil
+	default:
+		return fmt.Errorf("Unsupported image verification key type %T", key)
+	}
+
+	if !verified {
+		return fmt.Errorf("Invalid signature for image id %s", imageID)
+	}
+	return nil
+}
+
+func appImageID(image string) (string, error) {
+	images, err := InspectImages([]string{image})
+	if err != nil {
+		return "", err
+	}
+	if len(images) == 0 {
+		return "", fmt.Errorf("App image (%s) not found", image)
+	}
+	return images[0].ID, nil
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonVerifyImageSignature(t *testing.T) {
+	RegisterTestingT(t)
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	Expect(err).NotTo(HaveOccurred())
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	signature := ed25519.Sign(privateKey, []byte("sha256:1111"))
+	Expect(VerifyImageSignature("sha256:1111", signature, publicKeyPEM)).To(Succeed())
+	Expect(VerifyImageSignature("sha256:1111", []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), publicKeyPEM)).To(Succeed())
+	Expect(VerifyImageSignature("sha256:2222", signature, publicKeyPEM)).To(MatchError("Invalid signature for image id sha256:2222"))
+	Expect(VerifyImageSignature("sha256:1111", signature, []byte("not a key"))).NotTo(Succeed())
+}
+
+func TestCommonVerifyAppImage(t *testing.T) {
+	RegisterTestingT(t)
+	setupFakeRuntime()
+	defer SetContainerRuntime(nil)
+
+	libRoot, err := ioutil.TempDir("", "clair-lib-root")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(libRoot)
+	Expect(os.Setenv("CLAIR_LIB_ROOT", libRoot)).To(Succeed())
+	defer os.Unsetenv("CLAIR_LIB_ROOT")
+
+	image := "clair/test-app-1:latest"
+	result := VerifyAppImage(testAppName, image, ImageVerificationPolicy{})
+	Expect(result.Status).To(Equal("skipped"))
+
+	result = VerifyAppImage(testAppName, image, ImageVerificationPolicy{PinImageID: true})
+	Expect(result.Status).To(Equal("failed"))
+	Expect(result.Error).To(Equal("No image id has been pinned for test-app-1"))
+
+	Expect(os.MkdirAll(getPluginAppPropertyPath("apps", testAppName), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(getPropertyPath("apps", testAppName, "image-pinned-id"), []byte("sha256:2222"), 0644)).To(Succeed())
+	result = VerifyAppImage(testAppName, image, ImageVerificationPolicy{PinImageID: true})
+	Expect(result.Status).To(Equal("failed"))
+	Expect(result.Error).To(Equal("Image id sha256:1111 does not match pinned image id sha256:2222"))
+
+	Expect(ioutil.WriteFile(getPropertyPath("apps", testAppName, "image-pinned-id"), []byte("sha256:1111"), 0644)).To(Succeed())
+	result = VerifyAppImage(testAppName, image, ImageVerificationPolicy{PinImageID: true})
+	Expect(result.Status).To(Equal("verified"))
+	Expect(result.ImageIDVerified).To(BeTrue())
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).NotTo(HaveOccurred())
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	Expect(err).NotTo(HaveOccurred())
+	keyPath := filepath.Join(libRoot, "image-verify.pub")
+	Expect(ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)).To(Succeed())
+
+	policy, err := GetImageVerificationPolicy(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy.IsSet()).To(BeFalse())
+	policy.PinImageID = true
+	policy.PublicKey = keyPath
+
+	result = VerifyAppImage(testAppName, image, policy)
+	Expect(result.Status).To(Equal("failed"))
+	Expect(result.Error).To(Equal("No signature found for image id sha256:1111"))
+
+	Expect(os.MkdirAll(policy.SignatureDir, 0755)).To(Succeed())
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte("sha256:1111")))
+	Expect(ioutil.WriteFile(filepath.Join(policy.SignatureDir, "1111.sig"), []byte(signature), 0644)).To(Succeed())
+	result = VerifyAppImage(testAppName, image, policy)
+	Expect(result.Status).To(Equal("verified"))
+	Expect(result.SignatureVerified).To(BeTrue())
+	Expect(result.ImageID).To(Equal("sha256:1111"))
+}
@@ -0,0 +1,241 @@
+package common
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// WebhookAttempts is the number of times a webhook delivery is attempted
+	WebhookAttempts = 3
+
+	// WebhookBackoff is the delay before the first retry, doubled for each further retry
+	WebhookBackoff = time.Second
+
+	// WebhookTimeout is the time allowed for a single delivery attempt
+	WebhookTimeout = 5 * time.Second
+)
+
+// Webhook is an http endpoint notified about app events
+type Webhook struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events,omitempty"`
+	App       string    `json:"app,omitempty"`
+	Secret    string    `json:"secret"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookPayload is the json body sent to a webhook
+type WebhookPayload struct {
+	ID    string `json:"id"`
+	Event Event  `json:"event"`
+}
+
+// WebhookDelivery records the outcome of delivering an event to a webhook
+type WebhookDelivery struct {
+	ID         string        `json:"id"`
+	WebhookID  string        `json:"webhook_id"`
+	URL        string        `json:"url"`
+	Event      string        `json:"event"`
+	App        string        `json:"app"`
+	Attempts   int           `json:"attempts"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+	Timestamp  time.Time     `json:"timestamp"`
+}
+
+// Matches returns true if the webhook subscribes to the event
+func (w Webhook) Matches(event Event) bool {
+	if w.App != "" && w.App != event.App {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, eventType := range w.Events {
+		if eventType == event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// GetWebhooks returns all configured webhooks
+func GetWebhooks() ([]Webhook, error) {
+	webhooks := []Webhook{}
+	lines, err := PropertyListGet("webhooks", "--global", "hooks")
+	if err != nil {
+		return webhooks, err
+	}
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var webhook Webhook
+		if err := json.Unmarshal([]byte(line), &webhook); err != nil {
+			LogWarn(fmt.Sprintf("Skipping invalid webhook entry: %s", err.Error()))
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, nil
+}
+
+// DispatchWebhooks delivers an event to every webhook subscribed to it and
+// records each delivery in the delivery log
+func DispatchWebhooks(event Event) {
+	webhooks, err := GetWebhooks()
+	if err != nil {
+		LogDebug(fmt.Sprintf("Unable to load webhooks: %s", err.Error()))
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Matches(event) {
+			continue
+		}
+
+		delivery := DeliverWebhook(webhook, event)
+		if !delivery.Success {
+			LogWarn(fmt.Sprintf("Webhook %s delivery failed: %s", webhook.ID, delivery.Error))
+		}
+		if err := appendJSONLine(WebhookDeliveriesLogFile(), delivery, delivery.Timestamp, GetEventLogRotation()); err != nil {
+			LogDebug(fmt.Sprintf("Unable to record webhook delivery: %s", err.Error()))
+		}
+	}
+}
+
+// DeliverWebhook posts an event to a webhook, retrying connection failures and
+// server errors with an exponential backoff
+func DeliverWebhook(webhook Webhook, event Event) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:        NewWebhookID(),
+		WebhookID: webhook.ID,
+		URL:       webhook.URL,
+		Event:     event.Type,
+		App:       event.App,
+		Timestamp: time.Now().UTC(),
+	}
+
+	body, err := json.Marshal(WebhookPayload{ID: delivery.ID, Event: event})
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	client := &http.Client{Timeout: WebhookTimeout}
+	backoff := WebhookBackoff
+	start := time.Now()
+	for delivery.Attempts < WebhookAttempts {
+		if delivery.Attempts > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		delivery.StatusCode, err = postWebhook(client, webhook, delivery.ID, event.Type, body)
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+		if delivery.StatusCode >= 400 && delivery.StatusCode < 500 && delivery.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+
+	delivery.Duration = time.Since(start)
+	return delivery
+}
+
+// QueryWebhookDeliveries returns the recorded deliveries for a webhook, or all
+// webhooks when the id is empty, oldest first
+func QueryWebhookDeliveries(webhookID string, limit int) ([]WebhookDelivery, error) {
+	deliveries := []WebhookDelivery{}
+	for _, file := range logFiles(WebhookDeliveriesLogFile()) {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(b), "\n") {
+			var delivery WebhookDelivery
+			if err := json.Unmarshal([]byte(line), &delivery); err != nil {
+				continue
+			}
+			if webhookID == "" || delivery.WebhookID == webhookID {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+	}
+
+	if limit > 0 && len(deliveries) > limit {
+		deliveries = deliveries[len(deliveries)-limit:]
+	}
+	return deliveries, nil
+}
+
+// SignWebhookPayload returns the hex encoded HMAC-SHA256 signature of a payload
+func SignWebhookPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewWebhookID returns a random identifier for a webhook or delivery
+func NewWebhookID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// WebhookDeliveriesLogFile returns the path to the webhook delivery log
+func WebhookDeliveriesLogFile() string {
+	return filepath.Join(GetDataDirectory("webhooks"), "deliveries.json")
+}
+
+func postWebhook(client *http.Client, webhook Webhook, deliveryID string, eventType string, body []byte) (int, error) {
+	req, err := http.NewRequest("POST", webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "clair-webhooks")
+	req.Header.Set("X-Clair-Delivery", deliveryID)
+	req.Header.Set("X-Clair-Event", eventType)
+	req.Header.Set("X-Clair-Signature", "sha256="+SignWebhookPayload(webhook.Secret, body))
+
+	response, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("Webhook returned %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
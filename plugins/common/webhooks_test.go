@@ -0,0 +1,116 @@
+package common
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCommonWebhookMatches(t *testing.T) {
+	RegisterTestingT(t)
+	event := Event{Type: EventAppDeployed, App: testAppName}
+	Expect(Webhook{}.Matches(event)).To(BeTrue())
+	Expect(Webhook{Events: []string{EventAppDestroyed, EventAppDeployed}}.Matches(event)).To(BeTrue())
+	Expect(Webhook{Events: []string{EventAppDestroyed}}.Matches(event)).To(BeFalse())
+	Expect(Webhook{App: "test-app-2"}.Matches(event)).To(BeFalse())
+}
+
+func TestCommonDeliverWebhook(t *testing.T) {
+	RegisterTestingT(t)
+	defer func(backoff time.Duration) { WebhookBackoff = backoff }(WebhookBackoff)
+	WebhookBackoff = time.Millisecond
+
+	requests := 0
+	var signature, eventHeader string
+	var payload WebhookPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if requests < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		body, _ := ioutil.ReadAll(r.Body)
+		signature = r.Header.Get("X-Clair-Signature")
+		eventHeader = r.Header.Get("X-Clair-Event")
+		Expect(signature).To(Equal("sha256=" + SignWebhookPayload("secret", body)))
+		Expect(json.Unmarshal(body, &payload)).To(Succeed())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	event := Event{Type: EventAppDeployed, App: testAppName, Trigger: "core-post-deploy", Timestamp: time.Now().UTC()}
+	delivery := DeliverWebhook(Webhook{ID: "hook1", URL: server.URL, Secret: "secret"}, event)
+	Expect(delivery.Success).To(BeTrue())
+	Expect(delivery.Attempts).To(Equal(3))
+	Expect(delivery.StatusCode).To(Equal(http.StatusNoContent))
+	Expect(eventHeader).To(Equal(EventAppDeployed))
+	Expect(payload.ID).To(Equal(delivery.ID))
+	Expect(payload.Event.App).To(Equal(testAppName))
+
+	requests = 0
+	delivery = DeliverWebhook(Webhook{ID: "hook2", URL: server.URL + "/gone", Secret: "secret"}, event)
+	Expect(delivery.Success).To(BeFalse())
+	Expect(delivery.Attempts).To(Equal(1))
+	Expect(delivery.Error).To(Equal("Webhook returned 410 Gone"))
+
+	server.Close()
+	delivery = DeliverWebhook(Webhook{ID: "hook3", URL: server.URL, Secret: "secret"}, event)
+	Expect(delivery.Success).To(BeFalse())
+	Expect(delivery.Attempts).To(Equal(WebhookAttempts))
+}
+
+func TestCommonDispatchWebhooks(t *testing.T) {
+	RegisterTestingT(t)
+	defer func(backoff time.Duration) { WebhookBackoff = backoff }(WebhookBackoff)
+	WebhookBackoff = time.Millisecond
+
+	libRoot, err := ioutil.TempDir("", "clair-lib-root")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(libRoot)
+	Expect(os.Setenv("CLAIR_LIB_ROOT", libRoot)).To(Succeed())
+	defer os.Unsetenv("CLAIR_LIB_ROOT")
+
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.URL.Path)
+	}))
+	defer server.Close()
+
+	hooks := []Webhook{
+		{ID: "deploys", URL: server.URL + "/deploys", Events: []string{EventAppDeployed}, Secret: "a"},
+		{ID: "other-app", URL: server.URL + "/other", App: "test-app-2", Secret: "b"},
+		{ID: "all", URL: server.URL + "/all", Secret: "c"},
+	}
+	lines := ""
+	for _, hook := range hooks {
+		b, err := json.Marshal(hook)
+		Expect(err).NotTo(HaveOccurred())
+		lines += string(b) + "\n"
+	}
+	Expect(os.MkdirAll(getPluginAppPropertyPath("webhooks", "--global"), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(getPropertyPath("webhooks", "--global", "hooks"), []byte(lines), 0644)).To(Succeed())
+
+	DispatchWebhooks(Event{Type: EventAppDeployed, App: testAppName, Timestamp: time.Now().UTC()})
+	Expect(received).To(Equal([]string{"/deploys", "/all"}))
+
+	deliveries, err := QueryWebhookDeliveries("", 0)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(deliveries).To(HaveLen(2))
+	Expect(deliveries[0].WebhookID).To(Equal("deploys"))
+	Expect(deliveries[1].Success).To(BeTrue())
+
+	deliveries, err = QueryWebhookDeliveries("all", 0)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(deliveries).To(HaveLen(1))
+}
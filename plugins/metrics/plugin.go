@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the metrics commands
+var Plugin = common.NewPlugin("metrics", "Export clair state as prometheus metrics")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "serve",
+		Description: "Serve prometheus metrics on /metrics",
+		Flags: []common.Flag{
+			{Name: "listen", Default: "127.0.0.1:9102", Placeholder: "<address>", Description: "--listen: address to serve metrics on"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandServe(ctx.String("listen"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "show",
+		Description: "Display prometheus metrics once",
+		Run: func(ctx *common.Context) error {
+			return CommandShow()
+		},
+	})
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/metrics"
+)
+
+func main() {
+	metrics.Plugin.RunCommands()
+}
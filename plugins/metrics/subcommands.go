@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandServe serves the clair metrics over http for prometheus to scrape
+func CommandServe(listen string) error {
+	if listen == "" {
+		return errors.New("Please specify an address to listen on")
+	}
+
+	var mu sync.Mutex
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		var out bytes.Buffer
+		families, err := common.CollectMetrics()
+		if err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to collect all metrics: %s", err.Error()))
+		}
+		if err := common.WriteMetrics(&out, families); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write(out.Bytes())
+	})
+
+	server := &http.Server{
+		Addr:              listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	common.LogInfo1(fmt.Sprintf("Serving metrics on http://%s/metrics", listen))
+	return server.ListenAndServe()
+}
+
+// CommandShow prints the clair metrics once in the prometheus text format
+func CommandShow() error {
+	families, err := common.CollectMetrics()
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to collect all metrics: %s", err.Error()))
+	}
+
+	return common.WriteMetrics(os.Stdout, families)
+}
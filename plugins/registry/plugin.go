@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the registry commands and triggers
+var Plugin = common.NewPlugin("registry", "Manage registry settings for an app")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "login",
+		Description: "Log into a registry and store the credentials",
+		Global:      true,
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "server"}, {Name: "username"}, {Name: "password", Optional: true}},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Description: "--global: set the global registry credentials"},
+			{Name: "password-stdin", Kind: common.KindBool, Description: "--password-stdin: read the password from stdin"},
+		},
+		Run: func(ctx *common.Context) error {
+			password := ctx.String("password")
+			if ctx.Bool("password-stdin") {
+				b, err := ioutil.ReadAll(os.Stdin)
+				if err != nil {
+					return err
+				}
+				password = strings.TrimSpace(string(b))
+			}
+			return CommandLogin(ctx.String("app"), ctx.String("server"), ctx.String("username"), password)
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "logout",
+		Description: "Remove the stored registry credentials",
+		Global:      true,
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "global", Kind: common.KindBool, Description: "--global: remove the global registry credentials"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandLogout(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "prune-tags",
+		Description: "Remove old app image tags from the registry",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "keep", Kind: common.KindInt, Default: "10", Placeholder: "<count>", Description: "--keep: number of most recent tags to keep"},
+			{Name: "dry-run", Kind: common.KindBool, Description: "--dry-run: list the tags that would be removed without removing them"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandPruneTags(ctx.String("app"), ctx.Int("keep"), ctx.Bool("dry-run"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "pull",
+		Description: "Pull an app image from the registry",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "tag", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandPull(ctx.String("app"), ctx.String("tag"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "push",
+		Description: "Push an app image to the registry",
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "tag", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandPush(ctx.String("app"), ctx.String("tag"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "report",
+		Description: "Display registry information for an app",
+		InfoFlag:    true,
+		Args:        []common.Arg{{Name: "app", Optional: true, Complete: common.CompleteApp}},
+		Flags: []common.Flag{
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandReport(ctx.String("app"), ctx.String("format"), ctx.InfoFlag())
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "set",
+		Description: "Set or clear a registry property for an app",
+		Global:      true,
+		Args:        []common.Arg{{Name: "app", Complete: common.CompleteApp}, {Name: "key"}, {Name: "value", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return CommandSet(ctx.String("app"), ctx.String("key"), ctx.String("value"))
+		},
+	})
+
+	appArgs := []common.TriggerArg{{Name: "app"}}
+	renameArgs := []common.TriggerArg{{Name: "old-app"}, {Name: "new-app"}}
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "deployed-app-image-repo",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerDeployedAppImageRepo(ctx.Stdout(), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "deployed-app-repository",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerDeployedAppRepository(ctx.Stdout(), ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-clone-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppCloneSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-rename-setup",
+		Args: renameArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppRenameSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-delete",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return TriggerPostDelete(ctx.String("app"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-release-builder",
+		Args: []common.TriggerArg{{Name: "builder-type"}, {Name: "app"}, {Name: "image-tag"}},
+		Run: func(ctx *common.Context) error {
+			return TriggerPostReleaseBuilder(ctx.Stdout(), ctx.String("builder-type"), ctx.String("app"), ctx.String("image-tag"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "pre-deploy",
+		Args: []common.TriggerArg{{Name: "app"}, {Name: "image-tag", Optional: true}},
+		Run: func(ctx *common.Context) error {
+			return TriggerPreDeploy(ctx.Stdout(), ctx.String("app"), ctx.String("image-tag"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "report",
+		Args: appArgs,
+		Run: func(ctx *common.Context) error {
+			return ReportSingleApp(ctx.Stdout(), ctx.String("app"), "", "")
+		},
+	})
+}
@@ -0,0 +1,123 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+var (
+	DefaultProperties = map[string]string{
+		"image-repo":      "",
+		"push-on-release": "",
+		"server":          "",
+	}
+
+	GlobalProperties = map[string]bool{
+		"push-on-release": true,
+		"server":          true,
+	}
+)
+
+// getRegistryProperty returns an app registry property, falling back to the global value
+func getRegistryProperty(appName string, property string) string {
+	value := ""
+	if appName != "--global" {
+		value = strings.TrimSpace(common.PropertyGet("registry", appName, property))
+	}
+	if value == "" && GlobalProperties[property] {
+		value = strings.TrimSpace(common.PropertyGet("registry", "--global", property))
+	}
+	return value
+}
+
+// getRegistryServer returns the registry server used by an app
+func getRegistryServer(appName string) string {
+	return getRegistryProperty(appName, "server")
+}
+
+// getRegistryAuth returns the credentials for the registry used by an app. App
+// credentials take precedence over the global credentials.
+func getRegistryAuth(appName string) common.RegistryAuth {
+	auth := common.RegistryAuth{ServerAddress: common.RegistryHost(getRegistryServer(appName))}
+	for _, name := range []string{appName, "--global"} {
+		username := common.PropertyGet("registry", name, "username")
+		if username != "" {
+			auth.Username = username
+			auth.Password = common.PropertyGet("registry", name, "password")
+			break
+		}
+	}
+	return auth
+}
+
+// getImageRepo returns the registry repository app images are pushed to
+func getImageRepo(appName string) string {
+	imageRepo := strings.TrimSpace(common.PropertyGet("registry", appName, "image-repo"))
+	if imageRepo == "" {
+		imageRepo = common.GetAppImageRepo(appName)
+	}
+	return imageRepo
+}
+
+// getPushOnRelease returns true if app images are pushed when released
+func getPushOnRelease(appName string) bool {
+	pushOnRelease, err := strconv.ParseBool(getRegistryProperty(appName, "push-on-release"))
+	return err != nil || pushOnRelease
+}
+
+// getRemoteImage returns the registry image reference for an app image tag
+func getRemoteImage(appName string, imageTag string) string {
+	return fmt.Sprintf("%s/%s:%s", common.RegistryHost(getRegistryServer(appName)), getImageRepo(appName), imageTag)
+}
+
+// tagRemoteImage tags the local app image with its registry image reference
+func tagRemoteImage(appName string, imageTag string) (string, error) {
+	localImage := fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), imageTag)
+	if !common.VerifyImage(localImage) {
+		return "", fmt.Errorf("App image (%s) not found", localImage)
+	}
+
+	remoteImage := getRemoteImage(appName, imageTag)
+	if err := common.GetContainerRuntime().ImageTag(localImage, remoteImage); err != nil {
+		return "", fmt.Errorf("Unable to tag %s as %s: %s", localImage, remoteImage, err.Error())
+	}
+	return remoteImage, nil
+}
+
+// pushImage tags a local app image with its registry reference and pushes it
+func pushImage(stdout io.Writer, appName string, imageTag string) error {
+	remoteImage, err := tagRemoteImage(appName, imageTag)
+	if err != nil {
+		return err
+	}
+
+	common.LogInfo1To(stdout, fmt.Sprintf("Pushing %s", remoteImage))
+	if err := common.GetContainerRuntime().ImagePush(remoteImage, getRegistryAuth(appName)); err != nil {
+		return fmt.Errorf("Unable to push %s: %s", remoteImage, err.Error())
+	}
+	return nil
+}
+
+// pullImage pulls an app image from the registry
+func pullImage(stdout io.Writer, appName string, imageTag string) error {
+	remoteImage := getRemoteImage(appName, imageTag)
+	common.LogInfo1To(stdout, fmt.Sprintf("Pulling %s", remoteImage))
+	if err := common.GetContainerRuntime().ImagePull(remoteImage, getRegistryAuth(appName)); err != nil {
+		return fmt.Errorf("Unable to pull %s: %s", remoteImage, err.Error())
+	}
+	return nil
+}
+
+// newRegistryClient returns a registry api client for the registry used by an app
+func newRegistryClient(appName string) (*common.RegistryClient, error) {
+	server := getRegistryServer(appName)
+	if server == "" {
+		return nil, fmt.Errorf("No registry server configured for %s", appName)
+	}
+
+	return common.NewRegistryClient(server, getRegistryAuth(appName)), nil
+}
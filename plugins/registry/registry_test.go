@@ -0,0 +1,176 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+var testAppName = "test-app-1"
+
+type fakeRegistry struct {
+	repository string
+	tags       map[string]string
+	created    map[string]time.Time
+	deleted    []string
+}
+
+// newFakeRegistryServer serves the registry v2 api for a single repository,
+// issuing bearer tokens to the clair:secret credentials
+func newFakeRegistryServer(registry *fakeRegistry) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "clair" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "registry-token"})
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer registry-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		path := strings.TrimPrefix(r.URL.Path, "/v2/"+registry.repository+"/")
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case path == "tags/list":
+			tags := []string{}
+			for tag := range registry.tags {
+				tags = append(tags, tag)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"name": registry.repository, "tags": tags})
+		case strings.HasPrefix(path, "manifests/") && r.Method == "GET":
+			digest, ok := registry.tags[strings.TrimPrefix(path, "manifests/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Docker-Content-Digest", digest)
+			json.NewEncoder(w).Encode(map[string]interface{}{"config": map[string]string{"digest": "config-" + digest}})
+		case strings.HasPrefix(path, "manifests/") && r.Method == "DELETE":
+			digest := strings.TrimPrefix(path, "manifests/")
+			registry.deleted = append(registry.deleted, digest)
+			for tag, tagDigest := range registry.tags {
+				if tagDigest == digest {
+					delete(registry.tags, tag)
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+		case strings.HasPrefix(path, "blobs/config-"):
+			digest := strings.TrimPrefix(path, "blobs/config-")
+			json.NewEncoder(w).Encode(map[string]time.Time{"created": registry.created[digest]})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func setupTestApp() func() {
+	libRoot, err := os.MkdirTemp("", "clair-registry")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(libRoot, "home", testAppName), 0755)).To(Succeed())
+	Expect(os.MkdirAll(filepath.Join(libRoot, "plugins", "enabled"), 0755)).To(Succeed())
+
+	os.Setenv("CLAIR_LIB_ROOT", libRoot)
+	os.Setenv("CLAIR_ROOT", filepath.Join(libRoot, "home"))
+	os.Setenv("CLAIR_SYSTEM_GROUP", "root")
+	os.Setenv("CLAIR_SYSTEM_USER", "root")
+	os.Setenv("PLUGIN_PATH", filepath.Join(libRoot, "plugins"))
+	return func() {
+		os.RemoveAll(libRoot)
+		os.Unsetenv("CLAIR_LIB_ROOT")
+		os.Setenv("CLAIR_ROOT", "/home/clair")
+		os.Unsetenv("CLAIR_SYSTEM_GROUP")
+		os.Unsetenv("CLAIR_SYSTEM_USER")
+		os.Unsetenv("PLUGIN_PATH")
+	}
+}
+
+func TestRegistryLogin(t *testing.T) {
+	RegisterTestingT(t)
+	teardown := setupTestApp()
+	defer teardown()
+	server := newFakeRegistryServer(&fakeRegistry{repository: "clair/" + testAppName})
+	defer server.Close()
+
+	err := CommandLogin("--global", server.URL, "clair", "wrong")
+	Expect(err).To(MatchError(HavePrefix("Unable to log into " + server.URL + ": Unable to authenticate with registry")))
+	Expect(common.PropertyGet("registry", "--global", "username")).To(BeEmpty())
+
+	Expect(CommandLogin("--global", server.URL, "clair", "secret")).To(Succeed())
+	Expect(getRegistryServer(testAppName)).To(Equal(server.URL))
+	Expect(getRegistryAuth(testAppName)).To(Equal(common.RegistryAuth{
+		Username:      "clair",
+		Password:      "secret",
+		ServerAddress: common.RegistryHost(server.URL),
+	}))
+	Expect(getRemoteImage(testAppName, "v1")).To(Equal(common.RegistryHost(server.URL) + "/clair/" + testAppName + ":v1"))
+
+	Expect(CommandLogin(testAppName, server.URL, "clair", "secret")).To(Succeed())
+	Expect(common.PropertyWrite("registry", testAppName, "username", "deployer")).To(Succeed())
+	Expect(getRegistryAuth(testAppName).Username).To(Equal("deployer"))
+
+	Expect(CommandLogout(testAppName)).To(Succeed())
+	Expect(getRegistryAuth(testAppName).Username).To(Equal("clair"))
+	Expect(CommandLogin("missing-app", server.URL, "clair", "secret")).To(MatchError("App missing-app does not exist"))
+}
+
+func TestRegistryPruneTags(t *testing.T) {
+	RegisterTestingT(t)
+	teardown := setupTestApp()
+	defer teardown()
+
+	Expect(CommandPruneTags(testAppName, 1, false)).To(MatchError("No registry server configured for " + testAppName))
+	Expect(CommandPruneTags(testAppName, -1, false)).To(MatchError("Invalid keep value -1: must be a positive integer"))
+
+	now := time.Now().UTC()
+	registry := &fakeRegistry{
+		repository: "team/web",
+		tags: map[string]string{
+			"latest": "sha256:c",
+			"v1":     "sha256:a",
+			"v2":     "sha256:b",
+			"v2-rc":  "sha256:b",
+			"v3":     "sha256:c",
+		},
+		created: map[string]time.Time{
+			"sha256:a": now.Add(-3 * time.Hour),
+			"sha256:b": now.Add(-2 * time.Hour),
+			"sha256:c": now.Add(-1 * time.Hour),
+		},
+	}
+	server := newFakeRegistryServer(registry)
+	defer server.Close()
+	Expect(CommandLogin(testAppName, server.URL, "clair", "secret")).To(Succeed())
+	Expect(common.PropertyWrite("registry", testAppName, "image-repo", "team/web")).To(Succeed())
+
+	Expect(CommandPruneTags(testAppName, 1, true)).To(Succeed())
+	Expect(registry.deleted).To(BeEmpty())
+	Expect(registry.tags).To(HaveLen(5))
+
+	Expect(CommandPruneTags(testAppName, 1, false)).To(Succeed())
+	sort.Strings(registry.deleted)
+	Expect(registry.deleted).To(Equal([]string{"sha256:a", "sha256:b"}))
+	Expect(registry.tags).To(Equal(map[string]string{"latest": "sha256:c", "v3": "sha256:c"}))
+
+	Expect(CommandPruneTags(testAppName, 1, false)).To(Succeed())
+	Expect(registry.deleted).To(HaveLen(2))
+
+	server.Close()
+	Expect(CommandPruneTags(testAppName, 1, false)).To(MatchError(HavePrefix("Unable to reach registry " + server.URL)))
+}
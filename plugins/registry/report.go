@@ -0,0 +1,73 @@
+package registry
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// ReportSingleApp is an internal function that displays the registry report for one or more apps
+func ReportSingleApp(stdout io.Writer, appName string, format string, infoFlag string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+
+	flags := map[string]common.ReportFunc{
+		"--registry-computed-image-repo":      reportComputedImageRepo,
+		"--registry-computed-push-on-release": reportComputedPushOnRelease,
+		"--registry-computed-server":          reportComputedServer,
+		"--registry-global-push-on-release":   reportGlobalPushOnRelease,
+		"--registry-global-server":            reportGlobalServer,
+		"--registry-image-repo":               reportImageRepo,
+		"--registry-push-on-release":          reportPushOnRelease,
+		"--registry-server":                   reportServer,
+		"--registry-username":                 reportUsername,
+	}
+
+	flagKeys := []string{}
+	for flagKey := range flags {
+		flagKeys = append(flagKeys, flagKey)
+	}
+
+	trimPrefix := false
+	uppercaseFirstCharacter := true
+	infoFlags := common.CollectReport(appName, infoFlag, flags)
+	return common.ReportSingleApp(stdout, "registry", appName, infoFlag, infoFlags, flagKeys, format, trimPrefix, uppercaseFirstCharacter)
+}
+
+func reportComputedImageRepo(appName string) string {
+	return getImageRepo(appName)
+}
+
+func reportComputedPushOnRelease(appName string) string {
+	return strconv.FormatBool(getPushOnRelease(appName))
+}
+
+func reportComputedServer(appName string) string {
+	return getRegistryServer(appName)
+}
+
+func reportGlobalPushOnRelease(appName string) string {
+	return common.PropertyGet("registry", "--global", "push-on-release")
+}
+
+func reportGlobalServer(appName string) string {
+	return common.PropertyGet("registry", "--global", "server")
+}
+
+func reportImageRepo(appName string) string {
+	return common.PropertyGet("registry", appName, "image-repo")
+}
+
+func reportPushOnRelease(appName string) string {
+	return common.PropertyGet("registry", appName, "push-on-release")
+}
+
+func reportServer(appName string) string {
+	return common.PropertyGet("registry", appName, "server")
+}
+
+func reportUsername(appName string) string {
+	return getRegistryAuth(appName).Username
+}
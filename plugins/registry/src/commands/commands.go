@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/registry"
+)
+
+func main() {
+	registry.Plugin.RunCommands()
+}
@@ -0,0 +1,163 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandLogin stores registry credentials for an app or globally
+func CommandLogin(appName string, server string, username string, password string) error {
+	if appName != "--global" {
+		if err := common.VerifyAppName(appName); err != nil {
+			return err
+		}
+	}
+	if server == "" {
+		return errors.New("No registry server specified")
+	}
+	if username == "" {
+		return errors.New("No username specified")
+	}
+	if password == "" {
+		return errors.New("No password specified")
+	}
+
+	auth := common.RegistryAuth{Username: username, Password: password, ServerAddress: common.RegistryHost(server)}
+	if err := common.NewRegistryClient(server, auth).Ping(); err != nil {
+		return fmt.Errorf("Unable to log into %s: %s", server, err.Error())
+	}
+
+	properties := map[string]string{"server": server, "username": username, "password": password}
+	for _, property := range []string{"server", "username", "password"} {
+		if err := common.PropertyWrite("registry", appName, property, properties[property]); err != nil {
+			return err
+		}
+	}
+
+	common.LogInfo1(fmt.Sprintf("Logged into %s", server))
+	return nil
+}
+
+// CommandLogout removes the registry credentials for an app or globally
+func CommandLogout(appName string) error {
+	if appName != "--global" {
+		if err := common.VerifyAppName(appName); err != nil {
+			return err
+		}
+	}
+
+	for _, property := range []string{"username", "password"} {
+		if err := common.PropertyDelete("registry", appName, property); err != nil {
+			return err
+		}
+	}
+
+	common.LogInfo1("Registry credentials removed")
+	return nil
+}
+
+// CommandPruneTags removes old tags of an app image from the registry
+func CommandPruneTags(appName string, keep int, dryRun bool) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+	if keep < 0 {
+		return fmt.Errorf("Invalid keep value %d: must be a positive integer", keep)
+	}
+
+	client, err := newRegistryClient(appName)
+	if err != nil {
+		return err
+	}
+
+	keepTags := []string{"latest"}
+	if imageTag, err := common.GetRunningImageTag(appName, ""); err == nil {
+		keepTags = append(keepTags, imageTag)
+	}
+
+	imageRepo := getImageRepo(appName)
+	removed, err := client.PruneTags(imageRepo, keep, keepTags, dryRun)
+	for _, tag := range removed {
+		if dryRun {
+			common.LogInfo2Quiet(fmt.Sprintf("Would remove %s:%s", imageRepo, tag))
+		} else {
+			common.LogInfo2Quiet(fmt.Sprintf("Removed %s:%s", imageRepo, tag))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		common.LogInfo1("No tags to remove")
+	}
+	return nil
+}
+
+// CommandPull pulls an app image from the registry
+func CommandPull(appName string, imageTag string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+	if getRegistryServer(appName) == "" {
+		return fmt.Errorf("No registry server configured for %s", appName)
+	}
+
+	imageTag, err := common.GetRunningImageTag(appName, imageTag)
+	if err != nil {
+		return err
+	}
+
+	return pullImage(os.Stdout, appName, imageTag)
+}
+
+// CommandPush pushes an app image to the registry
+func CommandPush(appName string, imageTag string) error {
+	if err := common.VerifyAppName(appName); err != nil {
+		return err
+	}
+	if getRegistryServer(appName) == "" {
+		return fmt.Errorf("No registry server configured for %s", appName)
+	}
+
+	imageTag, err := common.GetRunningImageTag(appName, imageTag)
+	if err != nil {
+		return err
+	}
+
+	return pushImage(os.Stdout, appName, imageTag)
+}
+
+// CommandReport displays a registry report for one or more apps
+func CommandReport(appName string, format string, infoFlag string) error {
+	if len(appName) == 0 {
+		apps, err := common.ClairApps()
+		if err != nil {
+			return err
+		}
+		for _, appName := range apps {
+			if err := ReportSingleApp(os.Stdout, appName, format, infoFlag); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return ReportSingleApp(os.Stdout, appName, format, infoFlag)
+}
+
+// CommandSet sets or clears a registry property for an app or globally
+func CommandSet(appName string, property string, value string) error {
+	if property == "push-on-release" && value != "" {
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("Invalid %s %s: must be true or false", property, value)
+		}
+	}
+
+	common.CommandPropertySet("registry", appName, property, value, DefaultProperties, GlobalProperties)
+	return nil
+}
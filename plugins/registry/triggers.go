@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// TriggerDeployedAppImageRepo outputs the registry repository of app images
+func TriggerDeployedAppImageRepo(stdout io.Writer, appName string) error {
+	if getRegistryServer(appName) == "" {
+		return nil
+	}
+
+	fmt.Fprint(stdout, getImageRepo(appName))
+	return nil
+}
+
+// TriggerDeployedAppRepository outputs the registry host prefix of app images
+func TriggerDeployedAppRepository(stdout io.Writer, appName string) error {
+	server := getRegistryServer(appName)
+	if server == "" {
+		return nil
+	}
+
+	fmt.Fprintf(stdout, "%s/", common.RegistryHost(server))
+	return nil
+}
+
+// TriggerInstall runs the install step for the registry plugin
+func TriggerInstall() error {
+	if err := common.PropertySetup("registry"); err != nil {
+		return fmt.Errorf("Unable to install the registry plugin: %s", err.Error())
+	}
+
+	return nil
+}
+
+// TriggerPostAppCloneSetup creates new registry files
+func TriggerPostAppCloneSetup(oldAppName string, newAppName string) error {
+	if err := common.PropertyClone("registry", oldAppName, newAppName); err != nil {
+		return err
+	}
+
+	return common.PropertyDelete("registry", newAppName, "image-repo")
+}
+
+// TriggerPostAppRenameSetup renames registry files
+func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
+	if err := common.PropertyClone("registry", oldAppName, newAppName); err != nil {
+		return err
+	}
+
+	return common.PropertyDestroy("registry", oldAppName)
+}
+
+// TriggerPostDelete destroys the registry data for a given app container
+func TriggerPostDelete(appName string) error {
+	return common.PropertyDestroy("registry", appName)
+}
+
+// TriggerPostReleaseBuilder tags the released image for the registry and pushes it
+func TriggerPostReleaseBuilder(stdout io.Writer, builderType string, appName string, imageTag string) error {
+	if getRegistryServer(appName) == "" {
+		return nil
+	}
+
+	if imageTag == "" {
+		imageTag = "latest"
+	}
+
+	if !getPushOnRelease(appName) {
+		_, err := tagRemoteImage(appName, imageTag)
+		return err
+	}
+
+	return pushImage(stdout, appName, imageTag)
+}
+
+// TriggerPreDeploy ensures the registry image being deployed exists locally,
+// tagging and pushing a locally retained image or pulling it from the registry
+func TriggerPreDeploy(stdout io.Writer, appName string, imageTag string) error {
+	if getRegistryServer(appName) == "" {
+		return nil
+	}
+
+	imageTag, err := common.GetRunningImageTag(appName, imageTag)
+	if err != nil {
+		return err
+	}
+
+	if common.VerifyImage(getRemoteImage(appName, imageTag)) {
+		return nil
+	}
+
+	if common.VerifyImage(fmt.Sprintf("%s:%s", common.GetAppImageRepo(appName), imageTag)) {
+		return TriggerPostReleaseBuilder(stdout, "", appName, imageTag)
+	}
+
+	return pullImage(stdout, appName, imageTag)
+}
@@ -0,0 +1,76 @@
+package webhooks
+
+import (
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// Plugin registers the webhooks commands and triggers
+var Plugin = common.NewPlugin("webhooks", "Manage outgoing webhooks for app events")
+
+func init() {
+	Plugin.AddCommand(common.Command{
+		Name:        "add",
+		Description: "Add a webhook notified about app events",
+		Args: []common.Arg{
+			{Name: "url"},
+		},
+		Flags: []common.Flag{
+			{Name: "events", Placeholder: "<event,...>", Description: "--events: comma separated event types to deliver, defaults to all"},
+			{Name: "app", Description: "--app: only deliver events for the app", Complete: common.CompleteApp},
+			{Name: "secret", Description: "--secret: secret used to sign payloads, generated when empty"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandAdd(ctx.String("url"), ctx.String("events"), ctx.String("app"), ctx.String("secret"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "deliveries",
+		Description: "Display recent webhook deliveries",
+		Flags: []common.Flag{
+			{Name: "webhook", Placeholder: "<id>", Description: "--webhook: only show deliveries for the webhook"},
+			{Name: "limit", Kind: common.KindInt, Default: "20", Placeholder: "<count>", Description: "--limit: show at most the given number of the most recent deliveries"},
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandDeliveries(ctx.String("webhook"), ctx.Int("limit"), ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "list",
+		Description: "List configured webhooks",
+		Flags: []common.Flag{
+			{Name: "format", Default: "stdout", Values: []string{"stdout", "json"}, Description: "format: [ stdout | json ]"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandList(ctx.String("format"))
+		},
+	})
+
+	Plugin.AddCommand(common.Command{
+		Name:        "remove",
+		Description: "Remove a webhook",
+		Args: []common.Arg{
+			{Name: "id"},
+		},
+		Run: func(ctx *common.Context) error {
+			return CommandRemove(ctx.String("id"))
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "install",
+		Run: func(ctx *common.Context) error {
+			return TriggerInstall()
+		},
+	})
+
+	Plugin.AddTrigger(common.Trigger{
+		Name: "post-app-rename-setup",
+		Args: []common.TriggerArg{{Name: "old-app"}, {Name: "new-app"}},
+		Run: func(ctx *common.Context) error {
+			return TriggerPostAppRenameSetup(ctx.String("old-app"), ctx.String("new-app"))
+		},
+	})
+}
@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/vinybergamo/clair/plugins/webhooks"
+)
+
+func main() {
+	webhooks.Plugin.RunSubcommand()
+}
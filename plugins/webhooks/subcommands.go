@@ -0,0 +1,187 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// CommandAdd registers a webhook for app events
+func CommandAdd(webhookURL string, events string, appName string, secret string) error {
+	if webhookURL == "" {
+		return errors.New("Please specify a webhook url")
+	}
+	if err := validateURL(webhookURL); err != nil {
+		return err
+	}
+
+	eventTypes, err := parseEvents(events)
+	if err != nil {
+		return err
+	}
+
+	if appName != "" {
+		if err := common.VerifyAppName(appName); err != nil {
+			return err
+		}
+	}
+
+	if secret == "" {
+		secret = common.NewWebhookID() + common.NewWebhookID()
+	}
+
+	webhook := common.Webhook{
+		ID:        common.NewWebhookID(),
+		URL:       webhookURL,
+		Events:    eventTypes,
+		App:       appName,
+		Secret:    secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	b, err := json.Marshal(webhook)
+	if err != nil {
+		return err
+	}
+
+	if err := common.PropertyListAdd("webhooks", "--global", "hooks", string(b), 0); err != nil {
+		return fmt.Errorf("Unable to add webhook: %s", err.Error())
+	}
+
+	common.LogInfo1(fmt.Sprintf("Added webhook %s", webhook.ID))
+	common.LogVerbose(fmt.Sprintf("Signing secret: %s", secret))
+	return nil
+}
+
+// CommandDeliveries displays the recorded webhook deliveries
+func CommandDeliveries(webhookID string, limit int, format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	deliveries, err := common.QueryWebhookDeliveries(webhookID, limit)
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(deliveries)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(deliveries) == 0 {
+		common.LogInfo1Quiet("No webhook deliveries found")
+		return nil
+	}
+
+	rows := [][]string{{"Time", "Webhook", "Event", "App", "Attempts", "Status", "Error"}}
+	for _, delivery := range deliveries {
+		status := "failed"
+		if delivery.Success {
+			status = "ok"
+		}
+		if delivery.StatusCode != 0 {
+			status = fmt.Sprintf("%s (%d)", status, delivery.StatusCode)
+		}
+
+		rows = append(rows, []string{
+			delivery.Timestamp.Local().Format(time.RFC3339),
+			delivery.WebhookID,
+			delivery.Event,
+			delivery.App,
+			strconv.Itoa(delivery.Attempts),
+			status,
+			delivery.Error,
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandList displays the configured webhooks
+func CommandList(format string) error {
+	if format != "stdout" && format != "json" {
+		return fmt.Errorf("Invalid format %s: must be stdout or json", format)
+	}
+
+	webhooks, err := common.GetWebhooks()
+	if err != nil {
+		return err
+	}
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	if format == "json" {
+		b, err := json.Marshal(webhooks)
+		if err != nil {
+			return err
+		}
+		common.Log(string(b))
+		return nil
+	}
+
+	if len(webhooks) == 0 {
+		common.LogInfo1Quiet("No webhooks configured")
+		return nil
+	}
+
+	rows := [][]string{{"Id", "Url", "Events", "App", "Created"}}
+	for _, webhook := range webhooks {
+		events := "all"
+		if len(webhook.Events) > 0 {
+			events = strings.Join(webhook.Events, ",")
+		}
+		appName := "all"
+		if webhook.App != "" {
+			appName = webhook.App
+		}
+
+		rows = append(rows, []string{
+			webhook.ID,
+			webhook.URL,
+			events,
+			appName,
+			webhook.CreatedAt.Local().Format(time.RFC3339),
+		})
+	}
+	common.Log(common.FormatTable(rows))
+	return nil
+}
+
+// CommandRemove removes a webhook
+func CommandRemove(webhookID string) error {
+	if webhookID == "" {
+		return errors.New("Please specify a webhook id")
+	}
+
+	webhooks, err := common.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	remaining := []common.Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.ID != webhookID {
+			remaining = append(remaining, webhook)
+		}
+	}
+	if len(remaining) == len(webhooks) {
+		return fmt.Errorf("Webhook %s not found", webhookID)
+	}
+
+	if err := writeWebhooks(remaining); err != nil {
+		return fmt.Errorf("Unable to remove webhook: %s", err.Error())
+	}
+
+	common.LogInfo1(fmt.Sprintf("Removed webhook %s", webhookID))
+	return nil
+}
@@ -0,0 +1,41 @@
+package webhooks
+
+import (
+	"fmt"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// TriggerInstall runs the install step for the webhooks plugin
+func TriggerInstall() error {
+	if err := common.PropertySetup("webhooks"); err != nil {
+		return fmt.Errorf("Unable to install the webhooks plugin: %s", err.Error())
+	}
+
+	if err := common.CreateDataDirectory("webhooks"); err != nil {
+		return fmt.Errorf("Unable to create webhooks data directory: %s", err.Error())
+	}
+
+	return nil
+}
+
+// TriggerPostAppRenameSetup points webhooks scoped to the old app at the new app
+func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
+	webhooks, err := common.GetWebhooks()
+	if err != nil {
+		return err
+	}
+
+	renamed := false
+	for i := range webhooks {
+		if webhooks[i].App == oldAppName {
+			webhooks[i].App = newAppName
+			renamed = true
+		}
+	}
+	if !renamed {
+		return nil
+	}
+
+	return writeWebhooks(webhooks)
+}
@@ -0,0 +1,68 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+// validEvents are the event types a webhook may subscribe to
+var validEvents = []string{
+	common.EventAppCloned,
+	common.EventAppCreated,
+	common.EventAppDeployed,
+	common.EventAppDeployFailed,
+	common.EventAppDestroyed,
+	common.EventAppLocked,
+	common.EventAppRenamed,
+	common.EventAppRolledBack,
+	common.EventAppUnlocked,
+}
+
+func parseEvents(value string) ([]string, error) {
+	events := []string{}
+	for _, event := range strings.Split(value, ",") {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+
+		valid := false
+		for _, validEvent := range validEvents {
+			if event == validEvent {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return events, fmt.Errorf("Invalid event %s: must be one of %s", event, strings.Join(validEvents, ", "))
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func validateURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("Invalid webhook url %s: must be an http or https url", value)
+	}
+	return nil
+}
+
+func writeWebhooks(webhooks []common.Webhook) error {
+	lines := []string{}
+	for _, webhook := range webhooks {
+		b, err := json.Marshal(webhook)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, string(b))
+	}
+
+	return common.PropertyListWrite("webhooks", "--global", "hooks", lines)
+}
@@ -0,0 +1,157 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/vinybergamo/clair/plugins/common"
+)
+
+var testAppName = "test-app-1"
+
+type receivedWebhook struct {
+	path      string
+	event     string
+	delivery  string
+	signature string
+	body      []byte
+}
+
+func setupWebhooks() func() {
+	libRoot, err := os.MkdirTemp("", "clair-webhooks")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(libRoot, "home", testAppName), 0755)).To(Succeed())
+	Expect(os.MkdirAll(filepath.Join(libRoot, "plugins", "enabled"), 0755)).To(Succeed())
+
+	os.Setenv("CLAIR_LIB_ROOT", libRoot)
+	os.Setenv("CLAIR_ROOT", filepath.Join(libRoot, "home"))
+	os.Setenv("CLAIR_SYSTEM_GROUP", "root")
+	os.Setenv("CLAIR_SYSTEM_USER", "root")
+	os.Setenv("PLUGIN_PATH", filepath.Join(libRoot, "plugins"))
+	Expect(TriggerInstall()).To(Succeed())
+	return func() {
+		os.RemoveAll(libRoot)
+		os.Unsetenv("CLAIR_LIB_ROOT")
+		os.Setenv("CLAIR_ROOT", "/home/clair")
+		os.Unsetenv("CLAIR_SYSTEM_GROUP")
+		os.Unsetenv("CLAIR_SYSTEM_USER")
+		os.Unsetenv("PLUGIN_PATH")
+	}
+}
+
+func newWebhookServer(received *[]receivedWebhook) *httptest.Server {
+	var mu sync.Mutex
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		*received = append(*received, receivedWebhook{
+			path:      r.URL.Path,
+			event:     r.Header.Get("X-Clair-Event"),
+			delivery:  r.Header.Get("X-Clair-Delivery"),
+			signature: r.Header.Get("X-Clair-Signature"),
+			body:      body,
+		})
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+}
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhooksAdd(t *testing.T) {
+	RegisterTestingT(t)
+	teardown := setupWebhooks()
+	defer teardown()
+
+	Expect(CommandAdd("", "", "", "")).To(MatchError("Please specify a webhook url"))
+	Expect(CommandAdd("ftp://example.com", "", "", "")).To(MatchError("Invalid webhook url ftp://example.com: must be an http or https url"))
+	Expect(CommandAdd("https://example.com", "deploy,bogus", "", "")).To(MatchError(HavePrefix("Invalid event bogus: must be one of")))
+	Expect(CommandAdd("https://example.com", "", "missing-app", "")).To(MatchError("App missing-app does not exist"))
+
+	Expect(CommandAdd("https://example.com/all", "", "", "")).To(Succeed())
+	Expect(CommandAdd("https://example.com/deploys", " deploy, rollback ", testAppName, "secret")).To(Succeed())
+	webhooks, err := common.GetWebhooks()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(webhooks).To(HaveLen(2))
+	Expect(webhooks[0].Events).To(BeEmpty())
+	Expect(webhooks[0].Secret).To(HaveLen(32))
+	Expect(webhooks[1].Events).To(Equal([]string{common.EventAppDeployed, common.EventAppRolledBack}))
+	Expect(webhooks[1].App).To(Equal(testAppName))
+	Expect(webhooks[1].Secret).To(Equal("secret"))
+
+	Expect(TriggerPostAppRenameSetup(testAppName, "test-app-2")).To(Succeed())
+	webhooks, err = common.GetWebhooks()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(webhooks[1].App).To(Equal("test-app-2"))
+
+	Expect(CommandRemove("missing")).To(MatchError("Webhook missing not found"))
+	Expect(CommandRemove(webhooks[0].ID)).To(Succeed())
+	webhooks, err = common.GetWebhooks()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(webhooks).To(HaveLen(1))
+	Expect(webhooks[0].URL).To(Equal("https://example.com/deploys"))
+}
+
+func TestWebhooksDelivery(t *testing.T) {
+	RegisterTestingT(t)
+	teardown := setupWebhooks()
+	defer teardown()
+	defer func(backoff time.Duration) { common.WebhookBackoff = backoff }(common.WebhookBackoff)
+	common.WebhookBackoff = time.Millisecond
+
+	received := []receivedWebhook{}
+	server := newWebhookServer(&received)
+	defer server.Close()
+
+	Expect(CommandAdd(server.URL+"/deploys", "deploy", testAppName, "deploy-secret")).To(Succeed())
+	Expect(CommandAdd(server.URL+"/destroys", "destroy", "", "destroy-secret")).To(Succeed())
+	Expect(CommandAdd(server.URL+"/gone", "", "", "gone-secret")).To(Succeed())
+
+	event := common.Event{Type: common.EventAppDeployed, App: testAppName, Trigger: "core-post-deploy", Timestamp: time.Now().UTC()}
+	common.DispatchWebhooks(event)
+	Expect(received).To(HaveLen(2))
+
+	deploy := received[0]
+	Expect(deploy.path).To(Equal("/deploys"))
+	Expect(deploy.event).To(Equal(common.EventAppDeployed))
+	Expect(deploy.signature).To(Equal(sign("deploy-secret", deploy.body)))
+	Expect(deploy.signature).NotTo(Equal(sign("destroy-secret", deploy.body)))
+	var payload common.WebhookPayload
+	Expect(json.Unmarshal(deploy.body, &payload)).To(Succeed())
+	Expect(payload.ID).To(Equal(deploy.delivery))
+	Expect(payload.Event.App).To(Equal(testAppName))
+	Expect(payload.Event.Trigger).To(Equal("core-post-deploy"))
+
+	gone := received[1]
+	Expect(gone.path).To(Equal("/gone"))
+	Expect(gone.signature).To(Equal(sign("gone-secret", gone.body)))
+
+	deliveries, err := common.QueryWebhookDeliveries("", 0)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(deliveries).To(HaveLen(2))
+	Expect(deliveries[0].ID).To(Equal(deploy.delivery))
+	Expect(deliveries[0].Success).To(BeTrue())
+	Expect(deliveries[1].URL).To(Equal(server.URL + "/gone"))
+	Expect(deliveries[1].Success).To(BeFalse())
+	Expect(deliveries[1].Attempts).To(Equal(1))
+	Expect(deliveries[1].StatusCode).To(Equal(http.StatusGone))
+	Expect(CommandDeliveries("", 0, "json")).To(Succeed())
+	Expect(CommandDeliveries("", 0, "yaml")).To(MatchError("Invalid format yaml: must be stdout or json"))
+}